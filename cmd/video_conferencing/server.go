@@ -16,6 +16,8 @@ import (
 	"net/http"
 	"os"
 	"time"
+	// Time zones of scheduled meetings are loaded from the embedded database as the image has none
+	_ "time/tzdata"
 
 	"github.com/gorilla/handlers"
 
@@ -36,7 +38,11 @@ import (
 	"github.com/samyak-jain/agora_backend/utils"
 
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/gorilla/websocket"
 
 	"github.com/newrelic/go-agent/v3/integrations/nrgorilla"
 	newrelic "github.com/newrelic/go-agent/v3/newrelic"
@@ -78,16 +84,88 @@ func main() {
 		migrations.RunMigration(configDir)
 	}
 
+	pstnProvider, err := services.NewPSTNProvider(logger)
+	if err != nil {
+		logger.Fatal().Err(err).Str("provider", viper.GetString("PSTN_PROVIDER")).Msg("Error initializing PSTN provider")
+		return
+	}
+
+	recordingProfiles, err := utils.LoadRecordingProfiles()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Error loading recording profiles")
+		return
+	}
+
+	filePrefix, err := utils.LoadFilePrefixTemplate()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Error loading recording file prefix")
+		return
+	}
+
+	storage, err := utils.LoadStorageDestinations()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Error loading recording storage destinations")
+		return
+	}
+
+	snapshots, err := utils.LoadSnapshotSettings()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Error loading snapshot settings")
+		return
+	}
+
+	retentionWorker, err := services.NewRetentionWorker(database, logger, storage, utils.NewStorageClient())
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Error initializing recording retention")
+		return
+	}
+
+	go retentionWorker.Run()
+
+	lobbyBroker, err := services.NewLobbyBroker(database, logger, viper.GetString("DATABASE_URL"))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Error listening for lobby changes")
+		return
+	}
+
+	go lobbyBroker.Run()
+
 	router := mux.NewRouter()
 
 	config := generated.Config{
 		Resolvers: &graph.Resolver{
-			DB:     database,
-			Logger: logger,
+			DB:                database,
+			Logger:            logger,
+			PSTN:              pstnProvider,
+			Recording:         utils.NewRecordingClient(),
+			RecordingProfiles: recordingProfiles,
+			FilePrefix:        filePrefix,
+			Storage:           storage,
+			Snapshots:         snapshots,
+			Lobby:             lobbyBroker,
 		},
 	}
 
-	srv := handler.NewDefaultServer(generated.NewExecutableSchema(config))
+	// Same as handler.NewDefaultServer, except that subscriptions accept the allowed origin
+	srv := handler.New(generated.NewExecutableSchema(config))
+	srv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+		Upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				allowedOrigin := viper.GetString("ALLOWED_ORIGIN")
+				return allowedOrigin == "*" || r.Header.Get("Origin") == allowedOrigin
+			},
+		},
+	})
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{})
+	srv.SetQueryCache(lru.New(1000))
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.AutomaticPersistedQuery{
+		Cache: lru.New(100),
+	})
 	requestHandler := services.ServiceRouter{
 		DB:     database,
 		Logger: logger,
@@ -97,6 +175,10 @@ func main() {
 	router.Handle("/query", srv)
 	router.HandleFunc("/oauth", http.HandlerFunc(requestHandler.OAuth))
 	router.HandleFunc("/pstn", http.HandlerFunc(requestHandler.PSTN))
+	router.HandleFunc("/ics/{passphrase}", http.HandlerFunc(requestHandler.Calendar)).Methods("GET")
+	router.HandleFunc("/recording", http.HandlerFunc(requestHandler.RecordingWebhook)).Methods("POST")
+	router.HandleFunc("/v1/tokens/rtc", requestHandler.RequireAPIKey(models.APIKeyScopeRtcTokens, requestHandler.RtcToken)).Methods("POST")
+	router.HandleFunc("/v1/tokens/rtm", requestHandler.RequireAPIKey(models.APIKeyScopeRtmTokens, requestHandler.RtmToken)).Methods("POST")
 
 	router.Use(hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
 		logger.Info().
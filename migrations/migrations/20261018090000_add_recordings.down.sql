@@ -0,0 +1 @@
+DROP TABLE recordings;
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS recordings (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    channel_id INT NOT NULL,
+    started_by INT,
+    uid INT NOT NULL,
+    sid TEXT NOT NULL,
+    rid TEXT NOT NULL,
+    file_prefix TEXT NOT NULL,
+    status TEXT NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    stopped_at TIMESTAMP WITH TIME ZONE,
+    files JSONB,
+    CONSTRAINT recordings_channel_fkey FOREIGN KEY (channel_id) REFERENCES channels (id) ON DELETE CASCADE,
+    CONSTRAINT recordings_user_fkey FOREIGN KEY (started_by) REFERENCES users (id) ON DELETE SET NULL
+);CREATE INDEX IF NOT EXISTS recordings_channel_idx ON recordings (channel_id);CREATE UNIQUE INDEX IF NOT EXISTS recordings_sid_idx ON recordings (sid);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE recordings DROP COLUMN IF EXISTS uploaded_at;
\ No newline at end of file
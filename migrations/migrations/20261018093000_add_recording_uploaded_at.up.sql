@@ -0,0 +1 @@
+ALTER TABLE recordings ADD COLUMN IF NOT EXISTS uploaded_at TIMESTAMP WITH TIME ZONE;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE recordings ADD COLUMN IF NOT EXISTS profile TEXT NOT NULL DEFAULT 'default';
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE recordings DROP COLUMN IF EXISTS mode;ALTER TABLE channels DROP COLUMN IF EXISTS recording_mode;
\ No newline at end of file
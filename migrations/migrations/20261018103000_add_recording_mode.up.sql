@@ -0,0 +1 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS recording_mode TEXT;ALTER TABLE recordings ADD COLUMN IF NOT EXISTS mode TEXT NOT NULL DEFAULT 'mix';
\ No newline at end of file
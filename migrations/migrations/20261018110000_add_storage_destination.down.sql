@@ -0,0 +1 @@
+ALTER TABLE recordings DROP COLUMN IF EXISTS storage_destination;ALTER TABLE channels DROP COLUMN IF EXISTS storage_destination;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS storage_destination TEXT;ALTER TABLE recordings ADD COLUMN IF NOT EXISTS storage_destination TEXT NOT NULL DEFAULT 'default';
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE recordings DROP COLUMN IF EXISTS kind;ALTER TABLE channels DROP COLUMN IF EXISTS snapshot_rid;ALTER TABLE channels DROP COLUMN IF EXISTS snapshot_sid;ALTER TABLE channels DROP COLUMN IF EXISTS snapshot_uid;
\ No newline at end of file
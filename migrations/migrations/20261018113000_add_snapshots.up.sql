@@ -0,0 +1 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS snapshot_uid INT;ALTER TABLE channels ADD COLUMN IF NOT EXISTS snapshot_sid TEXT;ALTER TABLE channels ADD COLUMN IF NOT EXISTS snapshot_rid TEXT;ALTER TABLE recordings ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'recording';
\ No newline at end of file
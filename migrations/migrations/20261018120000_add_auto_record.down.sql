@@ -0,0 +1 @@
+ALTER TABLE channels DROP COLUMN IF EXISTS auto_record_claimed_at;ALTER TABLE channels DROP COLUMN IF EXISTS auto_record;
\ No newline at end of file
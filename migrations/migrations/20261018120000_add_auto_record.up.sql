@@ -0,0 +1 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS auto_record BOOLEAN NOT NULL DEFAULT FALSE;ALTER TABLE channels ADD COLUMN IF NOT EXISTS auto_record_claimed_at TIMESTAMP WITH TIME ZONE;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS recordings_expires_idx;ALTER TABLE recordings DROP COLUMN IF EXISTS deleted_at;ALTER TABLE recordings DROP COLUMN IF EXISTS expires_at;ALTER TABLE channels DROP COLUMN IF EXISTS retention_days;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS retention_days INT;ALTER TABLE recordings ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;ALTER TABLE recordings ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;CREATE INDEX IF NOT EXISTS recordings_expires_idx ON recordings (expires_at) WHERE deleted_at IS NULL;
\ No newline at end of file
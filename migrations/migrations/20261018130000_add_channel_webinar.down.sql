@@ -0,0 +1 @@
+ALTER TABLE channels DROP COLUMN IF EXISTS webinar;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS webinar BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS channel_uids;
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS channel_uids (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    channel_id INT NOT NULL,
+    uid INT NOT NULL,
+    kind TEXT NOT NULL,
+    issued_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    CONSTRAINT channel_uids_channel_fkey FOREIGN KEY (channel_id) REFERENCES channels (id) ON DELETE CASCADE
+);CREATE INDEX IF NOT EXISTS channel_uids_channel_uid_idx ON channel_uids (channel_id, uid);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS channel_uids_channel_uid_key;CREATE INDEX IF NOT EXISTS channel_uids_channel_uid_idx ON channel_uids (channel_id, uid);
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM channel_uids a USING channel_uids b WHERE a.channel_id = b.channel_id AND a.uid = b.uid AND a.id < b.id;DROP INDEX IF EXISTS channel_uids_channel_uid_idx;CREATE UNIQUE INDEX IF NOT EXISTS channel_uids_channel_uid_key ON channel_uids (channel_id, uid);
\ No newline at end of file
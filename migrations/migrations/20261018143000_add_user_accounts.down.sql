@@ -0,0 +1 @@
+ALTER TABLE channel_uids DROP COLUMN IF EXISTS account;ALTER TABLE channels DROP COLUMN IF EXISTS user_accounts;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS user_accounts BOOLEAN NOT NULL DEFAULT false;ALTER TABLE channel_uids ADD COLUMN IF NOT EXISTS account VARCHAR(255);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE channels DROP COLUMN IF EXISTS ended_at;ALTER TABLE channels DROP COLUMN IF EXISTS expires_at;
\ No newline at end of file
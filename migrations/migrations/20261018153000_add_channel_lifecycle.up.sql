@@ -0,0 +1 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;ALTER TABLE channels ADD COLUMN IF NOT EXISTS ended_at TIMESTAMP WITH TIME ZONE;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS channels_owner_idx;ALTER TABLE channels DROP CONSTRAINT IF EXISTS channels_owner_fkey;ALTER TABLE channels DROP COLUMN IF EXISTS owner_id;
\ No newline at end of file
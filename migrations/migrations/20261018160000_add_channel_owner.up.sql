@@ -0,0 +1 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS owner_id INT;ALTER TABLE channels ADD CONSTRAINT channels_owner_fkey FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE SET NULL;CREATE INDEX IF NOT EXISTS channels_owner_idx ON channels (owner_id, id);
\ No newline at end of file
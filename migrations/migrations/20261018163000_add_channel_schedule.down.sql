@@ -0,0 +1 @@
+ALTER TABLE channels DROP COLUMN IF EXISTS recurrence;ALTER TABLE channels DROP COLUMN IF EXISTS timezone;ALTER TABLE channels DROP COLUMN IF EXISTS duration;ALTER TABLE channels DROP COLUMN IF EXISTS start_time;
\ No newline at end of file
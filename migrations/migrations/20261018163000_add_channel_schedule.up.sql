@@ -0,0 +1 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS start_time TIMESTAMP WITH TIME ZONE;ALTER TABLE channels ADD COLUMN IF NOT EXISTS duration INT;ALTER TABLE channels ADD COLUMN IF NOT EXISTS timezone TEXT;ALTER TABLE channels ADD COLUMN IF NOT EXISTS recurrence TEXT;
\ No newline at end of file
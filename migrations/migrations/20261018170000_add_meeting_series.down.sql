@@ -0,0 +1 @@
+DROP INDEX IF EXISTS channels_series_start_key;ALTER TABLE channels DROP CONSTRAINT IF EXISTS channels_series_fkey;ALTER TABLE channels DROP COLUMN IF EXISTS series_id;DROP TABLE IF EXISTS meeting_series;
\ No newline at end of file
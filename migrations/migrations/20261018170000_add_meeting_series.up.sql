@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS meeting_series (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    owner_id INT,
+    title TEXT NOT NULL,
+    host_passphrase TEXT NOT NULL UNIQUE,
+    viewer_passphrase TEXT NOT NULL UNIQUE,
+    dtmf TEXT NOT NULL UNIQUE,
+    storage_destination TEXT,
+    auto_record BOOLEAN NOT NULL DEFAULT FALSE,
+    retention_days INT,
+    webinar BOOLEAN NOT NULL DEFAULT FALSE,
+    user_accounts BOOLEAN NOT NULL DEFAULT FALSE,
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    duration INT NOT NULL,
+    timezone TEXT NOT NULL,
+    recurrence TEXT NOT NULL,
+    CONSTRAINT meeting_series_owner_fkey FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE SET NULL
+);ALTER TABLE channels ADD COLUMN IF NOT EXISTS series_id INT;ALTER TABLE channels ADD CONSTRAINT channels_series_fkey FOREIGN KEY (series_id) REFERENCES meeting_series (id) ON DELETE CASCADE;CREATE UNIQUE INDEX IF NOT EXISTS channels_series_start_key ON channels (series_id, start_time);
\ No newline at end of file
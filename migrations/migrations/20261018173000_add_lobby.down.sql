@@ -0,0 +1 @@
+DROP TABLE IF EXISTS lobby_tickets;ALTER TABLE meeting_series DROP COLUMN IF EXISTS lobby;ALTER TABLE channels DROP COLUMN IF EXISTS lobby;
\ No newline at end of file
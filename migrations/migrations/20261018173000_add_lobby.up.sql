@@ -0,0 +1,11 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS lobby BOOLEAN NOT NULL DEFAULT FALSE;ALTER TABLE meeting_series ADD COLUMN IF NOT EXISTS lobby BOOLEAN NOT NULL DEFAULT FALSE;CREATE TABLE IF NOT EXISTS lobby_tickets (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    channel_id INT NOT NULL,
+    ticket_hash VARCHAR(64) NOT NULL UNIQUE,
+    display_name TEXT NOT NULL,
+    status TEXT NOT NULL,
+    requested_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    decided_at TIMESTAMP WITH TIME ZONE,
+    redeemed_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT lobby_tickets_channel_fkey FOREIGN KEY (channel_id) REFERENCES channels (id) ON DELETE CASCADE
+);CREATE INDEX IF NOT EXISTS lobby_tickets_channel_idx ON lobby_tickets (channel_id, id);
\ No newline at end of file
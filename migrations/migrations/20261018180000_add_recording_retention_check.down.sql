@@ -0,0 +1 @@
+DROP INDEX IF EXISTS recordings_retention_idx;CREATE INDEX IF NOT EXISTS recordings_expires_idx ON recordings (expires_at) WHERE deleted_at IS NULL;ALTER TABLE recordings DROP COLUMN IF EXISTS retention_skip_reason;ALTER TABLE recordings DROP COLUMN IF EXISTS retention_checked_at;
\ No newline at end of file
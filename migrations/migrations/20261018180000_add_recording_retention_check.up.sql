@@ -0,0 +1 @@
+ALTER TABLE recordings ADD COLUMN IF NOT EXISTS retention_checked_at TIMESTAMP WITH TIME ZONE;ALTER TABLE recordings ADD COLUMN IF NOT EXISTS retention_skip_reason TEXT;DROP INDEX IF EXISTS recordings_expires_idx;CREATE INDEX IF NOT EXISTS recordings_retention_idx ON recordings (retention_checked_at NULLS FIRST, expires_at) WHERE deleted_at IS NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE channel_uids DROP COLUMN IF EXISTS renewal_hash;
\ No newline at end of file
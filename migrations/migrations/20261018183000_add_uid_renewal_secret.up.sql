@@ -0,0 +1 @@
+ALTER TABLE channel_uids ADD COLUMN IF NOT EXISTS renewal_hash VARCHAR(64);
\ No newline at end of file
@@ -0,0 +1,111 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+const renewCredentialsQuery = `query($passphrase: String!, $uid: Int!, $renewalSecret: String!) {
+	renewCredentials(passphrase: $passphrase, uid: $uid, renewalSecret: $renewalSecret) { uid rtc renewalSecret }
+}`
+
+type renewCredentialsResponse struct {
+	RenewCredentials struct {
+		UID           int
+		Rtc           string
+		RenewalSecret string
+	}
+}
+
+// expectChannelUID expects the channel of the host passphrase to be looked up, followed by the reserved UID
+func expectChannelUID(mock sqlmock.Sqlmock, kind string, renewalHash driver.Value) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1")).WithArgs("host-passphrase").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "channel_name", "channel_secret", "host_passphrase", "viewer_passphrase", "webinar", "expires_at", "ended_at"}).
+			AddRow(7, "Standup", "standup", "secret", "host-passphrase", "viewer-passphrase", false, nil, nil))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM channel_uids WHERE channel_id = $1 AND uid = $2")).WithArgs(7, 42).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "channel_id", "uid", "kind", "account", "renewal_hash", "issued_at", "expires_at"}).
+			AddRow(1, 7, 42, kind, nil, renewalHash, time.Now(), time.Now().Add(time.Hour)))
+}
+
+func newCredentialsTest(t *testing.T) (*client.Client, sqlmock.Sqlmock) {
+	t.Helper()
+
+	utils.SetDefaults()
+	viper.Set("APP_ID", "970CA35de60c44645bbae8a215061b33")
+	viper.Set("APP_CERTIFICATE", "5CFd2fd1755d40ecb72977518be15d3b")
+
+	resolver, mock := newTestResolver(t)
+	return newTestClient(resolver), mock
+}
+
+func TestRenewCredentials(t *testing.T) {
+	c, mock := newCredentialsTest(t)
+
+	secret, err := utils.GenerateRenewalSecret()
+	if err != nil {
+		t.Fatalf("Could not generate renewal secret: %v", err)
+	}
+
+	expectChannelUID(mock, models.UIDKindMain, utils.HashRenewalSecret(secret))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE channel_uids SET expires_at = $1 WHERE id = $2")).WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var response renewCredentialsResponse
+	err = c.Post(renewCredentialsQuery, &response, client.Var("passphrase", "host-passphrase"), client.Var("uid", 42), client.Var("renewalSecret", secret))
+	if err != nil {
+		t.Fatalf("renewCredentials failed: %v", err)
+	}
+
+	if response.RenewCredentials.UID != 42 || response.RenewCredentials.Rtc == "" {
+		t.Errorf("renewCredentials returned %+v", response.RenewCredentials)
+	}
+
+	if response.RenewCredentials.RenewalSecret != secret {
+		t.Errorf("Renewal secret is %q, want the secret the credentials were renewed with", response.RenewCredentials.RenewalSecret)
+	}
+}
+
+func TestRenewCredentialsRejectsWrongSecret(t *testing.T) {
+	c, mock := newCredentialsTest(t)
+
+	expectChannelUID(mock, models.UIDKindMain, utils.HashRenewalSecret("issued-secret"))
+
+	var response renewCredentialsResponse
+	err := c.Post(renewCredentialsQuery, &response, client.Var("passphrase", "host-passphrase"), client.Var("uid", 42), client.Var("renewalSecret", "guessed-secret"))
+	if err == nil {
+		t.Fatal("Credentials were renewed with the wrong renewal secret")
+	}
+}
+
+func TestRenewCredentialsRejectsServiceUIDs(t *testing.T) {
+	for _, kind := range []string{models.UIDKindRecording, models.UIDKindPSTN} {
+		t.Run(kind, func(t *testing.T) {
+			c, mock := newCredentialsTest(t)
+
+			expectChannelUID(mock, kind, nil)
+
+			var response renewCredentialsResponse
+			err := c.Post(renewCredentialsQuery, &response, client.Var("passphrase", "host-passphrase"), client.Var("uid", 42), client.Var("renewalSecret", ""))
+			if err == nil {
+				t.Fatalf("Credentials of a %s UID were renewed", kind)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/spf13/viper"
+)
+
+const joinChannelQuery = `query($passphrase: String!) {
+	joinChannel(passphrase: $passphrase) { channel isHost }
+}`
+
+type joinChannelResponse struct {
+	JoinChannel struct {
+		Channel string
+		IsHost  bool
+	}
+}
+
+// expectScheduledChannel expects the viewer passphrase of a channel scheduled at the start time to be looked up
+func expectScheduledChannel(mock sqlmock.Sqlmock, startTime time.Time) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM meeting_series WHERE host_passphrase = $1 OR viewer_passphrase = $1")).WithArgs("viewer-passphrase").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1")).WithArgs("viewer-passphrase").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "channel_name", "channel_secret", "host_passphrase", "viewer_passphrase", "recording_sid", "storage_destination", "auto_record", "retention_days", "webinar", "user_accounts", "expires_at", "ended_at", "start_time", "lobby"}).
+			AddRow(7, "Standup", "standup", "secret", "host-passphrase", "viewer-passphrase", nil, nil, false, nil, false, false, nil, nil, startTime, false))
+}
+
+func TestJoinChannelEarlyJoinWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		startsIn time.Duration
+		joins    bool
+	}{
+		{name: "before the window", startsIn: 30 * time.Minute, joins: false},
+		{name: "inside the window", startsIn: 5 * time.Minute, joins: true},
+		{name: "after the start", startsIn: -30 * time.Minute, joins: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, mock := newCredentialsTest(t)
+			viper.Set("EARLY_JOIN_MINUTES", 10)
+
+			expectScheduledChannel(mock, time.Now().Add(test.startsIn))
+			if test.joins {
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO channel_uids")).WithArgs(7, sqlmock.AnyArg(), models.UIDKindMain, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO channel_uids")).WithArgs(7, sqlmock.AnyArg(), models.UIDKindScreenShare, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+			}
+
+			var response joinChannelResponse
+			err := c.Post(joinChannelQuery, &response, client.Var("passphrase", "viewer-passphrase"))
+			if !test.joins {
+				if err == nil || !strings.Contains(err.Error(), models.ChannelErrorNotStarted) {
+					t.Fatalf("Joining %s returned %v, want %s", test.name, err, models.ChannelErrorNotStarted)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Joining %s failed: %v", test.name, err)
+			}
+
+			if response.JoinChannel.Channel != "standup" || response.JoinChannel.IsHost {
+				t.Errorf("joinChannel returned %+v", response.JoinChannel)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+const exchangeLobbyTicketMutation = `mutation($ticket: String!) {
+	exchangeLobbyTicket(ticket: $ticket) {
+		channel
+		mainUser { uid }
+		screenShare { uid }
+	}
+}`
+
+type exchangeLobbyTicketResponse struct {
+	ExchangeLobbyTicket struct {
+		Channel  string
+		MainUser struct {
+			UID int
+		}
+		ScreenShare struct {
+			UID int
+		}
+	}
+}
+
+const testLobbyTicket = "lobby-ticket"
+
+func lobbyTicketRows(status models.LobbyStatus, redeemedAt driver.Value) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "channel_id", "ticket_hash", "display_name", "status", "requested_at", "decided_at", "redeemed_at"}).
+		AddRow(3, 7, utils.HashLobbyTicket(testLobbyTicket), "Guest", string(status), time.Now(), time.Now(), redeemedAt)
+}
+
+func expectLobbyTicket(mock sqlmock.Sqlmock, status models.LobbyStatus, redeemedAt driver.Value) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM lobby_tickets WHERE ticket_hash = $1")).WithArgs(utils.HashLobbyTicket(testLobbyTicket)).WillReturnRows(lobbyTicketRows(status, redeemedAt))
+}
+
+func expectLobbyChannel(mock sqlmock.Sqlmock, endedAt driver.Value) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM channels WHERE id = $1")).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "channel_name", "channel_secret", "webinar", "user_accounts", "expires_at", "ended_at"}).
+			AddRow(7, "Standup", "standup", "secret", false, false, nil, endedAt))
+}
+
+func expectRedeem(mock sqlmock.Sqlmock) *sqlmock.ExpectedQuery {
+	mock.ExpectBegin()
+	return mock.ExpectQuery(regexp.QuoteMeta("UPDATE lobby_tickets SET redeemed_at = CURRENT_TIMESTAMP")).WithArgs(utils.HashLobbyTicket(testLobbyTicket), models.LobbyStatusAdmitted)
+}
+
+func TestExchangeLobbyTicket(t *testing.T) {
+	c, mock := newCredentialsTest(t)
+
+	expectLobbyTicket(mock, models.LobbyStatusAdmitted, nil)
+	expectLobbyChannel(mock, nil)
+	expectRedeem(mock).WillReturnRows(lobbyTicketRows(models.LobbyStatusAdmitted, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO channel_uids")).WithArgs(7, sqlmock.AnyArg(), models.UIDKindMain, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO channel_uids")).WithArgs(7, sqlmock.AnyArg(), models.UIDKindScreenShare, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectCommit()
+
+	var response exchangeLobbyTicketResponse
+	err := c.Post(exchangeLobbyTicketMutation, &response, client.Var("ticket", testLobbyTicket))
+	if err != nil {
+		t.Fatalf("exchangeLobbyTicket failed: %v", err)
+	}
+
+	if response.ExchangeLobbyTicket.Channel != "standup" || response.ExchangeLobbyTicket.MainUser.UID == 0 || response.ExchangeLobbyTicket.ScreenShare.UID == 0 {
+		t.Errorf("exchangeLobbyTicket returned %+v", response.ExchangeLobbyTicket)
+	}
+}
+
+func TestExchangeLobbyTicketKeepsTicketOfClosedChannel(t *testing.T) {
+	c, mock := newCredentialsTest(t)
+
+	// The ticket must not be redeemed, which the mock database would reject as an unexpected query
+	expectLobbyTicket(mock, models.LobbyStatusAdmitted, nil)
+	expectLobbyChannel(mock, time.Now().Add(-time.Minute))
+
+	var response exchangeLobbyTicketResponse
+	err := c.Post(exchangeLobbyTicketMutation, &response, client.Var("ticket", testLobbyTicket))
+	if err == nil {
+		t.Fatal("Exchanged a lobby ticket of a closed channel")
+	}
+}
+
+func TestExchangeLobbyTicketKeepsTicketWhenReservationFails(t *testing.T) {
+	c, mock := newCredentialsTest(t)
+
+	expectLobbyTicket(mock, models.LobbyStatusAdmitted, nil)
+	expectLobbyChannel(mock, nil)
+	expectRedeem(mock).WillReturnRows(lobbyTicketRows(models.LobbyStatusAdmitted, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO channel_uids")).WillReturnError(errors.New("Connection reset"))
+	mock.ExpectRollback()
+
+	var response exchangeLobbyTicketResponse
+	err := c.Post(exchangeLobbyTicketMutation, &response, client.Var("ticket", testLobbyTicket))
+	if err == nil {
+		t.Fatal("Exchanged a lobby ticket without reserving UIDs")
+	}
+}
+
+func TestExchangeLobbyTicketRejectsUndecidedTickets(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		status     models.LobbyStatus
+		redeemedAt driver.Value
+	}{
+		{name: "pending", status: models.LobbyStatusPending},
+		{name: "denied", status: models.LobbyStatusDenied},
+		{name: "redeemed", status: models.LobbyStatusAdmitted, redeemedAt: time.Now()},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c, mock := newCredentialsTest(t)
+
+			expectLobbyTicket(mock, test.status, test.redeemedAt)
+
+			var response exchangeLobbyTicketResponse
+			err := c.Post(exchangeLobbyTicketMutation, &response, client.Var("ticket", testLobbyTicket))
+			if err == nil {
+				t.Fatalf("Exchanged a %s lobby ticket", test.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/samyak-jain/agora_backend/services"
+)
+
+const createChannelMutation = `mutation($backendURL: String!) {
+	createChannel(title: "Standup", backendURL: $backendURL, enablePSTN: true) {
+		passphrase { host view }
+		channel
+		pstn { number dtmf }
+	}
+}`
+
+type createChannelResponse struct {
+	CreateChannel struct {
+		Passphrase struct {
+			Host string
+			View string
+		}
+		Channel string
+		Pstn    struct {
+			Number string
+			Dtmf   string
+		}
+	}
+}
+
+const mutePSTNMutation = `mutation($uid: Int!, $passphrase: String!, $mute: Boolean) {
+	mutePSTN(uid: $uid, passphrase: $passphrase, mute: $mute) { uid mute }
+}`
+
+type mutePSTNResponse struct {
+	MutePSTN struct {
+		UID  int
+		Mute bool
+	}
+}
+
+// createPSTNChannel creates a channel with PSTN enabled through the createChannel mutation
+// and checks the values that were stored for it
+func createPSTNChannel(t *testing.T, c *client.Client, mock sqlmock.Sqlmock, pstn *services.FakePSTN) createChannelResponse {
+	t.Helper()
+
+	var hostPassphrase, viewerPassphrase, dtmf capturedArg
+	args := anyArgs(18)
+	args[3] = &hostPassphrase
+	args[4] = &viewerPassphrase
+	args[5] = &dtmf
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO channels")).WithArgs(args...).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	var response createChannelResponse
+	err := c.Post(createChannelMutation, &response, client.Var("backendURL", "https://backend.example.com/"))
+	if err != nil {
+		t.Fatalf("createChannel failed: %v", err)
+	}
+
+	created := response.CreateChannel
+	if created.Passphrase.Host != hostPassphrase.String() || created.Passphrase.View != viewerPassphrase.String() {
+		t.Errorf("Returned passphrases %+v do not match the stored ones", created.Passphrase)
+	}
+
+	if created.Pstn.Dtmf == "" || created.Pstn.Dtmf != dtmf.String() {
+		t.Errorf("Returned DTMF %q does not match the stored DTMF %q", created.Pstn.Dtmf, dtmf.String())
+	}
+
+	bridge, ok := pstn.Bridges[created.Pstn.Dtmf]
+	if !ok {
+		t.Fatalf("No bridge was created for DTMF %q", created.Pstn.Dtmf)
+	}
+
+	if bridge.BackendURL != "https://backend.example.com" {
+		t.Errorf("Bridge backend URL is %q, want the URL without the trailing slash", bridge.BackendURL)
+	}
+
+	return response
+}
+
+func expectChannelByPassphrase(mock sqlmock.Sqlmock, passphrase string, created createChannelResponse) {
+	rows := sqlmock.NewRows([]string{"title", "channel_name", "channel_secret", "host_passphrase", "viewer_passphrase", "dtmf"}).
+		AddRow("Standup", created.CreateChannel.Channel, "secret", created.CreateChannel.Passphrase.Host, created.CreateChannel.Passphrase.View, created.CreateChannel.Pstn.Dtmf)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1")).WithArgs(passphrase).WillReturnRows(rows)
+}
+
+func TestCreateChannelCreatesPSTNBridge(t *testing.T) {
+	resolver, mock := newTestResolver(t)
+	pstn := services.NewFakePSTN()
+	resolver.PSTN = pstn
+
+	created := createPSTNChannel(t, newTestClient(resolver), mock, pstn)
+
+	if created.CreateChannel.Pstn.Number == "" {
+		t.Error("createChannel did not return the PSTN number")
+	}
+
+	if len(pstn.Bridges) != 1 {
+		t.Errorf("Created %d bridges, want 1", len(pstn.Bridges))
+	}
+}
+
+func TestMutePSTN(t *testing.T) {
+	resolver, mock := newTestResolver(t)
+	pstn := services.NewFakePSTN()
+	resolver.PSTN = pstn
+	c := newTestClient(resolver)
+
+	created := createPSTNChannel(t, c, mock, pstn)
+	dtmf := created.CreateChannel.Pstn.Dtmf
+	host := created.CreateChannel.Passphrase.Host
+
+	callID, err := pstn.Dial(dtmf, 42)
+	if err != nil {
+		t.Fatalf("Could not dial into the bridge: %v", err)
+	}
+
+	otherCallID, err := pstn.Dial(dtmf, 43)
+	if err != nil {
+		t.Fatalf("Could not dial into the bridge: %v", err)
+	}
+
+	expectChannelByPassphrase(mock, host, created)
+
+	var response mutePSTNResponse
+	err = c.Post(mutePSTNMutation, &response, client.Var("uid", 42), client.Var("passphrase", host), client.Var("mute", true))
+	if err != nil {
+		t.Fatalf("mutePSTN failed: %v", err)
+	}
+
+	if response.MutePSTN.UID != 42 || !response.MutePSTN.Mute {
+		t.Errorf("mutePSTN returned %+v", response.MutePSTN)
+	}
+
+	if !pstn.IsMuted(dtmf, callID) {
+		t.Error("Call was not muted")
+	}
+
+	if pstn.IsMuted(dtmf, otherCallID) {
+		t.Error("Another call on the bridge was muted")
+	}
+
+	expectChannelByPassphrase(mock, host, created)
+
+	err = c.Post(mutePSTNMutation, &response, client.Var("uid", 42), client.Var("passphrase", host), client.Var("mute", false))
+	if err != nil {
+		t.Fatalf("mutePSTN failed: %v", err)
+	}
+
+	if pstn.IsMuted(dtmf, callID) {
+		t.Error("Call was not unmuted")
+	}
+}
+
+func TestMutePSTNRejectsViewers(t *testing.T) {
+	resolver, mock := newTestResolver(t)
+	pstn := services.NewFakePSTN()
+	resolver.PSTN = pstn
+	c := newTestClient(resolver)
+
+	created := createPSTNChannel(t, c, mock, pstn)
+	dtmf := created.CreateChannel.Pstn.Dtmf
+	viewer := created.CreateChannel.Passphrase.View
+
+	callID, err := pstn.Dial(dtmf, 42)
+	if err != nil {
+		t.Fatalf("Could not dial into the bridge: %v", err)
+	}
+
+	expectChannelByPassphrase(mock, viewer, created)
+
+	var response mutePSTNResponse
+	err = c.Post(mutePSTNMutation, &response, client.Var("uid", 42), client.Var("passphrase", viewer))
+	if err == nil {
+		t.Fatal("Viewers were allowed to mute PSTN callers")
+	}
+
+	if pstn.IsMuted(dtmf, callID) {
+		t.Error("Call was muted through the viewer passphrase")
+	}
+}
+
+func TestMutePSTNUnknownCaller(t *testing.T) {
+	resolver, mock := newTestResolver(t)
+	pstn := services.NewFakePSTN()
+	resolver.PSTN = pstn
+	c := newTestClient(resolver)
+
+	created := createPSTNChannel(t, c, mock, pstn)
+	host := created.CreateChannel.Passphrase.Host
+
+	expectChannelByPassphrase(mock, host, created)
+
+	var response mutePSTNResponse
+	err := c.Post(mutePSTNMutation, &response, client.Var("uid", 42), client.Var("passphrase", host))
+	if err == nil {
+		t.Fatal("Muting a UID that is not on the bridge succeeded")
+	}
+}
+
+const shareQuery = `query($passphrase: String!) {
+	share(passphrase: $passphrase) {
+		passphrase { host view }
+		channel
+		pstn { dtmf }
+	}
+}`
+
+type shareQueryResponse struct {
+	Share struct {
+		Passphrase struct {
+			Host *string
+			View string
+		}
+		Channel string
+		Pstn    struct {
+			Dtmf string
+		}
+	}
+}
+
+func TestShareHidesChannelOfLobbyFromViewers(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		passphrase string
+		lobby      bool
+		channel    string
+	}{
+		{name: "host", passphrase: "host-passphrase", channel: "standup"},
+		{name: "viewer", passphrase: "viewer-passphrase", channel: "standup"},
+		{name: "host with lobby", passphrase: "host-passphrase", lobby: true, channel: "standup"},
+		{name: "viewer with lobby", passphrase: "viewer-passphrase", lobby: true, channel: ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resolver, mock := newTestResolver(t)
+
+			rows := sqlmock.NewRows([]string{"title", "channel_name", "channel_secret", "host_passphrase", "viewer_passphrase", "dtmf", "expires_at", "ended_at", "lobby"}).
+				AddRow("Standup", "standup", "secret", "host-passphrase", "viewer-passphrase", "123456", nil, nil, test.lobby)
+			mock.ExpectQuery(regexp.QuoteMeta("FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1")).WithArgs(test.passphrase).WillReturnRows(rows)
+
+			var response shareQueryResponse
+			err := newTestClient(resolver).Post(shareQuery, &response, client.Var("passphrase", test.passphrase))
+			if err != nil {
+				t.Fatalf("share failed: %v", err)
+			}
+
+			if response.Share.Channel != test.channel {
+				t.Errorf("share returned channel %q, want %q", response.Share.Channel, test.channel)
+			}
+
+			host := test.passphrase == "host-passphrase"
+			if (response.Share.Passphrase.Host != nil) != host {
+				t.Errorf("share returned host passphrase %v to host %v", response.Share.Passphrase.Host, host)
+			}
+
+			if response.Share.Passphrase.View != "viewer-passphrase" || response.Share.Pstn.Dtmf != "123456" {
+				t.Errorf("share returned %+v", response.Share)
+			}
+		})
+	}
+}
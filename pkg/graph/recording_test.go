@@ -0,0 +1,640 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/samyak-jain/agora_backend/utils/recordingtest"
+	"github.com/spf13/viper"
+)
+
+// recordingTest runs the recording resolvers against a mock database and the fake Cloud Recording server
+type recordingTest struct {
+	t        *testing.T
+	resolver *Resolver
+	mock     sqlmock.Sqlmock
+	server   *recordingtest.Server
+	client   *client.Client
+	channel  models.Channel
+}
+
+func newRecordingTest(t *testing.T) *recordingTest {
+	t.Helper()
+
+	utils.SetDefaults()
+	viper.Set("APP_ID", "970CA35de60c44645bbae8a215061b33")
+	viper.Set("APP_CERTIFICATE", "5CFd2fd1755d40ecb72977518be15d3b")
+
+	resolver, mock := newTestResolver(t)
+
+	server := recordingtest.NewServer()
+	t.Cleanup(server.Close)
+
+	profiles, err := utils.LoadRecordingProfiles()
+	if err != nil {
+		t.Fatalf("Could not load recording profiles: %v", err)
+	}
+
+	filePrefix, err := utils.LoadFilePrefixTemplate()
+	if err != nil {
+		t.Fatalf("Could not load file prefix template: %v", err)
+	}
+
+	resolver.Recording = server.Client()
+	snapshots, err := utils.LoadSnapshotSettings()
+	if err != nil {
+		t.Fatalf("Could not load snapshot settings: %v", err)
+	}
+
+	resolver.RecordingProfiles = profiles
+	resolver.FilePrefix = filePrefix
+	resolver.Snapshots = snapshots
+	resolver.Storage = map[string]utils.StorageDestination{
+		utils.DefaultStorageDestination: {
+			Vendor:    utils.StorageVendorAWS,
+			Bucket:    "recordings",
+			AccessKey: "access",
+			SecretKey: "secret",
+		},
+	}
+
+	return &recordingTest{
+		t:        t,
+		resolver: resolver,
+		mock:     mock,
+		server:   server,
+		client:   newTestClient(resolver),
+		channel: models.Channel{
+			ID:               7,
+			Title:            "Standup",
+			ChannelName:      "standupchannel",
+			ChannelSecret:    "channelsecret",
+			HostPassphrase:   "host-passphrase",
+			ViewerPassphrase: "viewer-passphrase",
+		},
+	}
+}
+
+// startSession starts a recording of the channel directly on the fake server and stores it on the channel
+func (rt *recordingTest) startSession(mode string) recordingtest.Session {
+	rt.t.Helper()
+
+	ctx := context.Background()
+	recorder := &utils.Recorder{
+		Client:  rt.resolver.Recording,
+		Mode:    mode,
+		Channel: rt.channel.ChannelName,
+		UID:     900001,
+		Token:   "token",
+		Logger:  rt.resolver.Logger,
+	}
+
+	err := recorder.Acquire(ctx)
+	if err != nil {
+		rt.t.Fatalf("Could not acquire a recording resource: %v", err)
+	}
+
+	profile := rt.resolver.RecordingProfiles[utils.DefaultRecordingProfile]
+	storage := rt.resolver.Storage[utils.DefaultStorageDestination]
+	err = recorder.Start(ctx, []string{"standup"}, nil, &profile, nil, &storage)
+	if err != nil {
+		rt.t.Fatalf("Could not start recording: %v", err)
+	}
+
+	rt.channel.RecordingUID = sql.NullInt32{Int32: recorder.UID, Valid: true}
+	rt.channel.RecordingRID = sql.NullString{String: recorder.RID, Valid: true}
+	rt.channel.RecordingSID = sql.NullString{String: recorder.SID, Valid: true}
+	rt.channel.RecordingMode = sql.NullString{String: mode, Valid: true}
+
+	session, _ := rt.server.Session(recorder.SID)
+	return session
+}
+
+// expectHostChannel expects the channel to be fetched by passphrase through hostChannel
+func (rt *recordingTest) expectHostChannel(passphrase string) {
+	channel := rt.channel
+	rows := sqlmock.NewRows([]string{"id", "title", "channel_name", "channel_secret", "host_passphrase", "viewer_passphrase", "recording_uid", "recording_sid", "recording_rid", "recording_mode", "storage_destination", "snapshot_uid", "snapshot_sid", "snapshot_rid", "retention_days", "expires_at", "ended_at"}).
+		AddRow(channel.ID, channel.Title, channel.ChannelName, channel.ChannelSecret, channel.HostPassphrase, channel.ViewerPassphrase, nullValue(channel.RecordingUID), nullValue(channel.RecordingSID), nullValue(channel.RecordingRID), nullValue(channel.RecordingMode), nullValue(channel.StorageDestination), nullValue(channel.SnapshotUID), nullValue(channel.SnapshotSID), nullValue(channel.SnapshotRID), nullValue(channel.RetentionDays), nullValue(channel.ExpiresAt), nullValue(channel.EndedAt))
+	rt.mock.ExpectQuery(regexp.QuoteMeta("FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1")).WithArgs(passphrase).WillReturnRows(rows)
+}
+
+// expectLockedHostChannel expects the channel to be fetched through lockedHostChannel by the host
+func (rt *recordingTest) expectLockedHostChannel() {
+	rt.expectHostChannel(rt.channel.HostPassphrase)
+	rt.mock.ExpectBegin()
+	rt.mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1, $2)")).WithArgs(1, rt.channel.ID).WillReturnResult(sqlmock.NewResult(0, 0))
+	rt.expectHostChannel(rt.channel.HostPassphrase)
+}
+
+// expectUnlock expects the recording lock taken by lockedHostChannel to be released
+func (rt *recordingTest) expectUnlock() {
+	rt.mock.ExpectRollback()
+}
+
+// expectEndRecording expects the recording with the sid to be marked as ended
+func (rt *recordingTest) expectEndRecording(sid string) {
+	rt.mock.ExpectBegin()
+	rt.mock.ExpectExec(regexp.QuoteMeta("UPDATE recordings SET status")).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sid).WillReturnResult(sqlmock.NewResult(0, 1))
+	rt.mock.ExpectExec(regexp.QuoteMeta("UPDATE channels SET recording_sid = NULL")).WithArgs(sid).WillReturnResult(sqlmock.NewResult(0, 1))
+	rt.mock.ExpectExec(regexp.QuoteMeta("UPDATE channels SET snapshot_sid = NULL")).WithArgs(sid).WillReturnResult(sqlmock.NewResult(0, 0))
+	rt.mock.ExpectCommit()
+}
+
+// nullValue converts a nullable column to the value returned by the database
+func nullValue(value driver.Valuer) driver.Value {
+	converted, _ := value.Value()
+	return converted
+}
+
+// transcoding decodes the clientRequest of a request made to the updateLayout endpoint
+func transcoding(t *testing.T, request json.RawMessage) utils.UpdateLayoutClientRequest {
+	t.Helper()
+
+	var update utils.UpdateRecordRequest
+	err := json.Unmarshal(request, &update)
+	if err != nil {
+		t.Fatalf("Could not decode layout update: %v", err)
+	}
+
+	return update.ClientRequest
+}
+
+const setRecordingLayoutMutation = `mutation($passphrase: String!, $layout: RecordingLayout!) {
+	setRecordingLayout(passphrase: $passphrase, layout: $layout)
+}`
+
+func TestSetRecordingLayout(t *testing.T) {
+	rt := newRecordingTest(t)
+	session := rt.startSession(utils.RecordingModeMix)
+
+	rt.expectLockedHostChannel()
+	rt.mock.ExpectQuery(regexp.QuoteMeta("SELECT profile FROM recordings WHERE sid = $1")).WithArgs(session.SID).WillReturnRows(sqlmock.NewRows([]string{"profile"}).AddRow(utils.DefaultRecordingProfile))
+	rt.expectUnlock()
+
+	layout := map[string]interface{}{
+		"regions": []map[string]interface{}{
+			{"uid": 1, "x": 0, "y": 0, "width": 640, "height": 720},
+			{"uid": 2, "x": 640, "y": 0, "width": 640, "height": 720, "renderMode": "FIT"},
+		},
+		"backgroundColor": "#FFFFFF",
+	}
+
+	var response struct {
+		SetRecordingLayout string
+	}
+	err := rt.client.Post(setRecordingLayoutMutation, &response, client.Var("passphrase", rt.channel.HostPassphrase), client.Var("layout", layout))
+	if err != nil {
+		t.Fatalf("setRecordingLayout failed: %v", err)
+	}
+
+	session, _ = rt.server.Session(session.SID)
+	if len(session.Updates) != 0 {
+		t.Errorf("Layout was sent to the update endpoint: %s", session.Updates)
+	}
+
+	if len(session.LayoutUpdates) != 1 {
+		t.Fatalf("Got %d layout updates, want 1", len(session.LayoutUpdates))
+	}
+
+	config := transcoding(t, session.LayoutUpdates[0])
+	if config.MixedVideoLayout != utils.MixedVideoLayoutCustom || config.BackgroundColor != "#FFFFFF" {
+		t.Errorf("Unexpected layout %+v", config)
+	}
+
+	if len(config.LayoutConfig) != 2 {
+		t.Fatalf("Got %d regions, want 2", len(config.LayoutConfig))
+	}
+
+	region := config.LayoutConfig[1]
+	if region.UID != "2" || region.XAxis != 0.5 || region.Width != 0.5 || region.Height != 1 || region.RenderMode != utils.RenderModeFit {
+		t.Errorf("Unexpected region %+v", region)
+	}
+}
+
+func TestSetRecordingLayoutRequiresHost(t *testing.T) {
+	rt := newRecordingTest(t)
+	session := rt.startSession(utils.RecordingModeMix)
+
+	rt.expectHostChannel(rt.channel.ViewerPassphrase)
+
+	layout := map[string]interface{}{
+		"regions": []map[string]interface{}{
+			{"uid": 1, "x": 0, "y": 0, "width": 640, "height": 720},
+		},
+	}
+
+	var response struct {
+		SetRecordingLayout string
+	}
+	err := rt.client.Post(setRecordingLayoutMutation, &response, client.Var("passphrase", rt.channel.ViewerPassphrase), client.Var("layout", layout))
+	if err == nil {
+		t.Fatal("Viewers were allowed to change the recording layout")
+	}
+
+	session, _ = rt.server.Session(session.SID)
+	if len(session.LayoutUpdates) != 0 {
+		t.Errorf("Layout was changed through the viewer passphrase")
+	}
+}
+
+func TestStartRecordingSession(t *testing.T) {
+	rt := newRecordingTest(t)
+
+	var uid, sid, rid capturedArg
+	rt.expectLockedHostChannel()
+	rt.mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO channel_uids")).WithArgs(rt.channel.ID, &uid, models.UIDKindRecording, sqlmock.AnyArg(), nil, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	rt.mock.ExpectBegin()
+	rt.mock.ExpectExec(regexp.QuoteMeta("UPDATE channels SET (recording_uid, recording_sid, recording_rid, recording_mode)")).WithArgs(sqlmock.AnyArg(), &sid, &rid, utils.RecordingModeMix, rt.channel.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	rt.mock.ExpectExec(regexp.QuoteMeta("INSERT INTO recordings")).WithArgs(anyArgs(12)...).WillReturnResult(sqlmock.NewResult(1, 1))
+	rt.mock.ExpectCommit()
+	rt.expectUnlock()
+
+	var response struct {
+		StartRecordingSession string
+	}
+	err := rt.client.Post(`mutation($passphrase: String!) { startRecordingSession(passphrase: $passphrase) }`, &response, client.Var("passphrase", rt.channel.HostPassphrase))
+	if err != nil {
+		t.Fatalf("startRecordingSession failed: %v", err)
+	}
+
+	sessions := rt.server.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("Started %d recordings, want 1", len(sessions))
+	}
+
+	session := sessions[0]
+	if session.SID != sid.String() || session.ResourceID != rid.String() {
+		t.Errorf("Stored sid %q and rid %q, want %q and %q", sid.String(), rid.String(), session.SID, session.ResourceID)
+	}
+
+	reservedUID, _ := uid.value.(int64)
+	if session.Mode != utils.RecordingModeMix || session.Cname != rt.channel.ChannelName || session.UID != strconv.FormatInt(reservedUID, 10) {
+		t.Errorf("Unexpected recording %+v of reserved UID %d", session, reservedUID)
+	}
+
+	request := session.Start.ClientRequest
+	if request.Token == "" || request.StorageConfig.Bucket != "recordings" || request.RecordingConfig.TranscodingConfig == nil {
+		t.Errorf("Unexpected start request %+v", request)
+	}
+}
+
+func TestStartRecordingSessionAlreadyRecording(t *testing.T) {
+	rt := newRecordingTest(t)
+	rt.startSession(utils.RecordingModeMix)
+
+	rt.expectLockedHostChannel()
+	rt.expectUnlock()
+
+	var response struct {
+		StartRecordingSession string
+	}
+	err := rt.client.Post(`mutation($passphrase: String!) { startRecordingSession(passphrase: $passphrase) }`, &response, client.Var("passphrase", rt.channel.HostPassphrase))
+	if err == nil {
+		t.Fatal("A second recording of the channel was started")
+	}
+
+	if len(rt.server.Sessions()) != 1 {
+		t.Errorf("Got %d recordings, want 1", len(rt.server.Sessions()))
+	}
+}
+
+func TestStartRecordingSessionStopsSessionThatIsNotStored(t *testing.T) {
+	rt := newRecordingTest(t)
+
+	rt.expectLockedHostChannel()
+	rt.mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO channel_uids")).WithArgs(rt.channel.ID, sqlmock.AnyArg(), models.UIDKindRecording, sqlmock.AnyArg(), nil, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	rt.mock.ExpectBegin()
+	rt.mock.ExpectExec(regexp.QuoteMeta("UPDATE channels SET (recording_uid, recording_sid, recording_rid, recording_mode)")).WithArgs(anyArgs(5)...).WillReturnResult(sqlmock.NewResult(0, 1))
+	rt.mock.ExpectExec(regexp.QuoteMeta("INSERT INTO recordings")).WithArgs(anyArgs(12)...).WillReturnError(errors.New("Connection reset"))
+	rt.mock.ExpectRollback()
+	rt.expectUnlock()
+
+	var response struct {
+		StartRecordingSession string
+	}
+	err := rt.client.Post(`mutation($passphrase: String!) { startRecordingSession(passphrase: $passphrase) }`, &response, client.Var("passphrase", rt.channel.HostPassphrase))
+	if err == nil {
+		t.Fatal("startRecordingSession succeeded without storing the recording")
+	}
+
+	sessions := rt.server.Sessions()
+	if len(sessions) != 1 || !sessions[0].Stopped {
+		t.Errorf("Got recordings %+v, want the recording that was not stored to be stopped", sessions)
+	}
+}
+
+func TestStartSnapshotSession(t *testing.T) {
+	rt := newRecordingTest(t)
+
+	var sid, rid capturedArg
+	var kind, mode, profile capturedArg
+	rt.expectLockedHostChannel()
+	rt.mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO channel_uids")).WithArgs(rt.channel.ID, sqlmock.AnyArg(), models.UIDKindRecording, sqlmock.AnyArg(), nil, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	rt.mock.ExpectBegin()
+	rt.mock.ExpectExec(regexp.QuoteMeta("UPDATE channels SET (snapshot_uid, snapshot_sid, snapshot_rid)")).WithArgs(sqlmock.AnyArg(), &sid, &rid, rt.channel.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	rt.mock.ExpectExec(regexp.QuoteMeta("INSERT INTO recordings")).WithArgs(rt.channel.ID, nil, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), &profile, &mode, &kind, utils.DefaultStorageDestination, string(models.RecordingStateRecording), nil).WillReturnResult(sqlmock.NewResult(1, 1))
+	rt.mock.ExpectCommit()
+	rt.expectUnlock()
+
+	var response struct {
+		StartSnapshotSession string
+	}
+	err := rt.client.Post(`mutation($passphrase: String!) { startSnapshotSession(passphrase: $passphrase) }`, &response, client.Var("passphrase", rt.channel.HostPassphrase))
+	if err != nil {
+		t.Fatalf("startSnapshotSession failed: %v", err)
+	}
+
+	sessions := rt.server.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("Started %d sessions, want 1", len(sessions))
+	}
+
+	session := sessions[0]
+	if session.SID != sid.String() || session.ResourceID != rid.String() || session.Mode != utils.RecordingModeIndividual {
+		t.Errorf("Stored sid %q and rid %q of session %+v", sid.String(), rid.String(), session)
+	}
+
+	if session.Start.ClientRequest.SnapshotConfig == nil {
+		t.Errorf("Unexpected start request %+v", session.Start.ClientRequest)
+	}
+
+	if kind.String() != models.RecordingKindSnapshot || mode.String() != utils.RecordingModeIndividual || profile.String() != utils.DefaultRecordingProfile {
+		t.Errorf("Stored a %q session in %q mode with profile %q", kind.String(), mode.String(), profile.String())
+	}
+}
+
+func TestSetPresenterAndNormal(t *testing.T) {
+	rt := newRecordingTest(t)
+	session := rt.startSession(utils.RecordingModeMix)
+
+	rt.expectLockedHostChannel()
+	rt.expectUnlock()
+
+	var presenter struct {
+		SetPresenter int
+	}
+	err := rt.client.Post(`mutation($passphrase: String!) { setPresenter(uid: 42, passphrase: $passphrase) }`, &presenter, client.Var("passphrase", rt.channel.HostPassphrase))
+	if err != nil {
+		t.Fatalf("setPresenter failed: %v", err)
+	}
+
+	if presenter.SetPresenter != 42 {
+		t.Errorf("setPresenter returned %d, want 42", presenter.SetPresenter)
+	}
+
+	rt.expectLockedHostChannel()
+	rt.expectUnlock()
+
+	var normal struct {
+		SetNormal string
+	}
+	err = rt.client.Post(`mutation($passphrase: String!) { setNormal(passphrase: $passphrase) }`, &normal, client.Var("passphrase", rt.channel.HostPassphrase))
+	if err != nil {
+		t.Fatalf("setNormal failed: %v", err)
+	}
+
+	session, _ = rt.server.Session(session.SID)
+	if len(session.LayoutUpdates) != 2 {
+		t.Fatalf("Got %d layout updates, want 2", len(session.LayoutUpdates))
+	}
+
+	config := transcoding(t, session.LayoutUpdates[0])
+	if config.MixedVideoLayout != 2 || config.MaxResolutionUID != "42" {
+		t.Errorf("setPresenter sent layout %+v", config)
+	}
+
+	config = transcoding(t, session.LayoutUpdates[1])
+	if config.MixedVideoLayout != 1 || config.MaxResolutionUID != "" {
+		t.Errorf("setNormal sent layout %+v", config)
+	}
+}
+
+func TestSetPresenterRequiresHost(t *testing.T) {
+	rt := newRecordingTest(t)
+	session := rt.startSession(utils.RecordingModeMix)
+
+	rt.expectHostChannel(rt.channel.ViewerPassphrase)
+
+	var response struct {
+		SetPresenter int
+	}
+	err := rt.client.Post(`mutation($passphrase: String!) { setPresenter(uid: 42, passphrase: $passphrase) }`, &response, client.Var("passphrase", rt.channel.ViewerPassphrase))
+	if err == nil {
+		t.Fatal("Viewers were allowed to change the presenter")
+	}
+
+	session, _ = rt.server.Session(session.SID)
+	if len(session.LayoutUpdates) != 0 {
+		t.Error("Layout was changed through the viewer passphrase")
+	}
+}
+
+func TestSetPresenterEndedRecording(t *testing.T) {
+	rt := newRecordingTest(t)
+	session := rt.startSession(utils.RecordingModeMix)
+	rt.server.EndSession(session.SID)
+
+	// The stale session is cleared before the recording lock is released
+	rt.expectLockedHostChannel()
+	rt.expectEndRecording(session.SID)
+	rt.expectUnlock()
+
+	var response struct {
+		SetPresenter int
+	}
+	err := rt.client.Post(`mutation($passphrase: String!) { setPresenter(uid: 42, passphrase: $passphrase) }`, &response, client.Var("passphrase", rt.channel.HostPassphrase))
+	if err == nil {
+		t.Fatal("setPresenter succeeded for a recording that has ended")
+	}
+}
+
+func TestStopRecordingSession(t *testing.T) {
+	rt := newRecordingTest(t)
+	session := rt.startSession(utils.RecordingModeMix)
+
+	rt.expectLockedHostChannel()
+	rt.expectEndRecording(session.SID)
+	rt.expectUnlock()
+
+	var response struct {
+		StopRecordingSession string
+	}
+	err := rt.client.Post(`mutation($passphrase: String!) { stopRecordingSession(passphrase: $passphrase) }`, &response, client.Var("passphrase", rt.channel.HostPassphrase))
+	if err != nil {
+		t.Fatalf("stopRecordingSession failed: %v", err)
+	}
+
+	session, _ = rt.server.Session(session.SID)
+	if !session.Stopped {
+		t.Error("Recording was not stopped")
+	}
+}
+
+func TestStopRecordingSessionNotStarted(t *testing.T) {
+	rt := newRecordingTest(t)
+
+	rt.expectLockedHostChannel()
+	rt.expectUnlock()
+
+	var response struct {
+		StopRecordingSession string
+	}
+	err := rt.client.Post(`mutation($passphrase: String!) { stopRecordingSession(passphrase: $passphrase) }`, &response, client.Var("passphrase", rt.channel.HostPassphrase))
+	if err == nil {
+		t.Fatal("stopRecordingSession succeeded without a recording")
+	}
+}
+
+// expectHostJoin expects a host to join the auto recorded channel, which has not been recorded yet
+func (rt *recordingTest) expectHostJoin() {
+	channel := rt.channel
+	rt.mock.ExpectQuery(regexp.QuoteMeta("FROM meeting_series WHERE host_passphrase = $1 OR viewer_passphrase = $1")).WithArgs(channel.HostPassphrase).WillReturnError(sql.ErrNoRows)
+	rt.mock.ExpectQuery(regexp.QuoteMeta("FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1")).WithArgs(channel.HostPassphrase).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "channel_name", "channel_secret", "host_passphrase", "viewer_passphrase", "recording_sid", "storage_destination", "auto_record", "retention_days", "webinar", "user_accounts", "expires_at", "ended_at", "start_time", "lobby"}).
+			AddRow(channel.ID, channel.Title, channel.ChannelName, channel.ChannelSecret, channel.HostPassphrase, channel.ViewerPassphrase, nil, nil, true, nil, false, false, nil, nil, nil, false))
+	rt.mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO channel_uids")).WithArgs(channel.ID, sqlmock.AnyArg(), models.UIDKindMain, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	rt.mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO channel_uids")).WithArgs(channel.ID, sqlmock.AnyArg(), models.UIDKindScreenShare, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+}
+
+// expectAutoRecordClaim expects the channel to be claimed for auto recording, which fails if another host claimed it
+func (rt *recordingTest) expectAutoRecordClaim(claimed bool) {
+	var rowsAffected int64
+	if claimed {
+		rowsAffected = 1
+	}
+
+	rt.mock.ExpectExec(regexp.QuoteMeta("UPDATE channels SET auto_record_claimed_at = CURRENT_TIMESTAMP")).WithArgs(rt.channel.ID).WillReturnResult(sqlmock.NewResult(0, rowsAffected))
+}
+
+// joinAsHost joins the channel with the host passphrase.
+// Auto recording runs in the background, so the queries of both are matched in any order.
+func (rt *recordingTest) joinAsHost() {
+	rt.t.Helper()
+
+	rt.mock.MatchExpectationsInOrder(false)
+
+	var response joinChannelResponse
+	err := rt.client.Post(joinChannelQuery, &response, client.Var("passphrase", rt.channel.HostPassphrase))
+	if err != nil {
+		rt.t.Fatalf("joinChannel failed: %v", err)
+	}
+
+	if response.JoinChannel.Channel != rt.channel.ChannelName || !response.JoinChannel.IsHost {
+		rt.t.Errorf("joinChannel returned %+v", response.JoinChannel)
+	}
+}
+
+// waitForExpectations waits until auto recording has made all the expected queries
+func (rt *recordingTest) waitForExpectations() {
+	rt.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := rt.mock.ExpectationsWereMet()
+		if err == nil {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			rt.t.Fatal(err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJoinChannelAutoRecordsOnce(t *testing.T) {
+	rt := newRecordingTest(t)
+
+	rt.expectHostJoin()
+	rt.expectAutoRecordClaim(true)
+	rt.mock.ExpectBegin()
+	rt.mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1, $2)")).WithArgs(1, rt.channel.ID).WillReturnResult(sqlmock.NewResult(0, 0))
+	rt.mock.ExpectQuery(regexp.QuoteMeta("SELECT recording_sid, ended_at FROM channels WHERE id = $1")).WithArgs(rt.channel.ID).WillReturnRows(sqlmock.NewRows([]string{"recording_sid", "ended_at"}).AddRow(nil, nil))
+	rt.mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO channel_uids")).WithArgs(rt.channel.ID, sqlmock.AnyArg(), models.UIDKindRecording, sqlmock.AnyArg(), nil, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	rt.mock.ExpectBegin()
+	rt.mock.ExpectExec(regexp.QuoteMeta("UPDATE channels SET (recording_uid, recording_sid, recording_rid, recording_mode)")).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), utils.RecordingModeMix, rt.channel.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	rt.mock.ExpectExec(regexp.QuoteMeta("INSERT INTO recordings")).WithArgs(anyArgs(12)...).WillReturnResult(sqlmock.NewResult(1, 1))
+	rt.mock.ExpectCommit()
+	rt.expectUnlock()
+
+	rt.joinAsHost()
+	rt.waitForExpectations()
+
+	if len(rt.server.Sessions()) != 1 {
+		t.Fatalf("First host join started %d recordings, want 1", len(rt.server.Sessions()))
+	}
+
+	// The second host read the channel before the recording was stored, but the claim is already taken
+	rt.expectHostJoin()
+	rt.expectAutoRecordClaim(false)
+
+	rt.joinAsHost()
+	rt.waitForExpectations()
+
+	if len(rt.server.Sessions()) != 1 {
+		t.Errorf("Second host join left %d recordings, want 1", len(rt.server.Sessions()))
+	}
+}
+
+func TestJoinChannelReleasesAutoRecordClaimWhenStartFails(t *testing.T) {
+	rt := newRecordingTest(t)
+	rt.resolver.Storage = nil
+
+	rt.expectHostJoin()
+	rt.expectAutoRecordClaim(true)
+	rt.mock.ExpectBegin()
+	rt.mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1, $2)")).WithArgs(1, rt.channel.ID).WillReturnResult(sqlmock.NewResult(0, 0))
+	rt.mock.ExpectQuery(regexp.QuoteMeta("SELECT recording_sid, ended_at FROM channels WHERE id = $1")).WithArgs(rt.channel.ID).WillReturnRows(sqlmock.NewRows([]string{"recording_sid", "ended_at"}).AddRow(nil, nil))
+	rt.expectUnlock()
+	rt.mock.ExpectExec(regexp.QuoteMeta("UPDATE channels SET auto_record_claimed_at = NULL WHERE id = $1")).WithArgs(rt.channel.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rt.joinAsHost()
+	rt.waitForExpectations()
+
+	if len(rt.server.Sessions()) != 0 {
+		t.Errorf("Started %d recordings without a storage destination", len(rt.server.Sessions()))
+	}
+}
+
+func TestJoinChannelDoesNotWaitForAutoRecording(t *testing.T) {
+	rt := newRecordingTest(t)
+	viper.Set("AUTO_RECORD_TIMEOUT", 1)
+
+	// The recording lock is held elsewhere until auto recording times out and releases the claim
+	rt.expectHostJoin()
+	rt.expectAutoRecordClaim(true)
+	rt.mock.ExpectBegin()
+	rt.mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1, $2)")).WithArgs(1, rt.channel.ID).WillDelayFor(time.Minute).WillReturnResult(sqlmock.NewResult(0, 0))
+	rt.expectUnlock()
+	rt.mock.ExpectExec(regexp.QuoteMeta("UPDATE channels SET auto_record_claimed_at = NULL WHERE id = $1")).WithArgs(rt.channel.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	started := time.Now()
+	rt.joinAsHost()
+	if elapsed := time.Since(started); elapsed >= time.Second {
+		t.Errorf("joinChannel took %s while auto recording was waiting for the lock", elapsed)
+	}
+
+	rt.waitForExpectations()
+}
@@ -13,8 +13,23 @@ package graph
 //go:generate go run github.com/99designs/gqlgen
 
 import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/middleware"
 	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/services"
 	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/samyak-jain/agora_backend/utils/rtctoken"
+	"github.com/spf13/viper"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 // This file will not be regenerated automatically.
@@ -23,6 +38,1131 @@ import (
 
 // Resolver is used for state management
 type Resolver struct {
-	DB     *models.Database
-	Logger *utils.Logger
+	DB                *models.Database
+	Logger            *utils.Logger
+	PSTN              services.PSTNProvider
+	Recording         utils.RecordingClient
+	RecordingProfiles map[string]utils.RecordingProfile
+	FilePrefix        *utils.FilePrefixTemplate
+	Storage           map[string]utils.StorageDestination
+	Snapshots         *utils.SnapshotSettings
+	Lobby             *services.LobbyBroker
+}
+
+// hostChannel fetches the channel of the passphrase and checks that it is the host passphrase
+func (r *Resolver) hostChannel(passphrase string) (*models.Channel, error) {
+	var channelData models.Channel
+
+	if passphrase == "" {
+		return nil, errors.New("Passphrase cannot be empty")
+	}
+
+	err := r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase, recording_uid, recording_sid, recording_rid, recording_mode, storage_destination, snapshot_uid, snapshot_sid, snapshot_rid, retention_days, expires_at, ended_at FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1 ORDER BY id DESC LIMIT 1", passphrase)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
+		return nil, errors.New("Invalid URL")
+	}
+
+	if passphrase != channelData.HostPassphrase {
+		r.Logger.Debug().Str("passphrase", passphrase).Str("channel", channelData.ChannelName).Msg("Unauthorized to record channel")
+		return nil, errors.New("Unauthorised to record channel")
+	}
+
+	return &channelData, nil
+}
+
+// lockedHostChannel fetches the channel of a host passphrase while holding the recording lock of the channel,
+// so that its recording state cannot change until the returned function is called
+func (r *Resolver) lockedHostChannel(ctx context.Context, passphrase string) (*models.Channel, func(), error) {
+	channelData, err := r.hostChannel(passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unlock, err := r.DB.LockRecording(ctx, channelData.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channelData.ID).Msg("Could not lock channel recording")
+		return nil, nil, errInternalServer
+	}
+
+	// The recording state may have changed while waiting for the lock
+	lockedID := channelData.ID
+	channelData, err = r.hostChannel(passphrase)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+
+	// A new occurrence of a meeting series was opened while waiting for the lock
+	if channelData.ID != lockedID {
+		unlock()
+		return r.lockedHostChannel(ctx, passphrase)
+	}
+
+	return channelData, unlock, nil
+}
+
+// sessionStarter sends the start request of a recording or snapshot session with the acquired recorder
+type sessionStarter func(ctx context.Context, recorder *utils.Recorder, fileNamePrefix []string, storage *utils.StorageDestination) error
+
+// startRecording acquires a resource and starts recording the channel.
+// The caller must hold the recording lock of the channel. The returned errors can be shown to the user.
+func (r *Resolver) startRecording(ctx context.Context, channelData *models.Channel, authUser *models.UserAccount, secret *string, profileName string, recordingProfile *utils.RecordingProfile, recordingMode string, subscription *utils.Subscription) error {
+	return r.startSession(ctx, channelData, authUser, models.RecordingKindRecording, recordingMode, profileName, func(ctx context.Context, recorder *utils.Recorder, fileNamePrefix []string, storage *utils.StorageDestination) error {
+		return recorder.Start(ctx, fileNamePrefix, secret, recordingProfile, subscription, storage)
+	})
+}
+
+// startSession acquires a resource, starts a recording or snapshot session of the channel with the starter
+// and stores it on the channel. A session that cannot be stored is stopped again.
+// The caller must hold the recording lock of the channel. The returned errors can be shown to the user.
+func (r *Resolver) startSession(ctx context.Context, channelData *models.Channel, authUser *models.UserAccount, kind string, mode string, profileName string, start sessionStarter) error {
+	if reason := channelData.ClosedReason(); reason != "" {
+		return channelClosedError(reason)
+	}
+
+	storageName := storageDestinationName(channelData)
+	storageDestination, err := r.storageDestination(storageName)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("storage", storageName).Str("channel", channelData.ChannelName).Msg("Storage destination not found")
+		return errors.New("Recording storage is not configured")
+	}
+
+	var hostName string
+	if authUser != nil && authUser.UserName.Valid {
+		hostName = authUser.UserName.String
+	}
+
+	sessionID, err := utils.GenerateUUID()
+	if err != nil {
+		r.Logger.Error().Err(err).Str("kind", kind).Msg("Session ID generation failed")
+		return errInternalServer
+	}
+
+	filePrefix := r.FilePrefix
+	if kind == models.RecordingKindSnapshot {
+		filePrefix = r.Snapshots.FilePrefix
+	}
+
+	fileNamePrefix, err := filePrefix.Build(utils.FilePrefixValues{
+		Channel:     channelData.ChannelName,
+		Title:       channelData.Title,
+		Host:        hostName,
+		RecordingID: strings.ReplaceAll(sessionID, "-", ""),
+		Time:        time.Now(),
+	})
+	if err != nil {
+		r.Logger.Error().Err(err).Str("template", filePrefix.Template).Msg("Could not build file name prefix")
+		return errInternalServer
+	}
+
+	recorder := &utils.Recorder{
+		Client:  r.Recording,
+		Mode:    mode,
+		Channel: channelData.ChannelName,
+		Logger:  r.Logger,
+	}
+
+	err = r.reserveRecorder(recorder, channelData.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("kind", kind).Str("channel", channelData.ChannelName).Msg("Could not reserve recording UID")
+		return errInternalServer
+	}
+
+	err = recorder.Acquire(ctx)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("kind", kind).Msg("Acquire Failed")
+		return errInternalServer
+	}
+
+	err = start(ctx, recorder, fileNamePrefix, storageDestination)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("kind", kind).Msg("Start Failed")
+		return errInternalServer
+	}
+
+	err = r.storeSession(channelData, authUser, recorder, kind, profileName, storageName, storageDestination)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("kind", kind).Str("sid", recorder.SID).Msg("Storing session failed, stopping it")
+
+		_, err = recorder.Stop(ctx)
+		if err != nil {
+			r.Logger.Error().Err(err).Str("kind", kind).Str("sid", recorder.SID).Msg("Could not stop session that was not stored")
+		}
+
+		return errInternalServer
+	}
+
+	return nil
+}
+
+// storeSession stores the started session on its channel and adds it to the recordings
+func (r *Resolver) storeSession(channelData *models.Channel, authUser *models.UserAccount, recorder *utils.Recorder, kind string, profileName string, storageName string, storageDestination *utils.StorageDestination) error {
+	channelQuery := "UPDATE channels SET (recording_uid, recording_sid, recording_rid, recording_mode) = (:recording_uid, :recording_sid, :recording_rid, :recording_mode) WHERE id = :id"
+	sessionDetails := models.Channel{
+		ID:            channelData.ID,
+		RecordingUID:  sql.NullInt32{Int32: recorder.UID, Valid: true},
+		RecordingRID:  sql.NullString{String: recorder.RID, Valid: true},
+		RecordingSID:  sql.NullString{String: recorder.SID, Valid: true},
+		RecordingMode: sql.NullString{String: recorder.Mode, Valid: true},
+	}
+
+	if kind == models.RecordingKindSnapshot {
+		channelQuery = "UPDATE channels SET (snapshot_uid, snapshot_sid, snapshot_rid) = (:snapshot_uid, :snapshot_sid, :snapshot_rid) WHERE id = :id"
+		sessionDetails = models.Channel{
+			ID:          channelData.ID,
+			SnapshotUID: sql.NullInt32{Int32: recorder.UID, Valid: true},
+			SnapshotRID: sql.NullString{String: recorder.RID, Valid: true},
+			SnapshotSID: sql.NullString{String: recorder.SID, Valid: true},
+		}
+	}
+
+	var startedBy sql.NullInt64
+	if authUser != nil {
+		startedBy = sql.NullInt64{Int64: authUser.ID, Valid: true}
+	}
+
+	session := models.RecordingSession{
+		ChannelID:          channelData.ID,
+		StartedBy:          startedBy,
+		UID:                recorder.UID,
+		SID:                recorder.SID,
+		RID:                recorder.RID,
+		FilePrefix:         strings.Join(recorder.FileNamePrefix, "/"),
+		Profile:            profileName,
+		Mode:               recorder.Mode,
+		Kind:               kind,
+		StorageDestination: storageName,
+		Status:             string(models.RecordingStateRecording),
+		ExpiresAt:          retentionExpiry(channelData, storageDestination, time.Now()),
+	}
+
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NamedExec(channelQuery, &sessionDetails)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.NamedExec("INSERT INTO recordings (channel_id, started_by, uid, sid, rid, file_prefix, profile, mode, kind, storage_destination, status, expires_at) VALUES (:channel_id, :started_by, :uid, :sid, :rid, :file_prefix, :profile, :mode, :kind, :storage_destination, :status, :expires_at)", &session)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// autoRecord starts recording a channel with auto recording enabled when a host joins it.
+// It runs in the background so that joining does not wait for Cloud Recording, with its own timeout.
+// The channel row is claimed before starting so that hosts joining at the same time
+// cannot start a second session while the first one is being started.
+func (r *Resolver) autoRecord(channelData models.Channel) {
+	result, err := r.DB.Exec("UPDATE channels SET auto_record_claimed_at = CURRENT_TIMESTAMP WHERE id = $1 AND auto_record AND recording_sid IS NULL AND ended_at IS NULL AND (auto_record_claimed_at IS NULL OR auto_record_claimed_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')", channelData.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channelData.ID).Msg("Could not claim channel for auto recording")
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channelData.ID).Msg("Could not get Rows Affected by UPDATE in database")
+		return
+	}
+
+	if rowsAffected < 1 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(viper.GetInt("AUTO_RECORD_TIMEOUT"))*time.Second)
+	defer cancel()
+
+	err = r.startAutoRecording(ctx, &channelData)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("channel", channelData.ChannelName).Msg("Auto recording failed")
+
+		_, err = r.DB.Exec("UPDATE channels SET auto_record_claimed_at = NULL WHERE id = $1", channelData.ID)
+		if err != nil {
+			r.Logger.Error().Err(err).Int64("channel", channelData.ID).Msg("Could not release auto recording claim")
+		}
+	}
+}
+
+// startAutoRecording starts recording the claimed channel with the default profile,
+// unless it was recorded or ended while waiting for the recording lock
+func (r *Resolver) startAutoRecording(ctx context.Context, channelData *models.Channel) error {
+	unlock, err := r.DB.LockRecording(ctx, channelData.ID)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	var current models.Channel
+	err = r.DB.Get(&current, "SELECT recording_sid, ended_at FROM channels WHERE id = $1", channelData.ID)
+	if err != nil {
+		return err
+	}
+
+	if current.RecordingSID.Valid || current.EndedAt.Valid {
+		return nil
+	}
+
+	var secret *string
+	if viper.GetBool("ENCRYPTION_ENABLED") {
+		secret = &channelData.ChannelSecret
+	}
+
+	profile := r.RecordingProfiles[utils.DefaultRecordingProfile]
+	err = r.startRecording(ctx, channelData, nil, secret, utils.DefaultRecordingProfile, &profile, utils.RecordingModeMix, nil)
+	if err != nil {
+		return err
+	}
+
+	r.Logger.Info().Str("channel", channelData.ChannelName).Msg("Auto recording started")
+	return nil
+}
+
+// existingRecorder creates a Recorder for the recording that is stored on the channel
+func (r *Resolver) existingRecorder(channelData *models.Channel) *utils.Recorder {
+	return &utils.Recorder{
+		Client:  r.Recording,
+		Mode:    channelData.RecordingMode.String,
+		Channel: channelData.ChannelName,
+		UID:     channelData.RecordingUID.Int32,
+		RID:     channelData.RecordingRID.String,
+		SID:     channelData.RecordingSID.String,
+		Logger:  r.Logger,
+	}
+}
+
+// existingSnapshotRecorder creates a Recorder for the snapshot session that is stored on the channel
+func (r *Resolver) existingSnapshotRecorder(channelData *models.Channel) *utils.Recorder {
+	return &utils.Recorder{
+		Client:  r.Recording,
+		Mode:    utils.RecordingModeIndividual,
+		Channel: channelData.ChannelName,
+		UID:     channelData.SnapshotUID.Int32,
+		RID:     channelData.SnapshotRID.String,
+		SID:     channelData.SnapshotSID.String,
+		Logger:  r.Logger,
+	}
+}
+
+// stopSessions stops the recording and snapshot sessions of the channel that are still running.
+// The caller must hold the recording lock of the channel.
+func (r *Resolver) stopSessions(ctx context.Context, channelData *models.Channel) error {
+	if channelData.RecordingSID.Valid && channelData.RecordingRID.Valid && channelData.RecordingUID.Valid {
+		result, err := r.existingRecorder(channelData).Stop(ctx)
+		if utils.IsRecordingNotFound(err) {
+			r.endRecording(channelData, models.RecordingStateStopped, nil)
+		} else if err != nil {
+			return err
+		} else {
+			files, err := result.ServerResponse.Files()
+			if err != nil {
+				r.Logger.Error().Err(err).Interface("response", result).Msg("Could not parse recording file list")
+			}
+
+			r.endRecording(channelData, models.RecordingStateStopped, files)
+		}
+	}
+
+	if channelData.SnapshotSID.Valid && channelData.SnapshotRID.Valid && channelData.SnapshotUID.Valid {
+		result, err := r.existingSnapshotRecorder(channelData).Stop(ctx)
+		if utils.IsRecordingNotFound(err) {
+			r.endSession(channelData.ID, channelData.SnapshotSID.String, models.RecordingStateStopped, nil)
+		} else if err != nil {
+			return err
+		} else {
+			files, err := result.ServerResponse.Files()
+			if err != nil {
+				r.Logger.Error().Err(err).Interface("response", result).Msg("Could not parse snapshot file list")
+			}
+
+			r.endSession(channelData.ID, channelData.SnapshotSID.String, models.RecordingStateStopped, files)
+		}
+	}
+
+	return nil
+}
+
+// Page sizes of paginated queries
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// cursorPrefix is prepended to the id of the last channel of a page before it is encoded as cursor
+const cursorPrefix = "channel:"
+
+// ownedChannel is a listed channel along with the state of its recording
+type ownedChannel struct {
+	models.Channel
+	RecordingStatus sql.NullString `db:"recording_status"`
+}
+
+// listChannels fetches the newest channels whose column equals key and that match all conditions.
+// The key is the first query argument, so the placeholders of the conditions start at $2.
+func (r *Resolver) listChannels(column string, key int64, conditions []string, args []interface{}, limit int) ([]ownedChannel, error) {
+	query := "SELECT channels.id, channels.created_at, channels.title, channels.channel_name, channels.host_passphrase, channels.viewer_passphrase, COALESCE(channels.dtmf, '') AS dtmf, channels.expires_at, channels.ended_at, channels.start_time, channels.duration, channels.timezone, channels.recurrence, channels.lobby, recordings.status AS recording_status FROM channels LEFT JOIN recordings ON recordings.sid = channels.recording_sid WHERE channels." + column + " = $1"
+	for _, condition := range conditions {
+		query += " AND " + condition
+	}
+	query += fmt.Sprintf(" ORDER BY channels.id DESC LIMIT %d", limit)
+
+	channels := []ownedChannel{}
+	err := r.DB.Select(&channels, query, append([]interface{}{key}, args...)...)
+	return channels, err
+}
+
+// channelPage validates the page size and turns the cursor into a condition of listChannels
+func (r *Resolver) channelPage(first *int, after *string) (int, []string, []interface{}, error) {
+	limit := defaultPageSize
+	if first != nil {
+		limit = *first
+	}
+
+	if limit < 1 || limit > maxPageSize {
+		return 0, nil, nil, fmt.Errorf("First must be between 1 and %d", maxPageSize)
+	}
+
+	conditions := []string{}
+	args := []interface{}{}
+	if after != nil {
+		afterID, err := decodeCursor(*after)
+		if err != nil {
+			r.Logger.Debug().Err(err).Str("after", *after).Msg("Invalid cursor")
+			return 0, nil, nil, errors.New("Invalid cursor")
+		}
+
+		args = append(args, afterID)
+		conditions = append(conditions, fmt.Sprintf("channels.id < $%d", len(args)+1))
+	}
+
+	return limit, conditions, args, nil
+}
+
+// meetingConnection returns a page of at most limit channels.
+// The channels should contain one more channel than the limit when there is a next page.
+func meetingConnection(channels []ownedChannel, limit int) *models.MeetingConnection {
+	connection := &models.MeetingConnection{
+		Edges: []*models.MeetingEdge{},
+		PageInfo: &models.PageInfo{
+			HasNextPage: len(channels) > limit,
+		},
+	}
+
+	for index := range channels {
+		if index == limit {
+			break
+		}
+
+		cursor := encodeCursor(channels[index].ID)
+		connection.Edges = append(connection.Edges, &models.MeetingEdge{
+			Cursor: cursor,
+			Node:   meeting(&channels[index]),
+		})
+		connection.PageInfo.EndCursor = &cursor
+	}
+
+	return connection
+}
+
+func encodeCursor(id int64) string {
+	return base64.StdEncoding.EncodeToString([]byte(cursorPrefix + strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	decoded, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	if !strings.HasPrefix(string(decoded), cursorPrefix) {
+		return 0, errors.New("Invalid cursor")
+	}
+
+	return strconv.ParseInt(strings.TrimPrefix(string(decoded), cursorPrefix), 10, 64)
+}
+
+// shareResponse returns the details needed to invite others to the channel.
+// The host passphrase is only shared with hosts. The channel name of channels with a lobby is left empty
+// for viewers, since it is enough to join the channel without being admitted.
+func shareResponse(channelData *models.Channel, host bool) *models.ShareResponse {
+	var hostPassphrase *string
+	if host {
+		hostPassphrase = &channelData.HostPassphrase
+	}
+
+	channelName := channelData.ChannelName
+	if !host && channelData.Lobby {
+		channelName = ""
+	}
+
+	pstnNumber := viper.GetString("PSTN_NUMBER")
+	if pstnNumber == "" {
+		pstnNumber = "(800) 309-2350"
+	}
+
+	var pstnResult *models.Pstn
+	if channelData.DTMF != "" {
+		pstnResult = &models.Pstn{
+			Number: pstnNumber,
+			Dtmf:   channelData.DTMF,
+		}
+	}
+
+	return &models.ShareResponse{
+		Passphrase: &models.Passphrase{
+			Host: hostPassphrase,
+			View: channelData.ViewerPassphrase,
+		},
+		Channel: channelName,
+		Title:   channelData.Title,
+		Pstn:    pstnResult,
+	}
+}
+
+// meeting converts a channel listed for its owner
+func meeting(channel *ownedChannel) *models.Meeting {
+	status := models.MeetingStatusActive
+	switch channel.ClosedReason() {
+	case models.ChannelErrorEnded:
+		status = models.MeetingStatusEnded
+	case models.ChannelErrorExpired:
+		status = models.MeetingStatusExpired
+	}
+
+	recordingState := models.RecordingStateInactive
+	if channel.RecordingStatus.Valid {
+		recordingState = models.RecordingState(channel.RecordingStatus.String)
+	}
+
+	return &models.Meeting{
+		ID:             int(channel.ID),
+		Title:          channel.Title,
+		Channel:        channel.ChannelName,
+		CreatedAt:      formatTime(channel.CreatedAt),
+		ExpiresAt:      formatNullTime(channel.ExpiresAt),
+		EndedAt:        formatNullTime(channel.EndedAt),
+		StartTime:      formatNullTime(channel.StartTime),
+		Duration:       nullInt(channel.Duration),
+		Timezone:       nullString(channel.Timezone),
+		Recurrence:     nullString(channel.Recurrence),
+		Lobby:          channel.Lobby,
+		Status:         status,
+		Share:          shareResponse(&channel.Channel, true),
+		RecordingState: recordingState,
+	}
+}
+
+// channelClosedError is returned for channels that can no longer be joined.
+// The error code lets clients tell an ended meeting apart from an expired one.
+func channelClosedError(reason string) error {
+	message := "Meeting has ended"
+	if reason == models.ChannelErrorExpired {
+		message = "Meeting has expired"
+	}
+
+	return &gqlerror.Error{
+		Message: message,
+		Extensions: map[string]interface{}{
+			"code": reason,
+		},
+	}
+}
+
+// channelStorage validates the name of the storage destination chosen for a new channel
+func (r *Resolver) channelStorage(storage *string) (sql.NullString, error) {
+	if storage == nil || *storage == "" {
+		return sql.NullString{}, nil
+	}
+
+	_, err := r.storageDestination(*storage)
+	if err != nil {
+		r.Logger.Debug().Err(err).Str("storage", *storage).Msg("Invalid storage destination")
+		return sql.NullString{}, errors.New("Invalid storage destination")
+	}
+
+	return sql.NullString{String: *storage, Valid: true}, nil
+}
+
+// channelRetention validates the number of days the recordings of a new channel are kept
+func (r *Resolver) channelRetention(retentionDays *int) (sql.NullInt32, error) {
+	if retentionDays == nil {
+		return sql.NullInt32{}, nil
+	}
+
+	if *retentionDays < 1 {
+		r.Logger.Debug().Int("retentionDays", *retentionDays).Msg("Invalid retention")
+		return sql.NullInt32{}, errors.New("Retention must be at least one day")
+	}
+
+	return sql.NullInt32{Int32: int32(*retentionDays), Valid: true}, nil
+}
+
+// createBridge creates the PSTN bridge that dials into the channel of the DTMF through the backend
+func (r *Resolver) createBridge(ctx context.Context, dtmf string, backendURL string) (*models.Pstn, error) {
+	if len(backendURL) <= 0 {
+		r.Logger.Error().Str("backend", backendURL).Msg("Backend URL is empty")
+		return nil, errors.New("Backend URL is empty")
+	}
+
+	// Remove trailing slash from URL
+	finalBackendURL := strings.TrimSuffix(backendURL, "/")
+
+	var pstnNumber string
+	if viper.GetString("PSTN_NUMBER") == "" {
+		pstnNumber = "(800) 309-2350"
+	} else {
+		pstnNumber = viper.GetString("PSTN_NUMBER")
+	}
+
+	err := r.PSTN.CreateBridge(ctx, dtmf, finalBackendURL)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("DTMF", dtmf).Msg("Could not create PSTN bridge")
+		return nil, errInternalServer
+	}
+
+	r.Logger.Info().Str("DTMF", dtmf).Msg("PSTN PIN")
+
+	return &models.Pstn{
+		Number: pstnNumber,
+		Dtmf:   dtmf,
+	}, nil
+}
+
+// openOccurrence creates the channel of the current occurrence when the passphrase belongs to a meeting series
+func (r *Resolver) openOccurrence(passphrase string) error {
+	series, err := r.DB.SeriesByPassphrase(passphrase)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+
+	if err != nil {
+		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Could not fetch meeting series")
+		return errInternalServer
+	}
+
+	err = utils.OpenCurrentOccurrence(r.DB, series)
+	if err == utils.ErrMeetingNotStarted {
+		r.Logger.Debug().Int64("series", series.ID).Msg("Meeting series has not started")
+		return notStartedError(series.StartTime)
+	}
+
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("series", series.ID).Msg("Could not open occurrence of meeting series")
+		return errInternalServer
+	}
+
+	return nil
+}
+
+// meetingSeries converts a meeting series, it is only returned to hosts
+func meetingSeries(series *models.MeetingSeriesRecord) *models.MeetingSeries {
+	return &models.MeetingSeries{
+		ID:         int(series.ID),
+		Title:      series.Title,
+		CreatedAt:  formatTime(series.CreatedAt),
+		StartTime:  formatTime(series.StartTime),
+		Duration:   series.Duration,
+		Timezone:   series.Timezone,
+		Recurrence: series.Recurrence,
+		Lobby:      series.Lobby,
+		Share: shareResponse(&models.Channel{
+			Title:            series.Title,
+			HostPassphrase:   series.HostPassphrase,
+			ViewerPassphrase: series.ViewerPassphrase,
+			DTMF:             series.DTMF,
+		}, true),
+	}
+}
+
+// joinSession issues the credentials of a user joining the channel, reserving their UIDs through reserver
+func (r *Resolver) joinSession(ctx context.Context, reserver models.UIDReserver, channelData *models.Channel, host bool, displayName string) (*models.Session, error) {
+	credentialType, role := credentialRole(channelData, host)
+
+	var mainAccount, screenShareAccount string
+	if channelData.UserAccounts {
+		authUser, _ := middleware.GetUserFromContext(ctx)
+
+		var err error
+		mainAccount, err = utils.UserAccountName(authUser, displayName)
+		if err != nil {
+			r.Logger.Error().Err(err).Msg("Could not generate user account")
+			return nil, errInternalServer
+		}
+
+		screenShareAccount = utils.ScreenShareAccountName(mainAccount)
+	}
+
+	mainUser, err := utils.ReserveUserCredentials(reserver, channelData.ID, channelData.ChannelName, models.UIDKindMain, mainAccount, true, credentialType, role)
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not generate main user credentials")
+		return nil, errInternalServer
+	}
+
+	screenShare, err := utils.ReserveUserCredentials(reserver, channelData.ID, channelData.ChannelName, models.UIDKindScreenShare, screenShareAccount, false, utils.CredentialScreenShare, role)
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not generate screenshare user credentails")
+		return nil, errInternalServer
+	}
+
+	return &models.Session{
+		Title:       channelData.Title,
+		Channel:     channelData.ChannelName,
+		IsHost:      host,
+		MainUser:    mainUser,
+		ScreenShare: screenShare,
+		Secret:      &channelData.ChannelSecret,
+	}, nil
+}
+
+// enterLobby puts a viewer in the lobby of the channel. Instead of credentials the viewer gets a ticket,
+// which can be exchanged for credentials once a host admits them.
+// The channel name is withheld as well, since it is enough to join channels without an App Certificate.
+func (r *Resolver) enterLobby(ctx context.Context, channelData *models.Channel, displayName string) (*models.Session, error) {
+	authUser, _ := middleware.GetUserFromContext(ctx)
+
+	ticket, err := utils.GenerateLobbyTicket()
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Lobby ticket generation failed")
+		return nil, errInternalServer
+	}
+
+	record, err := r.DB.CreateLobbyTicket(channelData.ID, utils.HashLobbyTicket(ticket), utils.LobbyDisplayName(authUser, displayName))
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channelData.ID).Msg("Could not add participant to the lobby")
+		return nil, errInternalServer
+	}
+
+	r.notifyLobby(record)
+
+	return &models.Session{
+		Title:  channelData.Title,
+		IsHost: false,
+		Lobby: &models.LobbyTicket{
+			Ticket: ticket,
+			Status: record.Status,
+		},
+	}, nil
+}
+
+// notifyLobby announces a changed lobby ticket to the subscriptions of every server.
+// The change has already been stored, so a failed notification is only logged.
+func (r *Resolver) notifyLobby(ticket *models.LobbyTicketRecord) {
+	err := r.DB.NotifyLobby(ticket.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("ticket", ticket.ID).Msg("Could not notify lobby change")
+	}
+}
+
+// decideLobby admits or denies a participant waiting in the lobby of the channel of the host passphrase
+func (r *Resolver) decideLobby(passphrase string, id int, status models.LobbyStatus) (*models.LobbyParticipant, error) {
+	channelData, err := r.hostChannel(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	ticket, err := r.DB.DecideLobbyTicket(channelData.ID, int64(id), status)
+	if err == sql.ErrNoRows {
+		r.Logger.Debug().Int("id", id).Int64("channel", channelData.ID).Msg("Participant is not waiting in the lobby")
+		return nil, errors.New("Participant is not waiting in the lobby")
+	}
+
+	if err != nil {
+		r.Logger.Error().Err(err).Int("id", id).Msg("Could not update lobby ticket")
+		return nil, errInternalServer
+	}
+
+	r.notifyLobby(ticket)
+
+	return lobbyParticipant(ticket), nil
+}
+
+// lobbyError explains why a lobby ticket cannot be exchanged for credentials
+func lobbyError(code string) error {
+	message := "Waiting for a host to admit you"
+	switch code {
+	case models.LobbyErrorDenied:
+		message = "A host denied your request to join"
+	case models.LobbyErrorRedeemed:
+		message = "Lobby ticket has already been used"
+	}
+
+	return &gqlerror.Error{
+		Message: message,
+		Extensions: map[string]interface{}{
+			"code": code,
+		},
+	}
+}
+
+// lobbyParticipant converts a lobby ticket for hosts
+func lobbyParticipant(ticket *models.LobbyTicketRecord) *models.LobbyParticipant {
+	return &models.LobbyParticipant{
+		ID:          int(ticket.ID),
+		DisplayName: ticket.DisplayName,
+		Status:      ticket.Status,
+		RequestedAt: formatTime(ticket.RequestedAt),
+		DecidedAt:   formatNullTime(ticket.DecidedAt),
+	}
+}
+
+// notStartedError is returned when a scheduled meeting is joined before its early join window opens
+func notStartedError(startTime time.Time) error {
+	return &gqlerror.Error{
+		Message: "Meeting has not started yet",
+		Extensions: map[string]interface{}{
+			"code":      models.ChannelErrorNotStarted,
+			"startTime": formatTime(startTime),
+		},
+	}
+}
+
+// scheduleChannel validates the schedule of a new channel and stores it on the channel.
+// The start time is a RFC 3339 timestamp, the duration is in minutes and the timezone is an IANA name.
+func (r *Resolver) scheduleChannel(channel *models.Channel, startTime *string, duration *int, timezone *string, recurrence *string) error {
+	if startTime == nil || *startTime == "" {
+		if duration != nil || (timezone != nil && *timezone != "") || (recurrence != nil && *recurrence != "") {
+			return errors.New("Start time is required to schedule a meeting")
+		}
+
+		return nil
+	}
+
+	start, err := time.Parse(time.RFC3339, *startTime)
+	if err != nil {
+		r.Logger.Debug().Err(err).Str("startTime", *startTime).Msg("Invalid start time")
+		return errors.New("Start time must be a RFC 3339 timestamp")
+	}
+
+	channel.StartTime = sql.NullTime{Time: start, Valid: true}
+
+	if duration != nil {
+		if *duration < 1 {
+			r.Logger.Debug().Int("duration", *duration).Msg("Invalid duration")
+			return errors.New("Duration must be at least one minute")
+		}
+
+		channel.Duration = sql.NullInt32{Int32: int32(*duration), Valid: true}
+	}
+
+	if timezone != nil && *timezone != "" {
+		_, err := time.LoadLocation(*timezone)
+		if err != nil {
+			r.Logger.Debug().Err(err).Str("timezone", *timezone).Msg("Invalid timezone")
+			return errors.New("Unknown timezone")
+		}
+
+		channel.Timezone = sql.NullString{String: *timezone, Valid: true}
+	}
+
+	if recurrence != nil && *recurrence != "" {
+		rule, err := utils.ParseRecurrenceRule(*recurrence)
+		if err != nil {
+			r.Logger.Debug().Err(err).Str("recurrence", *recurrence).Msg("Invalid recurrence rule")
+			return err
+		}
+
+		channel.Recurrence = sql.NullString{String: rule, Valid: true}
+	}
+
+	return nil
+}
+
+// endRecording removes the recording session stored on the channel once it is no longer running
+// and records the final state of the session in its recording history
+func (r *Resolver) endRecording(channelData *models.Channel, state models.RecordingState, files []utils.RecordingFile) {
+	r.endSession(channelData.ID, channelData.RecordingSID.String, state, files)
+}
+
+// endSession records the final state of the recording or snapshot session with the given sid
+func (r *Resolver) endSession(channelID int64, sid string, state models.RecordingState, files []utils.RecordingFile) {
+	var fileList sql.NullString
+	if files != nil {
+		encodedFiles, err := json.Marshal(files)
+		if err != nil {
+			r.Logger.Error().Err(err).Interface("files", files).Msg("Could not encode recording files")
+		} else {
+			fileList = sql.NullString{String: string(encodedFiles), Valid: true}
+		}
+	}
+
+	err := r.DB.EndRecording(sid, state, fileList)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channelID).Str("sid", sid).Msg("Could not end recording session")
+	}
+}
+
+// activeRecordingProfile fetches the profile that the recording with the given sid was started with
+func (r *Resolver) activeRecordingProfile(sid string) (*utils.RecordingProfile, error) {
+	var profileName string
+	err := r.DB.Get(&profileName, "SELECT profile FROM recordings WHERE sid = $1", sid)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, ok := r.RecordingProfiles[profileName]
+	if !ok {
+		return nil, fmt.Errorf("Recording profile %s is no longer configured", profileName)
+	}
+
+	return &profile, nil
+}
+
+// storageDestinationName returns the name of the storage destination that the channel records to
+func storageDestinationName(channelData *models.Channel) string {
+	if channelData.StorageDestination.Valid && channelData.StorageDestination.String != "" {
+		return channelData.StorageDestination.String
+	}
+
+	return utils.DefaultStorageDestination
+}
+
+// storageDestination fetches the configured storage destination with the given name
+func (r *Resolver) storageDestination(name string) (*utils.StorageDestination, error) {
+	destination, ok := r.Storage[name]
+	if !ok {
+		return nil, fmt.Errorf("Storage destination %s is not configured", name)
+	}
+
+	return &destination, nil
+}
+
+// retentionExpiry returns when a recording started at startedAt expires.
+// The retention of the channel takes precedence over the retention of its storage destination,
+// which takes precedence over RECORDING_RETENTION_DAYS. Recordings without a retention never expire.
+func retentionExpiry(channelData *models.Channel, destination *utils.StorageDestination, startedAt time.Time) sql.NullTime {
+	days := viper.GetInt("RECORDING_RETENTION_DAYS")
+	if destination.RetentionDays > 0 {
+		days = destination.RetentionDays
+	}
+
+	if channelData.RetentionDays.Valid {
+		days = int(channelData.RetentionDays.Int32)
+	}
+
+	if days <= 0 {
+		return sql.NullTime{}
+	}
+
+	return sql.NullTime{Time: startedAt.AddDate(0, 0, days), Valid: true}
+}
+
+// isAdmin reports whether the user is allowed to manage the recordings of every channel
+func isAdmin(user *models.UserAccount) bool {
+	for _, email := range viper.GetStringSlice("ADMIN_EMAILS") {
+		if email != "" && strings.EqualFold(email, user.Email) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recording converts a recording session stored in the database
+func recording(session *models.RecordingSession) (*models.Recording, error) {
+	files := []utils.RecordingFile{}
+	if session.Files.Valid {
+		err := json.Unmarshal([]byte(session.Files.String), &files)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.Recording{
+		ID:         int(session.ID),
+		Sid:        session.SID,
+		State:      models.RecordingState(session.Status),
+		FilePrefix: session.FilePrefix,
+		Profile:    session.Profile,
+		Mode:       models.RecordingMode(strings.ToUpper(session.Mode)),
+		StartedAt:  formatTime(session.StartedAt),
+		StoppedAt:  formatNullTime(session.StoppedAt),
+		UploadedAt: formatNullTime(session.UploadedAt),
+		ExpiresAt:  formatNullTime(session.ExpiresAt),
+		DeletedAt:  formatNullTime(session.DeletedAt),
+		Files:      recordingFiles(files),
+	}, nil
+}
+
+// reserveRecorder reserves a UID in the channel for the cloud recording bot and sets its credentials
+func (r *Resolver) reserveRecorder(recorder *utils.Recorder, channelID int64) error {
+	credentials, err := utils.ReserveUserCredentials(r.DB, channelID, recorder.Channel, models.UIDKindRecording, "", false, utils.CredentialRecording, rtctoken.RoleSubscriber)
+	if err != nil {
+		return err
+	}
+
+	recorder.UID = int32(credentials.UID)
+	recorder.Token = credentials.Rtc
+	return nil
+}
+
+// renewUID records the expiry of the renewed credentials of a channel UID
+func (r *Resolver) renewUID(channelUID *models.ChannelUID, credentials *models.UserCredentials) error {
+	expiresAt, err := time.Parse(time.RFC3339, credentials.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.DB.Exec("UPDATE channel_uids SET expires_at = $1 WHERE id = $2", expiresAt, channelUID.ID)
+	return err
+}
+
+// credentialRole returns the credential type and RTC role of a user joining the channel.
+// Viewers of webinars can only subscribe.
+func credentialRole(channelData *models.Channel, host bool) (utils.CredentialType, rtctoken.Role) {
+	if host {
+		return utils.CredentialHost, rtctoken.RolePublisher
+	}
+
+	if channelData.Webinar {
+		return utils.CredentialAttendee, rtctoken.RoleSubscriber
+	}
+
+	return utils.CredentialAttendee, rtctoken.RolePublisher
+}
+
+// recordingState converts the status returned by the query endpoint of Cloud Recording
+func recordingState(status int) models.RecordingState {
+	switch {
+	case status >= 0 && status <= 4:
+		return models.RecordingStateStarting
+	case status == 5:
+		return models.RecordingStateRecording
+	case status == 6:
+		return models.RecordingStateStopping
+	case status == 7 || status == 8:
+		return models.RecordingStateStopped
+	default:
+		return models.RecordingStateFailed
+	}
+}
+
+// recordingFiles converts the file list returned by Cloud Recording
+func recordingFiles(files []utils.RecordingFile) []*models.RecordingFile {
+	result := []*models.RecordingFile{}
+	for index := range files {
+		file := files[index]
+		result = append(result, &models.RecordingFile{
+			FileName:   file.FileName,
+			TrackType:  &file.TrackType,
+			UID:        &file.UID,
+			IsPlayable: file.IsPlayable,
+		})
+	}
+
+	return result
+}
+
+// formatSliceTime formats the millisecond timestamps returned by Cloud Recording
+func formatSliceTime(milliseconds int64) *string {
+	if milliseconds <= 0 {
+		return nil
+	}
+
+	formatted := time.Unix(0, milliseconds*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+	return &formatted
+}
+
+// formatTime formats timestamps stored in the database
+func formatTime(timestamp time.Time) string {
+	return timestamp.UTC().Format(time.RFC3339)
+}
+
+// apiKey converts an API key stored in the database
+func apiKey(record *models.APIKeyRecord) *models.APIKey {
+	return &models.APIKey{
+		ID:         int(record.ID),
+		Name:       record.Name,
+		Scopes:     record.ScopeList(),
+		RateLimit:  record.RateLimit,
+		CreatedAt:  formatTime(record.CreatedAt),
+		LastUsedAt: formatNullTime(record.LastUsedAt),
+		RevokedAt:  formatNullTime(record.RevokedAt),
+	}
+}
+
+// formatNullTime formats a nullable timestamp, returning nil when it is null
+func formatNullTime(timestamp sql.NullTime) *string {
+	if !timestamp.Valid {
+		return nil
+	}
+
+	formatted := formatTime(timestamp.Time)
+	return &formatted
+}
+
+// nullInt returns the value of a nullable integer column as an optional GraphQL integer
+func nullInt(value sql.NullInt32) *int {
+	if !value.Valid {
+		return nil
+	}
+
+	result := int(value.Int32)
+	return &result
+}
+
+// nullString returns the value of a nullable text column as an optional GraphQL string
+func nullString(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+
+	return &value.String
+}
+
+// uidStrings converts the UIDs passed to GraphQL into the format used by Cloud Recording
+func uidStrings(uids []int) []string {
+	result := []string{}
+	for _, uid := range uids {
+		result = append(result, strconv.Itoa(uid))
+	}
+
+	return result
+}
+
+// customLayout converts the layout passed to GraphQL into a Cloud Recording layout
+func customLayout(layout *models.RecordingLayout) *utils.CustomLayout {
+	result := &utils.CustomLayout{
+		Regions: []utils.LayoutRegion{},
+	}
+
+	if layout.BackgroundColor != nil {
+		result.BackgroundColor = *layout.BackgroundColor
+	}
+
+	if layout.BackgroundImage != nil {
+		result.BackgroundImage = *layout.BackgroundImage
+	}
+
+	for _, region := range layout.Regions {
+		alpha := 1.0
+		if region.Alpha != nil {
+			alpha = *region.Alpha
+		}
+
+		renderMode := utils.RenderModeCrop
+		if region.RenderMode != nil && *region.RenderMode == models.RenderModeFit {
+			renderMode = utils.RenderModeFit
+		}
+
+		result.Regions = append(result.Regions, utils.LayoutRegion{
+			UID:        region.UID,
+			X:          region.X,
+			Y:          region.Y,
+			Width:      region.Width,
+			Height:     region.Height,
+			Alpha:      alpha,
+			RenderMode: renderMode,
+		})
+	}
+
+	return result
 }
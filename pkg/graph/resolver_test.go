@@ -0,0 +1,81 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+	"github.com/samyak-jain/agora_backend/internal/generated"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+// newTestResolver returns a resolver backed by a mock database, with no PSTN or recording provider set
+func newTestResolver(t *testing.T) (*Resolver, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Could not create mock database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+
+		db.Close()
+	})
+
+	logger := zerolog.Nop()
+
+	return &Resolver{
+		DB:     &models.Database{DB: sqlx.NewDb(db, "postgres")},
+		Logger: &utils.Logger{Logger: &logger},
+	}, mock
+}
+
+// newTestClient serves the GraphQL schema with the resolver the same way the server does
+func newTestClient(resolver *Resolver) *client.Client {
+	return client.New(handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: resolver})))
+}
+
+// capturedArg matches any query argument and keeps its value
+type capturedArg struct {
+	value driver.Value
+}
+
+func (c *capturedArg) Match(value driver.Value) bool {
+	c.value = value
+	return true
+}
+
+// String returns the captured value, which must be a string
+func (c *capturedArg) String() string {
+	value, _ := c.value.(string)
+	return value
+}
+
+// anyArgs returns n arguments that match anything
+func anyArgs(n int) []driver.Value {
+	args := make([]driver.Value, n)
+	for index := range args {
+		args[index] = sqlmock.AnyArg()
+	}
+
+	return args
+}
@@ -15,13 +15,14 @@ package graph
 
 import (
 	"context"
+	"crypto/subtle"
 	"database/sql"
 	"errors"
-	"regexp"
+	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/rs/zerolog/log"
 	"github.com/samyak-jain/agora_backend/internal/generated"
 	"github.com/samyak-jain/agora_backend/pkg/middleware"
 	"github.com/samyak-jain/agora_backend/pkg/models"
@@ -30,18 +31,45 @@ import (
 	"github.com/spf13/viper"
 )
 
-func (r *mutationResolver) CreateChannel(ctx context.Context, title string, backendURL string, enablePstn *bool) (*models.ShareResponse, error) {
+func (r *mutationResolver) CreateChannel(ctx context.Context, title string, backendURL string, enablePstn *bool, storage *string, autoRecord *bool, retentionDays *int, webinar *bool, userAccounts *bool, expiresIn *int, startTime *string, duration *int, timezone *string, recurrence *string, lobby *bool) (*models.ShareResponse, error) {
 	r.Logger.Info().Str("mutation", "CreateChannel").Str("title", title).Msg("Creating Channel")
 	if enablePstn != nil {
 		r.Logger.Info().Bool("enablePstn", *enablePstn).Msg("")
 	}
 
-	if viper.GetBool("ENABLE_OAUTH") {
-		_, err := middleware.GetUserFromContext(ctx)
-		if err != nil {
-			r.Logger.Debug().Msg("Invalid Token")
-			return nil, errors.New("Invalid Token")
+	var ownerID sql.NullInt64
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err == nil {
+		ownerID = sql.NullInt64{Int64: authUser.ID, Valid: true}
+	} else if viper.GetBool("ENABLE_OAUTH") {
+		r.Logger.Debug().Msg("Invalid Token")
+		return nil, errors.New("Invalid Token")
+	}
+
+	storageDestination, err := r.channelStorage(storage)
+	if err != nil {
+		return nil, err
+	}
+
+	retention, err := r.channelRetention(retentionDays)
+	if err != nil {
+		return nil, err
+	}
+
+	var expiresAt sql.NullTime
+	if expiresIn != nil {
+		if *expiresIn < 1 {
+			r.Logger.Debug().Int("expiresIn", *expiresIn).Msg("Invalid expiry")
+			return nil, errors.New("Channel must expire at least one second after it is created")
 		}
+
+		expiresAt = sql.NullTime{Time: time.Now().Add(time.Duration(*expiresIn) * time.Second), Valid: true}
+	}
+
+	var schedule models.Channel
+	err = r.scheduleChannel(&schedule, startTime, duration, timezone, recurrence)
+	if err != nil {
+		return nil, err
 	}
 
 	var pstnResponse *models.Pstn
@@ -79,48 +107,36 @@ func (r *mutationResolver) CreateChannel(ctx context.Context, title string, back
 	}
 
 	if *enablePstn {
-		if len(backendURL) <= 0 {
-			r.Logger.Error().Str("backend", backendURL).Msg("Backend URL is empty")
-			return nil, errors.New("Backend URL is empty")
-		}
-
-		// TODO: Refactor to remove duplicate code
-		// Remove trailing slash from URL
-		runeBackendURL := []rune(backendURL)
-		if runeBackendURL[len(runeBackendURL)-1] == '/' {
-			runeBackendURL = runeBackendURL[:len(runeBackendURL)-1]
-		}
-
-		finalBackendURL := string(runeBackendURL)
-
-		var pstnNumber string
-		if viper.GetString("PSTN_NUMBER") == "" {
-			pstnNumber = "(800) 309-2350"
-		} else {
-			pstnNumber = viper.GetString("PSTN_NUMBER")
-		}
-
-		services.CreateBridge(r.Logger, *dtmfResult, finalBackendURL)
-		pstnResponse = &models.Pstn{
-			Number: pstnNumber,
-			Dtmf:   *dtmfResult,
+		pstnResponse, err = r.createBridge(ctx, *dtmfResult, backendURL)
+		if err != nil {
+			return nil, err
 		}
-
-		r.Logger.Info().Str("DTMF", *dtmfResult).Msg("PSTN PIN")
 	} else {
 		pstnResponse = nil
 	}
 
 	newChannel = &models.Channel{
-		Title:            title,
-		ChannelName:      channel,
-		ChannelSecret:    secret,
-		HostPassphrase:   hostPhrase,
-		ViewerPassphrase: viewPhrase,
-		DTMF:             *dtmfResult,
+		Title:              title,
+		ChannelName:        channel,
+		ChannelSecret:      secret,
+		HostPassphrase:     hostPhrase,
+		ViewerPassphrase:   viewPhrase,
+		DTMF:               *dtmfResult,
+		StorageDestination: storageDestination,
+		AutoRecord:         autoRecord != nil && *autoRecord,
+		RetentionDays:      retention,
+		Webinar:            webinar != nil && *webinar,
+		UserAccounts:       userAccounts != nil && *userAccounts,
+		ExpiresAt:          expiresAt,
+		OwnerID:            ownerID,
+		StartTime:          schedule.StartTime,
+		Duration:           schedule.Duration,
+		Timezone:           schedule.Timezone,
+		Recurrence:         schedule.Recurrence,
+		Lobby:              lobby != nil && *lobby,
 	}
 
-	_, err = r.DB.NamedExec("INSERT INTO channels (title, channel_name, channel_secret, host_passphrase, viewer_passphrase, dtmf) VALUES (:title, :channel_name, :channel_secret, :host_passphrase, :viewer_passphrase, :dtmf)", newChannel)
+	_, err = r.DB.NamedExec("INSERT INTO channels (title, channel_name, channel_secret, host_passphrase, viewer_passphrase, dtmf, storage_destination, auto_record, retention_days, webinar, user_accounts, expires_at, owner_id, start_time, duration, timezone, recurrence, lobby) VALUES (:title, :channel_name, :channel_secret, :host_passphrase, :viewer_passphrase, :dtmf, :storage_destination, :auto_record, :retention_days, :webinar, :user_accounts, :expires_at, :owner_id, :start_time, :duration, :timezone, :recurrence, :lobby)", newChannel)
 
 	if err != nil {
 		r.Logger.Error().Err(err).Interface("channel details", newChannel).Msg("Adding new channel to DB Failed")
@@ -138,6 +154,97 @@ func (r *mutationResolver) CreateChannel(ctx context.Context, title string, back
 	}, nil
 }
 
+func (r *mutationResolver) CreateMeetingSeries(ctx context.Context, title string, backendURL string, enablePstn *bool, storage *string, autoRecord *bool, retentionDays *int, webinar *bool, userAccounts *bool, startTime string, duration int, timezone *string, recurrence string, lobby *bool) (*models.MeetingSeries, error) {
+	r.Logger.Info().Str("mutation", "CreateMeetingSeries").Str("title", title).Str("recurrence", recurrence).Msg("")
+
+	var ownerID sql.NullInt64
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err == nil {
+		ownerID = sql.NullInt64{Int64: authUser.ID, Valid: true}
+	} else if viper.GetBool("ENABLE_OAUTH") {
+		r.Logger.Debug().Msg("Invalid Token")
+		return nil, errors.New("Invalid Token")
+	}
+
+	storageDestination, err := r.channelStorage(storage)
+	if err != nil {
+		return nil, err
+	}
+
+	retention, err := r.channelRetention(retentionDays)
+	if err != nil {
+		return nil, err
+	}
+
+	var schedule models.Channel
+	err = r.scheduleChannel(&schedule, &startTime, &duration, timezone, &recurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = utils.NewRecurrence(schedule.Recurrence.String)
+	if err != nil {
+		r.Logger.Debug().Err(err).Str("recurrence", recurrence).Msg("Unsupported recurrence rule")
+		return nil, err
+	}
+
+	location := "UTC"
+	if schedule.Timezone.Valid {
+		location = schedule.Timezone.String
+	}
+
+	hostPhrase, err := utils.GenerateUUID()
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Host Phrase generation failed")
+		return nil, errInternalServer
+	}
+
+	viewPhrase, err := utils.GenerateUUID()
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("View Phrase generation failed")
+		return nil, errInternalServer
+	}
+
+	dtmfResult, err := utils.GenerateDTMF()
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("DTMF generation failed")
+		return nil, errInternalServer
+	}
+
+	if enablePstn != nil && *enablePstn {
+		_, err = r.createBridge(ctx, *dtmfResult, backendURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	series := &models.MeetingSeriesRecord{
+		OwnerID:            ownerID,
+		Title:              title,
+		HostPassphrase:     hostPhrase,
+		ViewerPassphrase:   viewPhrase,
+		DTMF:               *dtmfResult,
+		StorageDestination: storageDestination,
+		AutoRecord:         autoRecord != nil && *autoRecord,
+		RetentionDays:      retention,
+		Webinar:            webinar != nil && *webinar,
+		UserAccounts:       userAccounts != nil && *userAccounts,
+		StartTime:          schedule.StartTime.Time,
+		Duration:           duration,
+		Timezone:           location,
+		Recurrence:         schedule.Recurrence.String,
+		Lobby:              lobby != nil && *lobby,
+	}
+
+	err = r.DB.CreateSeries(series)
+	if err != nil {
+		r.Logger.Error().Err(err).Interface("series details", series).Msg("Adding new meeting series to DB Failed")
+		return nil, errInternalServer
+	}
+
+	return meetingSeries(series), nil
+}
+
 func (r *mutationResolver) MutePstn(ctx context.Context, uid int, passphrase string, mute *bool) (*models.UIDMuteState, error) {
 	r.Logger.Info().Str("mutation", "MutePSTN").Int("uid", uid).Str("passphrase", passphrase).Bool("mute", *mute).Msg("Creating Channel")
 
@@ -147,7 +254,7 @@ func (r *mutationResolver) MutePstn(ctx context.Context, uid int, passphrase str
 		return nil, errors.New("Passphrase cannot be empty")
 	}
 
-	err := r.DB.Get(&channelData, "SELECT title, channel_name, channel_secret, host_passphrase, viewer_passphrase, dtmf FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1", passphrase)
+	err := r.DB.Get(&channelData, "SELECT title, channel_name, channel_secret, host_passphrase, viewer_passphrase, dtmf FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1 ORDER BY id DESC LIMIT 1", passphrase)
 	if err != nil {
 		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
 		return nil, errors.New("Invalid URL")
@@ -159,7 +266,11 @@ func (r *mutationResolver) MutePstn(ctx context.Context, uid int, passphrase str
 			return nil, errBadRequest
 		}
 
-		services.MutePSTN(r.Logger, uid, *mute, channelData.DTMF)
+		err = services.MutePSTN(ctx, r.PSTN, uid, *mute, channelData.DTMF)
+		if err != nil {
+			r.Logger.Error().Err(err).Int("uid", uid).Str("DTMF", channelData.DTMF).Msg("Could not change PSTN mute state")
+			return nil, errInternalServer
+		}
 
 		return &models.UIDMuteState{
 			UID:  uid,
@@ -177,25 +288,29 @@ func (r *mutationResolver) MutePstn(ctx context.Context, uid int, passphrase str
 func (r *mutationResolver) SetPresenter(ctx context.Context, uid int, passphrase string) (int, error) {
 	r.Logger.Info().Str("mutation", "SetPresenter").Str("passphrase", passphrase).Int("uid", uid).Msg("")
 
-	if passphrase == "" {
-		return 0, errors.New("Passphrase cannot be empty")
-	}
-
-	var channelData models.Channel
-
-	err := r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase, recording_rid, recording_sid, recording_uid FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1", passphrase)
+	channelData, unlock, err := r.lockedHostChannel(ctx, passphrase)
 	if err != nil {
-		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
-		return 0, errors.New("Invalid URL")
+		return 0, err
 	}
 
+	defer unlock()
+
 	if !channelData.RecordingRID.Valid || !channelData.RecordingSID.Valid || !channelData.RecordingUID.Valid {
 		r.Logger.Debug().Interface("Channel Data", channelData).Msg("RID or SID or UID not in DB")
 		return 0, errors.New("Recording not started")
 	}
 
-	err = utils.ChangeRecordingMode(channelData.ChannelName, int(channelData.RecordingUID.Int32), channelData.RecordingRID.String, channelData.RecordingSID.String, 2, strconv.Itoa(uid), r.Logger)
-	if err != nil {
+	if channelData.RecordingMode.Valid && channelData.RecordingMode.String != utils.RecordingModeMix {
+		r.Logger.Debug().Interface("Channel Data", channelData).Msg("Layout can only be changed for mixed recordings")
+		return 0, errors.New("Layout can only be changed for mixed recordings")
+	}
+
+	err = r.existingRecorder(channelData).ChangeRecordingMode(ctx, 2, strconv.Itoa(uid))
+	if utils.IsRecordingNotFound(err) {
+		r.Logger.Info().Str("sid", channelData.RecordingSID.String).Msg("Recording session no longer exists")
+		r.endRecording(channelData, models.RecordingStateStopped, nil)
+		return 0, errors.New("Recording not started")
+	} else if err != nil {
 		r.Logger.Error().Err(err).Msg("Stop recording failed")
 		return 0, errInternalServer
 	}
@@ -206,26 +321,76 @@ func (r *mutationResolver) SetPresenter(ctx context.Context, uid int, passphrase
 func (r *mutationResolver) SetNormal(ctx context.Context, passphrase string) (string, error) {
 	r.Logger.Info().Str("mutation", "SetPresenter").Str("passphrase", passphrase).Msg("")
 
-	if passphrase == "" {
-		return "", errors.New("Passphrase cannot be empty")
+	channelData, unlock, err := r.lockedHostChannel(ctx, passphrase)
+	if err != nil {
+		return "", err
 	}
 
-	var channelData models.Channel
+	defer unlock()
+
+	if !channelData.RecordingRID.Valid || !channelData.RecordingSID.Valid || !channelData.RecordingUID.Valid {
+		r.Logger.Debug().Interface("Channel Data", channelData).Msg("RID or SID or UID not in DB")
+		return "", errors.New("Recording not started")
+	}
+
+	if channelData.RecordingMode.Valid && channelData.RecordingMode.String != utils.RecordingModeMix {
+		r.Logger.Debug().Interface("Channel Data", channelData).Msg("Layout can only be changed for mixed recordings")
+		return "", errors.New("Layout can only be changed for mixed recordings")
+	}
+
+	err = r.existingRecorder(channelData).ChangeRecordingMode(ctx, 1, "")
+	if utils.IsRecordingNotFound(err) {
+		r.Logger.Info().Str("sid", channelData.RecordingSID.String).Msg("Recording session no longer exists")
+		r.endRecording(channelData, models.RecordingStateStopped, nil)
+		return "", errors.New("Recording not started")
+	} else if err != nil {
+		r.Logger.Error().Err(err).Msg("Stop recording failed")
+		return "", errInternalServer
+	}
 
-	err := r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase, recording_rid, recording_sid, recording_uid FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1", passphrase)
+	return "success", nil
+}
+
+func (r *mutationResolver) SetRecordingLayout(ctx context.Context, passphrase string, layout models.RecordingLayout) (string, error) {
+	r.Logger.Info().Str("mutation", "SetRecordingLayout").Str("passphrase", passphrase).Interface("layout", layout).Msg("")
+
+	channelData, unlock, err := r.lockedHostChannel(ctx, passphrase)
 	if err != nil {
-		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
-		return "", errors.New("Invalid URL")
+		return "", err
 	}
 
+	defer unlock()
+
 	if !channelData.RecordingRID.Valid || !channelData.RecordingSID.Valid || !channelData.RecordingUID.Valid {
 		r.Logger.Debug().Interface("Channel Data", channelData).Msg("RID or SID or UID not in DB")
 		return "", errors.New("Recording not started")
 	}
 
-	err = utils.ChangeRecordingMode(channelData.ChannelName, int(channelData.RecordingUID.Int32), channelData.RecordingRID.String, channelData.RecordingSID.String, 1, "", r.Logger)
+	if channelData.RecordingMode.Valid && channelData.RecordingMode.String != utils.RecordingModeMix {
+		r.Logger.Debug().Interface("Channel Data", channelData).Msg("Layout can only be changed for mixed recordings")
+		return "", errors.New("Layout can only be changed for mixed recordings")
+	}
+
+	profile, err := r.activeRecordingProfile(channelData.RecordingSID.String)
 	if err != nil {
-		r.Logger.Error().Err(err).Msg("Stop recording failed")
+		r.Logger.Error().Err(err).Str("sid", channelData.RecordingSID.String).Msg("Could not fetch recording profile")
+		return "", errInternalServer
+	}
+
+	recordingLayout := customLayout(&layout)
+	err = recordingLayout.Validate(profile)
+	if err != nil {
+		r.Logger.Debug().Err(err).Interface("layout", layout).Msg("Invalid recording layout")
+		return "", err
+	}
+
+	err = r.existingRecorder(channelData).SetLayout(ctx, recordingLayout, profile)
+	if utils.IsRecordingNotFound(err) {
+		r.Logger.Info().Str("sid", channelData.RecordingSID.String).Msg("Recording session no longer exists")
+		r.endRecording(channelData, models.RecordingStateStopped, nil)
+		return "", errors.New("Recording not started")
+	} else if err != nil {
+		r.Logger.Error().Err(err).Msg("Set recording layout failed")
 		return "", errInternalServer
 	}
 
@@ -263,17 +428,46 @@ func (r *mutationResolver) UpdateUserName(ctx context.Context, name string) (*mo
 	}, nil
 }
 
-func (r *mutationResolver) StartRecordingSession(ctx context.Context, passphrase string, secret *string) (string, error) {
+func (r *mutationResolver) StartRecordingSession(ctx context.Context, passphrase string, secret *string, profile *string, mode *models.RecordingMode, subscribeUids []int, unsubscribeUids []int) (string, error) {
 	r.Logger.Info().Str("mutation", "StartRecordingSession").Str("passphrase", passphrase).Msg("")
 	if secret != nil {
 		r.Logger.Info().Str("secret", *secret).Msg("")
 	}
 
-	var channelData models.Channel
-	var host bool
+	profileName := utils.DefaultRecordingProfile
+	if profile != nil && *profile != "" {
+		profileName = strings.ToLower(*profile)
+	}
+
+	recordingProfile, ok := r.RecordingProfiles[profileName]
+	if !ok {
+		r.Logger.Debug().Str("profile", profileName).Msg("Unknown recording profile")
+		return "", errors.New("Unknown recording profile")
+	}
+
+	recordingMode := utils.RecordingModeMix
+	if mode != nil {
+		recordingMode = strings.ToLower(mode.String())
+	}
+
+	err := recordingProfile.SupportsMode(recordingMode)
+	if err != nil {
+		r.Logger.Debug().Err(err).Str("profile", profileName).Str("mode", recordingMode).Msg("Invalid recording mode")
+		return "", err
+	}
+
+	subscription := &utils.Subscription{
+		SubscribeUIDs:   uidStrings(subscribeUids),
+		UnsubscribeUIDs: uidStrings(unsubscribeUids),
+	}
+
+	err = subscription.Validate()
+	if err != nil {
+		r.Logger.Debug().Err(err).Ints("subscribe", subscribeUids).Ints("unsubscribe", unsubscribeUids).Msg("Invalid subscription")
+		return "", err
+	}
 
 	var authUser *models.UserAccount
-	var err error
 	if viper.GetBool("ENABLE_OAUTH") {
 		authUser, err = middleware.GetUserFromContext(ctx)
 		if err != nil {
@@ -282,121 +476,171 @@ func (r *mutationResolver) StartRecordingSession(ctx context.Context, passphrase
 		}
 	}
 
-	if passphrase == "" {
-		return "", errors.New("Passphrase cannot be empty")
+	channelData, unlock, err := r.lockedHostChannel(ctx, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	defer unlock()
+
+	if channelData.RecordingSID.Valid {
+		r.Logger.Debug().Str("sid", channelData.RecordingSID.String).Str("channel", channelData.ChannelName).Msg("Recording already running")
+		return "", errors.New("Recording already started")
 	}
 
-	err = r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1", passphrase)
+	err = r.startRecording(ctx, channelData, authUser, secret, profileName, &recordingProfile, recordingMode, subscription)
 	if err != nil {
-		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
-		return "", errors.New("Invalid URL")
+		return "", err
 	}
 
-	if passphrase == channelData.HostPassphrase {
-		host = true
-	} else if passphrase == channelData.ViewerPassphrase {
-		host = false
-	} else {
-		r.Logger.Debug().Str("passphrase", passphrase).Msg("Invalid Passphrase; Interal Server Error")
-		return "", errors.New("Invalid URL")
+	return "success", nil
+}
+
+func (r *mutationResolver) StopRecordingSession(ctx context.Context, passphrase string) (string, error) {
+	r.Logger.Info().Str("mutation", "StopRecordingSession").Str("passphrase", passphrase).Msg("")
+
+	channelData, unlock, err := r.lockedHostChannel(ctx, passphrase)
+	if err != nil {
+		return "", err
 	}
 
-	if !host {
-		r.Logger.Debug().Str("passphrase", passphrase).Str("channel", channelData.ChannelName).Msg("Unauthorized to record channel")
-		return "", errors.New("Unauthorised to record channel")
+	defer unlock()
+
+	if !channelData.RecordingRID.Valid || !channelData.RecordingSID.Valid || !channelData.RecordingUID.Valid {
+		r.Logger.Debug().Interface("Channel Data", channelData).Msg("RID or SID or UID not in DB")
+		return "", errors.New("Recording not started")
 	}
 
-	var title string
-	if authUser == nil || !authUser.UserName.Valid || authUser.UserName.String == "" {
-		title = channelData.Title
-	} else {
-		title = authUser.UserName.String
+	result, err := r.existingRecorder(channelData).Stop(ctx)
+	if utils.IsRecordingNotFound(err) {
+		r.Logger.Info().Str("sid", channelData.RecordingSID.String).Msg("Recording session no longer exists")
+		r.endRecording(channelData, models.RecordingStateStopped, nil)
+		return "", errors.New("Recording not started")
+	} else if err != nil {
+		r.Logger.Error().Err(err).Msg("Stop recording failed")
+		return "", errInternalServer
 	}
 
-	reg, err := regexp.Compile("[^a-zA-Z0-9]+")
+	files, err := result.ServerResponse.Files()
 	if err != nil {
-		log.Error().Err(err).Msg("Regex Compilation failed")
+		r.Logger.Error().Err(err).Interface("response", result).Msg("Could not parse recording file list")
 	}
 
-	finalTitle := utils.FirstN(reg.ReplaceAllString(title, ""), 100)
+	r.endRecording(channelData, models.RecordingStateStopped, files)
 
-	recorder := &utils.Recorder{
-		Logger: r.Logger,
-	}
-	recorder.Channel = channelData.ChannelName
+	return "success", nil
+}
 
-	err = recorder.Acquire()
-	if err != nil {
-		r.Logger.Error().Err(err).Msg("Acquire Failed")
-		return "", errInternalServer
+func (r *mutationResolver) StartSnapshotSession(ctx context.Context, passphrase string, secret *string) (string, error) {
+	r.Logger.Info().Str("mutation", "StartSnapshotSession").Str("passphrase", passphrase).Msg("")
+
+	var authUser *models.UserAccount
+	var err error
+	if viper.GetBool("ENABLE_OAUTH") {
+		authUser, err = middleware.GetUserFromContext(ctx)
+		if err != nil {
+			r.Logger.Debug().Msg("Invalid Token")
+			return "", errors.New("Invalid Token")
+		}
 	}
 
-	err = recorder.Start(finalTitle, secret)
+	channelData, unlock, err := r.lockedHostChannel(ctx, passphrase)
 	if err != nil {
-		r.Logger.Error().Err(err).Msg("Start Failed")
-		return "", errInternalServer
+		return "", err
 	}
-	recordDetails := models.Channel{
-		ID:           channelData.ID,
-		RecordingUID: sql.NullInt32{Int32: recorder.UID, Valid: true},
-		RecordingRID: sql.NullString{String: recorder.RID, Valid: true},
-		RecordingSID: sql.NullString{String: recorder.SID, Valid: true},
+
+	defer unlock()
+
+	if channelData.SnapshotSID.Valid {
+		r.Logger.Debug().Str("sid", channelData.SnapshotSID.String).Str("channel", channelData.ChannelName).Msg("Snapshot session already running")
+		return "", errors.New("Snapshot already started")
 	}
 
-	_, err = r.DB.NamedExec("UPDATE channels SET (recording_uid, recording_sid, recording_rid) = (:recording_uid, :recording_sid, :recording_rid) WHERE id = :id", &recordDetails)
+	// Snapshots do not use a recording profile and are stored with the default one
+	err = r.startSession(ctx, channelData, authUser, models.RecordingKindSnapshot, utils.RecordingModeIndividual, utils.DefaultRecordingProfile, func(ctx context.Context, recorder *utils.Recorder, fileNamePrefix []string, storage *utils.StorageDestination) error {
+		return recorder.StartSnapshot(ctx, fileNamePrefix, secret, r.Snapshots.CaptureInterval, storage)
+	})
 	if err != nil {
-		r.Logger.Error().Err(err).Msg("Updating database for recording failed")
-		return "", errInternalServer
+		return "", err
 	}
 
 	return "success", nil
 }
 
-func (r *mutationResolver) StopRecordingSession(ctx context.Context, passphrase string) (string, error) {
-	r.Logger.Info().Str("mutation", "StopRecordingSession").Str("passphrase", passphrase).Msg("")
+func (r *mutationResolver) StopSnapshotSession(ctx context.Context, passphrase string) (string, error) {
+	r.Logger.Info().Str("mutation", "StopSnapshotSession").Str("passphrase", passphrase).Msg("")
 
-	var channelData models.Channel
-	var host bool
+	channelData, unlock, err := r.lockedHostChannel(ctx, passphrase)
+	if err != nil {
+		return "", err
+	}
 
-	if passphrase == "" {
-		return "", errors.New("Passphrase cannot be empty")
+	defer unlock()
+
+	if !channelData.SnapshotRID.Valid || !channelData.SnapshotSID.Valid || !channelData.SnapshotUID.Valid {
+		r.Logger.Debug().Interface("Channel Data", channelData).Msg("Snapshot RID or SID or UID not in DB")
+		return "", errors.New("Snapshot not started")
+	}
+
+	result, err := r.existingSnapshotRecorder(channelData).Stop(ctx)
+	if utils.IsRecordingNotFound(err) {
+		r.Logger.Info().Str("sid", channelData.SnapshotSID.String).Msg("Snapshot session no longer exists")
+		r.endSession(channelData.ID, channelData.SnapshotSID.String, models.RecordingStateStopped, nil)
+		return "", errors.New("Snapshot not started")
+	} else if err != nil {
+		r.Logger.Error().Err(err).Msg("Stop snapshot failed")
+		return "", errInternalServer
 	}
 
-	err := r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase, recording_rid, recording_sid, recording_uid FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1", passphrase)
+	files, err := result.ServerResponse.Files()
 	if err != nil {
-		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
-		return "", errors.New("Invalid URL")
+		r.Logger.Error().Err(err).Interface("response", result).Msg("Could not parse snapshot file list")
 	}
 
-	if passphrase == channelData.HostPassphrase {
-		host = true
-	} else if passphrase == channelData.ViewerPassphrase {
-		host = false
-	} else {
-		r.Logger.Debug().Str("passphrase", passphrase).Msg("Invalid Passphrase; Interal Server Error")
-		return "", errors.New("Invalid URL")
+	r.endSession(channelData.ID, channelData.SnapshotSID.String, models.RecordingStateStopped, files)
+
+	return "success", nil
+}
+
+func (r *mutationResolver) EndMeeting(ctx context.Context, passphrase string) (string, error) {
+	r.Logger.Info().Str("mutation", "EndMeeting").Str("passphrase", passphrase).Msg("")
+
+	channelData, unlock, err := r.lockedHostChannel(ctx, passphrase)
+	if err != nil {
+		return "", err
 	}
-	if !host {
-		r.Logger.Debug().Str("passphrase", passphrase).Str("channel", channelData.ChannelName).Msg("Unauthorized to record channel")
-		return "", errors.New("Unauthorised to record channel")
+
+	defer unlock()
+
+	if channelData.EndedAt.Valid {
+		return "", channelClosedError(models.ChannelErrorEnded)
 	}
 
-	if !channelData.RecordingRID.Valid || !channelData.RecordingSID.Valid || !channelData.RecordingUID.Valid {
-		r.Logger.Debug().Interface("Channel Data", channelData).Msg("RID or SID or UID not in DB")
-		return "", errors.New("Recording not started")
+	err = r.stopSessions(ctx, channelData)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("channel", channelData.ChannelName).Msg("Could not stop recording of ended meeting")
+		return "", errInternalServer
 	}
 
-	err = utils.Stop(channelData.ChannelName, int(channelData.RecordingUID.Int32), channelData.RecordingRID.String, channelData.RecordingSID.String, r.Logger)
+	_, err = r.DB.Exec("UPDATE channels SET ended_at = CURRENT_TIMESTAMP WHERE id = $1 AND ended_at IS NULL", channelData.ID)
 	if err != nil {
-		r.Logger.Error().Err(err).Msg("Stop recording failed")
+		r.Logger.Error().Err(err).Int64("channel", channelData.ID).Msg("Could not end meeting")
 		return "", errInternalServer
 	}
 
+	// Credentials that were already issued can no longer be renewed
+	_, err = r.DB.Exec("UPDATE channel_uids SET expires_at = CURRENT_TIMESTAMP WHERE channel_id = $1 AND expires_at > CURRENT_TIMESTAMP", channelData.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channelData.ID).Msg("Could not release channel UIDs")
+	}
+
+	r.Logger.Info().Str("channel", channelData.ChannelName).Msg("Meeting ended")
+
 	return "success", nil
 }
 
-func (r *mutationResolver) LogoutSession(ctx context.Context, token string) ([]string, error) {
-	r.Logger.Info().Str("mutation", "LogoutSession").Str("token", token).Msg("")
+func (r *mutationResolver) UpdateChannel(ctx context.Context, id int, input models.UpdateChannelInput) (*models.Meeting, error) {
+	r.Logger.Info().Str("mutation", "UpdateChannel").Int("id", id).Msg("")
 
 	authUser, err := middleware.GetUserFromContext(ctx)
 	if err != nil {
@@ -404,53 +648,363 @@ func (r *mutationResolver) LogoutSession(ctx context.Context, token string) ([]s
 		return nil, errors.New("Invalid Token")
 	}
 
-	res, err := r.DB.NamedExec("DELETE FROM tokens WHERE token_id = :token_id AND user_id = :user_id", &models.Token{
-		TokenID: token,
-		UserID:  authUser.ID,
-	})
+	if input.Title != nil && *input.Title == "" {
+		return nil, errors.New("Title cannot be empty")
+	}
+
+	if input.RetentionDays != nil && *input.RetentionDays < 1 {
+		return nil, errors.New("Retention must be at least one day")
+	}
+
+	var expiresAt sql.NullTime
+	if input.ExpiresIn != nil {
+		if *input.ExpiresIn < 1 {
+			return nil, errors.New("Channel must expire at least one second after it is updated")
+		}
+
+		expiresAt = sql.NullTime{Time: time.Now().Add(time.Duration(*input.ExpiresIn) * time.Second), Valid: true}
+	}
 
+	result, err := r.DB.Exec("UPDATE channels SET title = COALESCE($3, title), expires_at = COALESCE($4, expires_at), auto_record = COALESCE($5, auto_record), webinar = COALESCE($6, webinar), retention_days = COALESCE($7, retention_days), lobby = COALESCE($8, lobby) WHERE id = $1 AND owner_id = $2", id, authUser.ID, input.Title, expiresAt, input.AutoRecord, input.Webinar, input.RetentionDays, input.Lobby)
 	if err != nil {
-		r.Logger.Error().Err(err).Msg("Could not delete token from database")
+		r.Logger.Error().Err(err).Int("id", id).Msg("Could not update channel")
 		return nil, errInternalServer
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		r.Logger.Error().Str("Token", token).Int64("User ID", authUser.ID).Msg("Could not get Rows Affected by DELETE in database")
+		r.Logger.Error().Err(err).Msg("Could not get Rows Affected by UPDATE in database")
 		return nil, errInternalServer
 	}
 
 	if rowsAffected < 1 {
-		r.Logger.Debug().Str("Sub", authUser.Identifier).Msg("Token does not exist")
-		return nil, errBadRequest
+		r.Logger.Debug().Int("id", id).Int64("user", authUser.ID).Msg("Channel not owned by user")
+		return nil, errors.New("Channel not found")
 	}
 
-	tokens := []models.Token{}
-	string_token_slice := []string{}
-	err = r.DB.Select(&tokens, "SELECT * FROM tokens WHERE user_id = $1", authUser.ID)
-	if err != nil {
-		r.Logger.Error().Err(err).Int64("User ID", authUser.ID).Msg("Could not get tokens for this user ID")
+	channels, err := r.listChannels("owner_id", authUser.ID, []string{"channels.id = $2"}, []interface{}{id}, 1)
+	if err != nil || len(channels) == 0 {
+		r.Logger.Error().Err(err).Int("id", id).Msg("Could not fetch updated channel")
 		return nil, errInternalServer
 	}
 
-	for _, v := range tokens {
-		string_token_slice = append(string_token_slice, v.TokenID)
-	}
-
-	return string_token_slice, nil
+	return meeting(&channels[0]), nil
 }
 
-func (r *queryResolver) JoinChannel(ctx context.Context, passphrase string) (*models.Session, error) {
-	r.Logger.Info().Str("query", "JoinChannel").Str("passphrase", passphrase).Msg("")
+func (r *mutationResolver) DeleteChannel(ctx context.Context, id int) (bool, error) {
+	r.Logger.Info().Str("mutation", "DeleteChannel").Int("id", id).Msg("")
 
-	var channelData models.Channel
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		r.Logger.Debug().Msg("Invalid Token")
+		return false, errors.New("Invalid Token")
+	}
+
+	var ownedID int64
+	err = r.DB.Get(&ownedID, "SELECT id FROM channels WHERE id = $1 AND owner_id = $2", id, authUser.ID)
+	if err == sql.ErrNoRows {
+		r.Logger.Debug().Int("id", id).Int64("user", authUser.ID).Msg("Channel not owned by user")
+		return false, errors.New("Channel not found")
+	} else if err != nil {
+		r.Logger.Error().Err(err).Int("id", id).Msg("Could not fetch channel")
+		return false, errInternalServer
+	}
+
+	// Occurrences of a meeting series share their passphrases, so the lock is taken on the channel being deleted
+	unlock, err := r.DB.LockRecording(ctx, ownedID)
+	if err != nil {
+		r.Logger.Error().Err(err).Int("id", id).Msg("Could not lock channel recording")
+		return false, errInternalServer
+	}
+
+	defer unlock()
+
+	// The recording state may have changed while waiting for the lock
+	var channelData models.Channel
+	err = r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase, recording_uid, recording_sid, recording_rid, recording_mode, storage_destination, snapshot_uid, snapshot_sid, snapshot_rid, retention_days, expires_at, ended_at FROM channels WHERE id = $1 AND owner_id = $2", id, authUser.ID)
+	if err == sql.ErrNoRows {
+		r.Logger.Debug().Int("id", id).Int64("user", authUser.ID).Msg("Channel not owned by user")
+		return false, errors.New("Channel not found")
+	} else if err != nil {
+		r.Logger.Error().Err(err).Int("id", id).Msg("Could not fetch channel")
+		return false, errInternalServer
+	}
+
+	err = r.stopSessions(ctx, &channelData)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("channel", channelData.ChannelName).Msg("Could not stop recording of deleted channel")
+		return false, errInternalServer
+	}
+
+	_, err = r.DB.Exec("DELETE FROM channels WHERE id = $1 AND owner_id = $2", id, authUser.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Int("id", id).Msg("Could not delete channel")
+		return false, errInternalServer
+	}
+
+	r.Logger.Info().Int("id", id).Int64("user", authUser.ID).Msg("Channel deleted")
+
+	return true, nil
+}
+
+func (r *mutationResolver) ExtendRecordingRetention(ctx context.Context, id int, days int) (*models.Recording, error) {
+	r.Logger.Info().Str("mutation", "ExtendRecordingRetention").Int("id", id).Int("days", days).Msg("")
+
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		r.Logger.Debug().Msg("Invalid Token")
+		return nil, errors.New("Invalid Token")
+	}
+
+	if !isAdmin(authUser) {
+		r.Logger.Debug().Str("email", authUser.Email).Msg("Unauthorized to manage recordings")
+		return nil, errors.New("Unauthorised to manage recordings")
+	}
+
+	if days < 1 {
+		return nil, errors.New("Retention must be extended by at least one day")
+	}
+
+	// Recordings without an expiry are kept forever and stay that way
+	var session models.RecordingSession
+	err = r.DB.Get(&session, "UPDATE recordings SET expires_at = CASE WHEN expires_at IS NULL THEN NULL ELSE GREATEST(expires_at, CURRENT_TIMESTAMP) + $1 * INTERVAL '1 day' END WHERE id = $2 AND deleted_at IS NULL RETURNING id, channel_id, started_by, uid, sid, rid, file_prefix, profile, mode, status, started_at, stopped_at, uploaded_at, files, expires_at, deleted_at", days, id)
+	if err == sql.ErrNoRows {
+		r.Logger.Debug().Int("id", id).Msg("Recording not found")
+		return nil, errors.New("Recording not found or already deleted")
+	} else if err != nil {
+		r.Logger.Error().Err(err).Int("id", id).Msg("Could not extend recording retention")
+		return nil, errInternalServer
+	}
+
+	r.Logger.Info().Int("id", id).Int64("admin", authUser.ID).Interface("expiresAt", session.ExpiresAt).Msg("Extended recording retention")
+
+	result, err := recording(&session)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("sid", session.SID).Msg("Could not decode recording files")
+		return nil, errInternalServer
+	}
+
+	return result, nil
+}
+
+func (r *mutationResolver) CreateAPIKey(ctx context.Context, name string, scopes []models.APIKeyScope, rateLimit *int) (*models.APIKey, error) {
+	r.Logger.Info().Str("mutation", "CreateAPIKey").Str("name", name).Msg("")
+
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		r.Logger.Debug().Msg("Invalid Token")
+		return nil, errors.New("Invalid Token")
+	}
+
+	if !isAdmin(authUser) {
+		r.Logger.Debug().Str("email", authUser.Email).Msg("Unauthorized to manage API keys")
+		return nil, errors.New("Unauthorised to manage API keys")
+	}
+
+	if name == "" {
+		return nil, errors.New("Name cannot be empty")
+	}
+
+	if len(scopes) == 0 {
+		return nil, errors.New("API key needs at least one scope")
+	}
+
+	limit := viper.GetInt("API_KEY_RATE_LIMIT")
+	if rateLimit != nil {
+		limit = *rateLimit
+	}
+
+	if limit < 1 {
+		return nil, errors.New("Rate limit must be at least one request per minute")
+	}
+
+	key, err := utils.GenerateAPIKey()
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("API key generation failed")
+		return nil, errInternalServer
+	}
+
+	var record models.APIKeyRecord
+	err = r.DB.Get(&record, "INSERT INTO api_keys (name, key_hash, scopes, rate_limit, created_by) VALUES ($1, $2, $3, $4, $5) RETURNING id, name, key_hash, scopes, rate_limit, window_started_at, window_requests, created_by, created_at, last_used_at, revoked_at", name, utils.HashAPIKey(key), models.JoinScopes(scopes), limit, authUser.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("name", name).Msg("Could not store API key")
+		return nil, errInternalServer
+	}
+
+	r.Logger.Info().Int64("id", record.ID).Int64("admin", authUser.ID).Msg("Created API key")
+
+	// The key is only returned once, afterwards only its hash is known
+	result := apiKey(&record)
+	result.Key = &key
+
+	return result, nil
+}
+
+func (r *mutationResolver) RevokeAPIKey(ctx context.Context, id int) (*models.APIKey, error) {
+	r.Logger.Info().Str("mutation", "RevokeAPIKey").Int("id", id).Msg("")
+
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		r.Logger.Debug().Msg("Invalid Token")
+		return nil, errors.New("Invalid Token")
+	}
+
+	if !isAdmin(authUser) {
+		r.Logger.Debug().Str("email", authUser.Email).Msg("Unauthorized to manage API keys")
+		return nil, errors.New("Unauthorised to manage API keys")
+	}
+
+	var record models.APIKeyRecord
+	err = r.DB.Get(&record, "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP) WHERE id = $1 RETURNING id, name, key_hash, scopes, rate_limit, window_started_at, window_requests, created_by, created_at, last_used_at, revoked_at", id)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("API key not found")
+	} else if err != nil {
+		r.Logger.Error().Err(err).Int("id", id).Msg("Could not revoke API key")
+		return nil, errInternalServer
+	}
+
+	r.Logger.Info().Int("id", id).Int64("admin", authUser.ID).Msg("Revoked API key")
+
+	return apiKey(&record), nil
+}
+
+func (r *mutationResolver) LogoutSession(ctx context.Context, token string) ([]string, error) {
+	r.Logger.Info().Str("mutation", "LogoutSession").Str("token", token).Msg("")
+
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		r.Logger.Debug().Msg("Invalid Token")
+		return nil, errors.New("Invalid Token")
+	}
+
+	res, err := r.DB.NamedExec("DELETE FROM tokens WHERE token_id = :token_id AND user_id = :user_id", &models.Token{
+		TokenID: token,
+		UserID:  authUser.ID,
+	})
+
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not delete token from database")
+		return nil, errInternalServer
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		r.Logger.Error().Str("Token", token).Int64("User ID", authUser.ID).Msg("Could not get Rows Affected by DELETE in database")
+		return nil, errInternalServer
+	}
+
+	if rowsAffected < 1 {
+		r.Logger.Debug().Str("Sub", authUser.Identifier).Msg("Token does not exist")
+		return nil, errBadRequest
+	}
+
+	tokens := []models.Token{}
+	string_token_slice := []string{}
+	err = r.DB.Select(&tokens, "SELECT * FROM tokens WHERE user_id = $1", authUser.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("User ID", authUser.ID).Msg("Could not get tokens for this user ID")
+		return nil, errInternalServer
+	}
+
+	for _, v := range tokens {
+		string_token_slice = append(string_token_slice, v.TokenID)
+	}
+
+	return string_token_slice, nil
+}
+
+func (r *mutationResolver) Admit(ctx context.Context, passphrase string, id int) (*models.LobbyParticipant, error) {
+	r.Logger.Info().Str("mutation", "Admit").Str("passphrase", passphrase).Int("id", id).Msg("")
+
+	return r.decideLobby(passphrase, id, models.LobbyStatusAdmitted)
+}
+
+func (r *mutationResolver) Deny(ctx context.Context, passphrase string, id int) (*models.LobbyParticipant, error) {
+	r.Logger.Info().Str("mutation", "Deny").Str("passphrase", passphrase).Int("id", id).Msg("")
+
+	return r.decideLobby(passphrase, id, models.LobbyStatusDenied)
+}
+
+func (r *mutationResolver) ExchangeLobbyTicket(ctx context.Context, ticket string) (*models.Session, error) {
+	r.Logger.Info().Str("mutation", "ExchangeLobbyTicket").Msg("")
+
+	ticketHash := utils.HashLobbyTicket(ticket)
+	record, err := r.DB.LobbyTicketByHash(ticketHash)
+	if err != nil {
+		r.Logger.Debug().Err(err).Msg("Invalid lobby ticket")
+		return nil, errors.New("Invalid lobby ticket")
+	}
+
+	switch {
+	case record.Status == models.LobbyStatusPending:
+		return nil, lobbyError(models.LobbyErrorPending)
+	case record.Status == models.LobbyStatusDenied:
+		return nil, lobbyError(models.LobbyErrorDenied)
+	case record.RedeemedAt.Valid:
+		return nil, lobbyError(models.LobbyErrorRedeemed)
+	}
+
+	var channelData models.Channel
+	err = r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, webinar, user_accounts, expires_at, ended_at FROM channels WHERE id = $1", record.ChannelID)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", record.ChannelID).Msg("Could not fetch channel of lobby ticket")
+		return nil, errInternalServer
+	}
+
+	if reason := channelData.ClosedReason(); reason != "" {
+		r.Logger.Debug().Int64("channel", channelData.ID).Str("reason", reason).Msg("Channel is closed")
+		return nil, channelClosedError(reason)
+	}
+
+	// The ticket is only used up once the UIDs of the participant are reserved
+	tx, err := r.DB.Transaction()
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not begin transaction")
+		return nil, errInternalServer
+	}
+
+	_, err = tx.RedeemLobbyTicket(ticketHash)
+	if err == sql.ErrNoRows {
+		r.Logger.Debug().Int64("ticket", record.ID).Msg("Lobby ticket was redeemed concurrently")
+		tx.Rollback()
+		return nil, lobbyError(models.LobbyErrorRedeemed)
+	} else if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not redeem lobby ticket")
+		tx.Rollback()
+		return nil, errInternalServer
+	}
+
+	session, err := r.joinSession(ctx, tx, &channelData, false, record.DisplayName)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not redeem lobby ticket")
+		return nil, errInternalServer
+	}
+
+	return session, nil
+}
+
+func (r *queryResolver) JoinChannel(ctx context.Context, passphrase string, displayName *string) (*models.Session, error) {
+	r.Logger.Info().Str("query", "JoinChannel").Str("passphrase", passphrase).Msg("")
+
+	var channelData models.Channel
 	var host bool
 
 	if passphrase == "" {
 		return nil, errors.New("Passphrase cannot be empty")
 	}
 
-	err := r.DB.Get(&channelData, "SELECT title, channel_name, channel_secret, host_passphrase, viewer_passphrase FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1", passphrase)
+	err := r.openOccurrence(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase, recording_sid, storage_destination, auto_record, retention_days, webinar, user_accounts, expires_at, ended_at, start_time, lobby FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1 ORDER BY id DESC LIMIT 1", passphrase)
 	if err != nil {
 		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
 		return nil, errors.New("Invalid URL")
@@ -465,26 +1019,33 @@ func (r *queryResolver) JoinChannel(ctx context.Context, passphrase string) (*mo
 		return nil, errors.New("Invalid URL")
 	}
 
-	mainUser, err := utils.GenerateUserCredentials(channelData.ChannelName, true, false)
-	if err != nil {
-		r.Logger.Error().Err(err).Msg("Could not generate main user credentials")
-		return nil, errInternalServer
+	if reason := channelData.ClosedReason(); reason != "" {
+		r.Logger.Debug().Str("passphrase", passphrase).Str("reason", reason).Msg("Channel is closed")
+		return nil, channelClosedError(reason)
 	}
 
-	screenShare, err := utils.GenerateUserCredentials(channelData.ChannelName, false, false)
-	if err != nil {
-		r.Logger.Error().Err(err).Msg("Could not generate screenshare user credentails")
-		return nil, errInternalServer
+	if channelData.StartTime.Valid {
+		opensAt := channelData.StartTime.Time.Add(-time.Duration(viper.GetInt("EARLY_JOIN_MINUTES")) * time.Minute)
+		if time.Now().Before(opensAt) {
+			r.Logger.Debug().Str("passphrase", passphrase).Time("startTime", channelData.StartTime.Time).Msg("Meeting has not started")
+			return nil, notStartedError(channelData.StartTime.Time)
+		}
 	}
 
-	return &models.Session{
-		Title:       channelData.Title,
-		Channel:     channelData.ChannelName,
-		IsHost:      host,
-		MainUser:    mainUser,
-		ScreenShare: screenShare,
-		Secret:      channelData.ChannelSecret,
-	}, nil
+	if host && channelData.AutoRecord && !channelData.RecordingSID.Valid {
+		go r.autoRecord(channelData)
+	}
+
+	var name string
+	if displayName != nil {
+		name = *displayName
+	}
+
+	if !host && channelData.Lobby {
+		return r.enterLobby(ctx, &channelData, name)
+	}
+
+	return r.joinSession(ctx, r.DB, &channelData, host, name)
 }
 
 func (r *queryResolver) Share(ctx context.Context, passphrase string) (*models.ShareResponse, error) {
@@ -497,7 +1058,7 @@ func (r *queryResolver) Share(ctx context.Context, passphrase string) (*models.S
 		return nil, errors.New("Passphrase cannot be empty")
 	}
 
-	err := r.DB.Get(&channelData, "SELECT title, channel_name, channel_secret, host_passphrase, viewer_passphrase, dtmf FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1", passphrase)
+	err := r.DB.Get(&channelData, "SELECT title, channel_name, channel_secret, host_passphrase, viewer_passphrase, dtmf, expires_at, ended_at, lobby FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1 ORDER BY id DESC LIMIT 1", passphrase)
 	if err != nil {
 		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
 		return nil, errors.New("Invalid URL")
@@ -512,39 +1073,12 @@ func (r *queryResolver) Share(ctx context.Context, passphrase string) (*models.S
 		return nil, errors.New("Invalid URL")
 	}
 
-	var hostPassphrase *string
-	if host {
-		hostPassphrase = &channelData.HostPassphrase
-	} else {
-		hostPassphrase = nil
-	}
-
-	var pstnResult *models.Pstn
-	var pstnNumber string
-	if viper.GetString("PSTN_NUMBER") == "" {
-		pstnNumber = "(800) 309-2350"
-	} else {
-		pstnNumber = viper.GetString("PSTN_NUMBER")
+	if reason := channelData.ClosedReason(); reason != "" {
+		r.Logger.Debug().Str("passphrase", passphrase).Str("reason", reason).Msg("Channel is closed")
+		return nil, channelClosedError(reason)
 	}
 
-	if channelData.DTMF != "" {
-		pstnResult = &models.Pstn{
-			Number: pstnNumber,
-			Dtmf:   channelData.DTMF,
-		}
-	} else {
-		pstnResult = nil
-	}
-
-	return &models.ShareResponse{
-		Passphrase: &models.Passphrase{
-			Host: hostPassphrase,
-			View: channelData.ViewerPassphrase,
-		},
-		Channel: channelData.ChannelName,
-		Title:   channelData.Title,
-		Pstn:    pstnResult,
-	}, nil
+	return shareResponse(&channelData, host), nil
 }
 
 func (r *queryResolver) GetUser(ctx context.Context) (*models.User, error) {
@@ -575,14 +1109,437 @@ func (r *queryResolver) GetUser(ctx context.Context) (*models.User, error) {
 	}, nil
 }
 
+func (r *queryResolver) RecordingStatus(ctx context.Context, passphrase string) (*models.RecordingStatus, error) {
+	r.Logger.Info().Str("query", "RecordingStatus").Str("passphrase", passphrase).Msg("")
+
+	if passphrase == "" {
+		return nil, errors.New("Passphrase cannot be empty")
+	}
+
+	var channelData models.Channel
+
+	err := r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase, recording_rid, recording_sid, recording_uid, recording_mode FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1 ORDER BY id DESC LIMIT 1", passphrase)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
+		return nil, errors.New("Invalid URL")
+	}
+
+	if !channelData.RecordingRID.Valid || !channelData.RecordingSID.Valid || !channelData.RecordingUID.Valid {
+		return &models.RecordingStatus{
+			State: models.RecordingStateInactive,
+			Files: []*models.RecordingFile{},
+		}, nil
+	}
+
+	unlock, err := r.DB.LockRecording(ctx, channelData.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channelData.ID).Msg("Could not lock channel recording")
+		return nil, errInternalServer
+	}
+
+	defer unlock()
+
+	// The recording may have been stopped while waiting for the lock
+	err = r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase, recording_rid, recording_sid, recording_uid, recording_mode FROM channels WHERE id = $1", channelData.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channelData.ID).Msg("Could not fetch channel recording")
+		return nil, errInternalServer
+	}
+
+	if !channelData.RecordingRID.Valid || !channelData.RecordingSID.Valid || !channelData.RecordingUID.Valid {
+		return &models.RecordingStatus{
+			State: models.RecordingStateInactive,
+			Files: []*models.RecordingFile{},
+		}, nil
+	}
+
+	result, err := r.existingRecorder(&channelData).Query(ctx)
+	if utils.IsRecordingNotFound(err) {
+		r.Logger.Info().Str("sid", channelData.RecordingSID.String).Msg("Recording session no longer exists")
+		r.endRecording(&channelData, models.RecordingStateStopped, nil)
+
+		return &models.RecordingStatus{
+			State: models.RecordingStateInactive,
+			Files: []*models.RecordingFile{},
+		}, nil
+	} else if err != nil {
+		r.Logger.Error().Err(err).Msg("Query recording failed")
+		return nil, errInternalServer
+	}
+
+	files, err := result.ServerResponse.Files()
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not parse recording file list")
+		return nil, errInternalServer
+	}
+
+	state := recordingState(result.ServerResponse.Status)
+	if state == models.RecordingStateStopped || state == models.RecordingStateFailed {
+		r.endRecording(&channelData, state, files)
+	}
+
+	return &models.RecordingStatus{
+		State:     state,
+		StartedAt: formatSliceTime(result.ServerResponse.SliceStartTime),
+		Files:     recordingFiles(files),
+	}, nil
+}
+
+func (r *queryResolver) Recordings(ctx context.Context, passphrase string) ([]*models.Recording, error) {
+	r.Logger.Info().Str("query", "Recordings").Str("passphrase", passphrase).Msg("")
+
+	if passphrase == "" {
+		return nil, errors.New("Passphrase cannot be empty")
+	}
+
+	var channelData models.Channel
+
+	err := r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1 ORDER BY id DESC LIMIT 1", passphrase)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
+		return nil, errors.New("Invalid URL")
+	}
+
+	if passphrase != channelData.HostPassphrase {
+		r.Logger.Debug().Str("passphrase", passphrase).Str("channel", channelData.ChannelName).Msg("Unauthorized to view recordings")
+		return nil, errors.New("Unauthorised to view recordings")
+	}
+
+	recordingSessions := []models.RecordingSession{}
+	err = r.DB.Select(&recordingSessions, "SELECT id, channel_id, started_by, uid, sid, rid, file_prefix, profile, mode, status, started_at, stopped_at, uploaded_at, files, expires_at, deleted_at FROM recordings WHERE channel_id = $1 AND kind = $2 ORDER BY started_at DESC", channelData.ID, models.RecordingKindRecording)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channelData.ID).Msg("Could not fetch recordings")
+		return nil, errInternalServer
+	}
+
+	recordings := []*models.Recording{}
+	for _, session := range recordingSessions {
+		result, err := recording(&session)
+		if err != nil {
+			r.Logger.Error().Err(err).Str("sid", session.SID).Msg("Could not decode recording files")
+			return nil, errInternalServer
+		}
+
+		recordings = append(recordings, result)
+	}
+
+	return recordings, nil
+}
+
+func (r *queryResolver) RenewCredentials(ctx context.Context, passphrase string, uid int, renewalSecret string) (*models.UserCredentials, error) {
+	r.Logger.Info().Str("query", "RenewCredentials").Str("passphrase", passphrase).Int("uid", uid).Msg("")
+
+	var channelData models.Channel
+	var host bool
+
+	if passphrase == "" {
+		return nil, errors.New("Passphrase cannot be empty")
+	}
+
+	err := r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase, webinar, expires_at, ended_at FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1 ORDER BY id DESC LIMIT 1", passphrase)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
+		return nil, errors.New("Invalid URL")
+	}
+
+	if passphrase == channelData.HostPassphrase {
+		host = true
+	} else if passphrase == channelData.ViewerPassphrase {
+		host = false
+	} else {
+		r.Logger.Debug().Str("passphrase", passphrase).Msg("Invalid Passphrase; Interal Server Error")
+		return nil, errors.New("Invalid URL")
+	}
+
+	if reason := channelData.ClosedReason(); reason != "" {
+		r.Logger.Debug().Str("passphrase", passphrase).Str("reason", reason).Msg("Channel is closed")
+		return nil, channelClosedError(reason)
+	}
+
+	var channelUID models.ChannelUID
+	err = r.DB.Get(&channelUID, "SELECT id, channel_id, uid, kind, account, renewal_hash, issued_at, expires_at FROM channel_uids WHERE channel_id = $1 AND uid = $2", channelData.ID, uid)
+	if err == sql.ErrNoRows {
+		r.Logger.Debug().Int("uid", uid).Str("channel", channelData.ChannelName).Msg("UID was not issued for channel")
+		return nil, errors.New("UID does not belong to channel")
+	} else if err != nil {
+		r.Logger.Error().Err(err).Int("uid", uid).Msg("Could not fetch channel UID")
+		return nil, errInternalServer
+	}
+
+	if channelUID.ExpiresAt.Before(time.Now()) {
+		r.Logger.Debug().Int("uid", uid).Str("channel", channelData.ChannelName).Msg("UID reservation has expired")
+		return nil, errors.New("Credentials have expired, join the channel again")
+	}
+
+	if !models.RenewableUIDKind(channelUID.Kind) {
+		r.Logger.Debug().Int("uid", uid).Str("kind", channelUID.Kind).Msg("UID kind cannot be renewed")
+		return nil, errors.New("Credentials of the UID cannot be renewed")
+	}
+
+	if !channelUID.RenewalHash.Valid || subtle.ConstantTimeCompare([]byte(utils.HashRenewalSecret(renewalSecret)), []byte(channelUID.RenewalHash.String)) != 1 {
+		r.Logger.Debug().Int("uid", uid).Str("channel", channelData.ChannelName).Msg("Invalid renewal secret")
+		return nil, errors.New("Invalid renewal secret")
+	}
+
+	credentialType, role := credentialRole(&channelData, host)
+	rtm := true
+	if channelUID.Kind == models.UIDKindScreenShare {
+		credentialType = utils.CredentialScreenShare
+		rtm = false
+	}
+
+	var credentials *models.UserCredentials
+	if channelUID.Account.Valid {
+		credentials, err = utils.AccountCredentials(channelData.ChannelName, uid, channelUID.Account.String, rtm, credentialType, role)
+	} else {
+		credentials, err = utils.UserCredentials(channelData.ChannelName, uid, rtm, credentialType, role)
+	}
+	if err != nil {
+		r.Logger.Error().Err(err).Int("uid", uid).Msg("Could not renew user credentials")
+		return nil, errInternalServer
+	}
+	credentials.RenewalSecret = &renewalSecret
+
+	err = r.renewUID(&channelUID, credentials)
+	if err != nil {
+		r.Logger.Error().Err(err).Int("uid", uid).Msg("Could not update channel UID")
+		return nil, errInternalServer
+	}
+
+	return credentials, nil
+}
+
+func (r *queryResolver) APIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	r.Logger.Info().Str("query", "APIKeys").Msg("")
+
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		r.Logger.Debug().Msg("Invalid Token")
+		return nil, errors.New("Invalid Token")
+	}
+
+	if !isAdmin(authUser) {
+		r.Logger.Debug().Str("email", authUser.Email).Msg("Unauthorized to manage API keys")
+		return nil, errors.New("Unauthorised to manage API keys")
+	}
+
+	records := []models.APIKeyRecord{}
+	err = r.DB.Select(&records, "SELECT id, name, key_hash, scopes, rate_limit, window_started_at, window_requests, created_by, created_at, last_used_at, revoked_at FROM api_keys ORDER BY created_at DESC")
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not fetch API keys")
+		return nil, errInternalServer
+	}
+
+	keys := []*models.APIKey{}
+	for index := range records {
+		keys = append(keys, apiKey(&records[index]))
+	}
+
+	return keys, nil
+}
+
+func (r *queryResolver) MyChannels(ctx context.Context, first *int, after *string, filter *models.MeetingFilter) (*models.MeetingConnection, error) {
+	r.Logger.Info().Str("query", "MyChannels").Msg("")
+
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		r.Logger.Debug().Msg("Invalid Token")
+		return nil, errors.New("Invalid Token")
+	}
+
+	limit, conditions, args, err := r.channelPage(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter != nil && filter.Title != nil && *filter.Title != "" {
+		args = append(args, *filter.Title)
+		conditions = append(conditions, fmt.Sprintf("strpos(lower(channels.title), lower($%d)) > 0", len(args)+1))
+	}
+
+	if filter != nil && filter.Status != nil {
+		switch *filter.Status {
+		case models.MeetingStatusActive:
+			conditions = append(conditions, "channels.ended_at IS NULL AND (channels.expires_at IS NULL OR channels.expires_at > CURRENT_TIMESTAMP)")
+		case models.MeetingStatusEnded:
+			conditions = append(conditions, "channels.ended_at IS NOT NULL")
+		case models.MeetingStatusExpired:
+			conditions = append(conditions, "channels.ended_at IS NULL AND channels.expires_at <= CURRENT_TIMESTAMP")
+		}
+	}
+
+	// One more channel than requested tells whether there is a next page
+	channels, err := r.listChannels("owner_id", authUser.ID, conditions, args, limit+1)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("user", authUser.ID).Msg("Could not fetch channels")
+		return nil, errInternalServer
+	}
+
+	return meetingConnection(channels, limit), nil
+}
+
+func (r *queryResolver) PastOccurrences(ctx context.Context, passphrase string, first *int, after *string) (*models.MeetingConnection, error) {
+	r.Logger.Info().Str("query", "PastOccurrences").Str("passphrase", passphrase).Msg("")
+
+	series, err := r.DB.SeriesByPassphrase(passphrase)
+	if err != nil {
+		r.Logger.Debug().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
+		return nil, errors.New("Invalid URL")
+	}
+
+	if passphrase != series.HostPassphrase {
+		r.Logger.Debug().Str("passphrase", passphrase).Msg("Passphrase does not have permission to list occurrences")
+		return nil, errBadRequest
+	}
+
+	limit, conditions, args, err := r.channelPage(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	// Occurrences are listed once their channel was opened, the newest first
+	channels, err := r.listChannels("series_id", series.ID, conditions, args, limit+1)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("series", series.ID).Msg("Could not fetch occurrences")
+		return nil, errInternalServer
+	}
+
+	return meetingConnection(channels, limit), nil
+}
+
+func (r *queryResolver) UpcomingOccurrences(ctx context.Context, passphrase string, first *int) ([]*models.Occurrence, error) {
+	r.Logger.Info().Str("query", "UpcomingOccurrences").Str("passphrase", passphrase).Msg("")
+
+	limit := 10
+	if first != nil {
+		limit = *first
+	}
+
+	if limit < 1 || limit > maxPageSize {
+		return nil, fmt.Errorf("First must be between 1 and %d", maxPageSize)
+	}
+
+	series, err := r.DB.SeriesByPassphrase(passphrase)
+	if err != nil {
+		r.Logger.Debug().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
+		return nil, errors.New("Invalid URL")
+	}
+
+	starts, err := utils.UpcomingOccurrences(series, time.Now(), limit)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("series", series.ID).Msg("Could not expand meeting series")
+		return nil, errInternalServer
+	}
+
+	occurrences := []*models.Occurrence{}
+	for _, start := range starts {
+		occurrences = append(occurrences, &models.Occurrence{
+			StartTime: formatTime(start),
+			EndTime:   formatTime(start.Add(time.Duration(series.Duration) * time.Minute)),
+		})
+	}
+
+	return occurrences, nil
+}
+
+func (r *queryResolver) Lobby(ctx context.Context, passphrase string) ([]*models.LobbyParticipant, error) {
+	r.Logger.Info().Str("query", "Lobby").Str("passphrase", passphrase).Msg("")
+
+	channelData, err := r.hostChannel(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	tickets, err := r.DB.LobbyTickets(channelData.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channelData.ID).Msg("Could not fetch lobby")
+		return nil, errInternalServer
+	}
+
+	participants := []*models.LobbyParticipant{}
+	for index := range tickets {
+		participants = append(participants, lobbyParticipant(&tickets[index]))
+	}
+
+	return participants, nil
+}
+
+func (r *subscriptionResolver) LobbyChanged(ctx context.Context, passphrase string) (<-chan *models.LobbyParticipant, error) {
+	r.Logger.Info().Str("subscription", "LobbyChanged").Str("passphrase", passphrase).Msg("")
+
+	channelData, err := r.hostChannel(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := r.Lobby.Subscribe(ctx, channelData.ID)
+	participants := make(chan *models.LobbyParticipant)
+	go func() {
+		defer close(participants)
+
+		for ticket := range changes {
+			select {
+			case participants <- lobbyParticipant(ticket):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return participants, nil
+}
+
+func (r *subscriptionResolver) LobbyTicket(ctx context.Context, ticket string) (<-chan *models.LobbyTicket, error) {
+	r.Logger.Info().Str("subscription", "LobbyTicket").Msg("")
+
+	record, err := r.DB.LobbyTicketByHash(utils.HashLobbyTicket(ticket))
+	if err != nil {
+		r.Logger.Debug().Err(err).Msg("Invalid lobby ticket")
+		return nil, errors.New("Invalid lobby ticket")
+	}
+
+	// The status is read again after subscribing, so that a decision made in between is not missed
+	changes := r.Lobby.Subscribe(ctx, record.ChannelID)
+	record, err = r.DB.LobbyTicketByID(record.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not fetch lobby ticket")
+		return nil, errInternalServer
+	}
+
+	statuses := make(chan *models.LobbyTicket, 1)
+	statuses <- &models.LobbyTicket{Ticket: ticket, Status: record.Status}
+
+	go func() {
+		defer close(statuses)
+
+		for change := range changes {
+			if change.ID != record.ID {
+				continue
+			}
+
+			select {
+			case statuses <- &models.LobbyTicket{Ticket: ticket, Status: change.Status}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return statuses, nil
+}
+
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+// Subscription returns generated.SubscriptionResolver implementation.
+func (r *Resolver) Subscription() generated.SubscriptionResolver { return &subscriptionResolver{r} }
+
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
 
 // !!! WARNING !!!
 // The code below was going to be deleted when updating resolvers. It has been copied here so you have
@@ -0,0 +1,158 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+)
+
+// expectSeries expects the weekly series of the host passphrase to be looked up
+func expectSeries(mock sqlmock.Sqlmock, startTime time.Time, timezone string) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM meeting_series WHERE host_passphrase = $1 OR viewer_passphrase = $1")).WithArgs("host-passphrase").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "owner_id", "title", "host_passphrase", "viewer_passphrase", "dtmf", "storage_destination", "auto_record", "retention_days", "webinar", "user_accounts", "start_time", "duration", "timezone", "recurrence", "lobby"}).
+			AddRow(5, time.Now(), 1, "Weekly sync", "host-passphrase", "viewer-passphrase", "123456", nil, false, nil, false, false, startTime, 60, timezone, "FREQ=WEEKLY;BYDAY=MO", false))
+}
+
+func TestJoinSeriesOpensOccurrenceWithItsOwnChannel(t *testing.T) {
+	c, mock := newCredentialsTest(t)
+
+	// Each join opens the occurrence that can be joined at that time, which gets a new channel
+	channelNames := make([]capturedArg, 2)
+	for index := range channelNames {
+		startTime := time.Now().Add(-time.Duration(index+1) * 7 * 24 * time.Hour)
+		expectSeries(mock, startTime, "UTC")
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO channels")).
+			WithArgs("Weekly sync", &channelNames[index], sqlmock.AnyArg(), "host-passphrase", "viewer-passphrase", "123456", nil, false, nil, false, false, 1, sqlmock.AnyArg(), 60, "UTC", 5, false).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1")).WithArgs("host-passphrase").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title", "channel_name", "channel_secret", "host_passphrase", "viewer_passphrase", "recording_sid", "storage_destination", "auto_record", "retention_days", "webinar", "user_accounts", "expires_at", "ended_at", "start_time", "lobby"}).
+				AddRow(7+index, "Weekly sync", "occurrence", "secret", "host-passphrase", "viewer-passphrase", nil, nil, false, nil, false, false, nil, nil, startTime, false))
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO channel_uids")).WithArgs(7+index, sqlmock.AnyArg(), models.UIDKindMain, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO channel_uids")).WithArgs(7+index, sqlmock.AnyArg(), models.UIDKindScreenShare, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+
+		var response joinChannelResponse
+		err := c.Post(joinChannelQuery, &response, client.Var("passphrase", "host-passphrase"))
+		if err != nil {
+			t.Fatalf("joinChannel failed: %v", err)
+		}
+	}
+
+	first, second := channelNames[0].String(), channelNames[1].String()
+	if len(first) != 32 || len(second) != 32 || first == second {
+		t.Errorf("Occurrences were opened with channels %q and %q, want two new channels", first, second)
+	}
+}
+
+const pastOccurrencesQuery = `query($passphrase: String!) {
+	pastOccurrences(passphrase: $passphrase) {
+		edges { node { channel startTime share { channel passphrase { host view } pstn { dtmf } } } }
+	}
+}`
+
+type pastOccurrencesResponse struct {
+	PastOccurrences struct {
+		Edges []struct {
+			Node struct {
+				Channel   string
+				StartTime string
+				Share     struct {
+					Channel    string
+					Passphrase struct {
+						Host string
+						View string
+					}
+					Pstn struct {
+						Dtmf string
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPastOccurrences(t *testing.T) {
+	c, mock := newCredentialsTest(t)
+
+	seriesStart := time.Date(2026, time.March, 2, 17, 0, 0, 0, time.UTC)
+	expectSeries(mock, seriesStart, "UTC")
+
+	rows := sqlmock.NewRows([]string{"id", "created_at", "title", "channel_name", "host_passphrase", "viewer_passphrase", "dtmf", "expires_at", "ended_at", "start_time", "duration", "timezone", "recurrence", "lobby", "recording_status"})
+	for index, channelName := range []string{"secondoccurrence", "firstoccurrence"} {
+		startTime := seriesStart.Add(time.Duration(1-index) * 7 * 24 * time.Hour)
+		rows.AddRow(8-index, startTime, "Weekly sync", channelName, "host-passphrase", "viewer-passphrase", "123456", nil, startTime.Add(time.Hour), startTime, 60, "UTC", nil, false, nil)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM channels LEFT JOIN recordings ON recordings.sid = channels.recording_sid WHERE channels.series_id = $1")).WithArgs(5).WillReturnRows(rows)
+
+	var response pastOccurrencesResponse
+	err := c.Post(pastOccurrencesQuery, &response, client.Var("passphrase", "host-passphrase"))
+	if err != nil {
+		t.Fatalf("pastOccurrences failed: %v", err)
+	}
+
+	edges := response.PastOccurrences.Edges
+	if len(edges) != 2 {
+		t.Fatalf("Got %d occurrences, want 2", len(edges))
+	}
+
+	if edges[0].Node.Channel != "secondoccurrence" || edges[1].Node.Channel != "firstoccurrence" || edges[0].Node.StartTime != "2026-03-09T17:00:00Z" {
+		t.Errorf("Occurrences are %+v, want the newest first with their own channels", edges)
+	}
+
+	for _, edge := range edges {
+		share := edge.Node.Share
+		if share.Channel != edge.Node.Channel || share.Passphrase.Host != "host-passphrase" || share.Passphrase.View != "viewer-passphrase" || share.Pstn.Dtmf != "123456" {
+			t.Errorf("Occurrence %s is shared as %+v, want the passphrases and DTMF of the series", edge.Node.Channel, share)
+		}
+	}
+}
+
+func TestUpcomingOccurrencesKeepLocalTime(t *testing.T) {
+	c, mock := newCredentialsTest(t)
+
+	// Weekly at 09:00 in Los Angeles, across the start of daylight saving time on the 10th of March 2030
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectSeries(mock, time.Date(2030, time.March, 4, 9, 0, 0, 0, location), "America/Los_Angeles")
+
+	var response struct {
+		UpcomingOccurrences []struct {
+			StartTime string
+			EndTime   string
+		}
+	}
+	err = c.Post(`query($passphrase: String!) { upcomingOccurrences(passphrase: $passphrase, first: 3) { startTime endTime } }`, &response, client.Var("passphrase", "host-passphrase"))
+	if err != nil {
+		t.Fatalf("upcomingOccurrences failed: %v", err)
+	}
+
+	want := [][2]string{
+		{"2030-03-04T17:00:00Z", "2030-03-04T18:00:00Z"},
+		{"2030-03-11T16:00:00Z", "2030-03-11T17:00:00Z"},
+		{"2030-03-18T16:00:00Z", "2030-03-18T17:00:00Z"},
+	}
+	if len(response.UpcomingOccurrences) != len(want) {
+		t.Fatalf("Got %d occurrences, want %d", len(response.UpcomingOccurrences), len(want))
+	}
+
+	for index, occurrence := range response.UpcomingOccurrences {
+		if occurrence.StartTime != want[index][0] || occurrence.EndTime != want[index][1] {
+			t.Errorf("Occurrence %d is %+v, want %v", index, occurrence, want[index])
+		}
+	}
+}
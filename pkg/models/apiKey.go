@@ -0,0 +1,78 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// APIKeyRecord Model is an API key used by other backends to call the REST API.
+// Only the SHA-256 hash of the key is stored.
+type APIKeyRecord struct {
+	ID              int64         `db:"id"`
+	Name            string        `db:"name"`
+	KeyHash         string        `db:"key_hash"`
+	Scopes          string        `db:"scopes"`
+	RateLimit       int           `db:"rate_limit"`
+	WindowStartedAt time.Time     `db:"window_started_at"`
+	WindowRequests  int           `db:"window_requests"`
+	WindowRemaining int           `db:"window_remaining"` // seconds left in the window, only returned by UseAPIKey
+	CreatedBy       sql.NullInt64 `db:"created_by"`
+	CreatedAt       time.Time     `db:"created_at"`
+	LastUsedAt      sql.NullTime  `db:"last_used_at"`
+	RevokedAt       sql.NullTime  `db:"revoked_at"`
+}
+
+// JoinScopes encodes scopes to be stored in the database
+func JoinScopes(scopes []APIKeyScope) string {
+	values := []string{}
+	for _, scope := range scopes {
+		values = append(values, string(scope))
+	}
+
+	return strings.Join(values, " ")
+}
+
+// ScopeList decodes the scopes stored in the database
+func (key *APIKeyRecord) ScopeList() []APIKeyScope {
+	scopes := []APIKeyScope{}
+	for _, scope := range strings.Fields(key.Scopes) {
+		scopes = append(scopes, APIKeyScope(scope))
+	}
+
+	return scopes
+}
+
+// HasScope reports whether the key was granted the scope
+func (key *APIKeyRecord) HasScope(scope APIKeyScope) bool {
+	for _, keyScope := range key.ScopeList() {
+		if keyScope == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UseAPIKey looks up an active API key by its hash and counts the request against the
+// rate limit of the key. Requests are counted in windows of one minute shared by every server,
+// the time left in the window is computed by the database so that it does not depend on the server clock.
+func (db *Database) UseAPIKey(keyHash string) (*APIKeyRecord, error) {
+	var key APIKeyRecord
+	err := db.Get(&key, "UPDATE api_keys SET window_requests = CASE WHEN window_started_at <= CURRENT_TIMESTAMP - INTERVAL '1 minute' THEN 1 ELSE window_requests + 1 END, window_started_at = CASE WHEN window_started_at <= CURRENT_TIMESTAMP - INTERVAL '1 minute' THEN CURRENT_TIMESTAMP ELSE window_started_at END, last_used_at = CURRENT_TIMESTAMP WHERE key_hash = $1 AND revoked_at IS NULL RETURNING id, name, key_hash, scopes, rate_limit, window_started_at, window_requests, CEIL(EXTRACT(EPOCH FROM window_started_at + INTERVAL '1 minute' - CURRENT_TIMESTAMP))::int AS window_remaining, created_by, created_at, last_used_at, revoked_at", keyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
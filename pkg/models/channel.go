@@ -10,18 +10,62 @@
 
 package models
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
+
+// Error codes returned when a channel can no longer be joined
+const (
+	ChannelErrorEnded   = "CHANNEL_ENDED"
+	ChannelErrorExpired = "CHANNEL_EXPIRED"
+	// ChannelErrorNotStarted is returned when joining a scheduled meeting before its early join window
+	ChannelErrorNotStarted = "MEETING_NOT_STARTED"
+)
 
 // Channel Model contains all the details for a particular channel session
 type Channel struct {
-	ID               int64          `db:"id"`
-	Title            string         `db:"title"`
-	ChannelName      string         `db:"channel_name"`
-	ChannelSecret    string         `db:"channel_secret"`
-	HostPassphrase   string         `db:"host_passphrase"`
-	ViewerPassphrase string         `db:"viewer_passphrase"`
-	DTMF             string         `db:"dtmf"`
-	RecordingUID     sql.NullInt32  `db:"recording_uid"`
-	RecordingSID     sql.NullString `db:"recording_sid"`
-	RecordingRID     sql.NullString `db:"recording_rid"`
+	ID                 int64          `db:"id"`
+	CreatedAt          time.Time      `db:"created_at"`
+	OwnerID            sql.NullInt64  `db:"owner_id"`
+	Title              string         `db:"title"`
+	ChannelName        string         `db:"channel_name"`
+	ChannelSecret      string         `db:"channel_secret"`
+	HostPassphrase     string         `db:"host_passphrase"`
+	ViewerPassphrase   string         `db:"viewer_passphrase"`
+	DTMF               string         `db:"dtmf"`
+	RecordingUID       sql.NullInt32  `db:"recording_uid"`
+	RecordingSID       sql.NullString `db:"recording_sid"`
+	RecordingRID       sql.NullString `db:"recording_rid"`
+	RecordingMode      sql.NullString `db:"recording_mode"`
+	StorageDestination sql.NullString `db:"storage_destination"`
+	SnapshotUID        sql.NullInt32  `db:"snapshot_uid"`
+	SnapshotSID        sql.NullString `db:"snapshot_sid"`
+	SnapshotRID        sql.NullString `db:"snapshot_rid"`
+	AutoRecord         bool           `db:"auto_record"`
+	RetentionDays      sql.NullInt32  `db:"retention_days"`
+	Webinar            bool           `db:"webinar"`
+	UserAccounts       bool           `db:"user_accounts"`
+	ExpiresAt          sql.NullTime   `db:"expires_at"`
+	EndedAt            sql.NullTime   `db:"ended_at"`
+	StartTime          sql.NullTime   `db:"start_time"`
+	Duration           sql.NullInt32  `db:"duration"`
+	Timezone           sql.NullString `db:"timezone"`
+	Recurrence         sql.NullString `db:"recurrence"`
+	SeriesID           sql.NullInt64  `db:"series_id"`
+	Lobby              bool           `db:"lobby"`
+}
+
+// ClosedReason returns the error code explaining why the channel can no longer be joined,
+// or an empty string when the meeting has neither been ended by a host nor expired
+func (channel *Channel) ClosedReason() string {
+	if channel.EndedAt.Valid {
+		return ChannelErrorEnded
+	}
+
+	if channel.ExpiresAt.Valid && !channel.ExpiresAt.Time.After(time.Now()) {
+		return ChannelErrorExpired
+	}
+
+	return ""
 }
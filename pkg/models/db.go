@@ -28,3 +28,18 @@ func CreateDB(dbURL string) (*Database, error) {
 
 	return &Database{db}, nil
 }
+
+// Tx is a transaction on the database for the queries that must take effect together
+type Tx struct {
+	*sqlx.Tx
+}
+
+// Transaction begins a transaction, it has no effect unless it is committed
+func (db *Database) Transaction() (*Tx, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{tx}, nil
+}
@@ -0,0 +1,114 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package models
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// LobbyNotifyChannel is the PostgreSQL notification channel on which the IDs of changed lobby tickets are sent
+const LobbyNotifyChannel = "lobby_tickets"
+
+// Error codes returned when a lobby ticket cannot be exchanged for credentials
+const (
+	LobbyErrorPending  = "LOBBY_PENDING"
+	LobbyErrorDenied   = "LOBBY_DENIED"
+	LobbyErrorRedeemed = "LOBBY_TICKET_USED"
+	// LobbyErrorDialIn is returned to calls to channels with a lobby, callers cannot wait to be admitted
+	LobbyErrorDialIn = "LOBBY_DIAL_IN"
+)
+
+// LobbyTicketRecord Model is a participant waiting in the lobby of a channel to be admitted by a host.
+// Only the SHA-256 hash of the ticket handed to the participant is stored.
+type LobbyTicketRecord struct {
+	ID          int64        `db:"id"`
+	ChannelID   int64        `db:"channel_id"`
+	TicketHash  string       `db:"ticket_hash"`
+	DisplayName string       `db:"display_name"`
+	Status      LobbyStatus  `db:"status"`
+	RequestedAt time.Time    `db:"requested_at"`
+	DecidedAt   sql.NullTime `db:"decided_at"`
+	RedeemedAt  sql.NullTime `db:"redeemed_at"`
+}
+
+// lobbyColumns are the columns selected to fill a LobbyTicketRecord
+const lobbyColumns = "id, channel_id, ticket_hash, display_name, status, requested_at, decided_at, redeemed_at"
+
+// CreateLobbyTicket adds a pending participant to the lobby of the channel
+func (db *Database) CreateLobbyTicket(channelID int64, ticketHash string, displayName string) (*LobbyTicketRecord, error) {
+	var ticket LobbyTicketRecord
+	err := db.Get(&ticket, "INSERT INTO lobby_tickets (channel_id, ticket_hash, display_name, status) VALUES ($1, $2, $3, $4) RETURNING "+lobbyColumns, channelID, ticketHash, displayName, LobbyStatusPending)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ticket, nil
+}
+
+// DecideLobbyTicket admits or denies a pending participant of the lobby of the channel
+func (db *Database) DecideLobbyTicket(channelID int64, id int64, status LobbyStatus) (*LobbyTicketRecord, error) {
+	var ticket LobbyTicketRecord
+	err := db.Get(&ticket, "UPDATE lobby_tickets SET status = $3, decided_at = CURRENT_TIMESTAMP WHERE id = $1 AND channel_id = $2 AND status = $4 RETURNING "+lobbyColumns, id, channelID, status, LobbyStatusPending)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ticket, nil
+}
+
+// RedeemLobbyTicket marks an admitted ticket as used. Tickets can only be redeemed once.
+// It is part of the transaction reserving the UIDs of the participant, so the ticket stays valid when they cannot be reserved.
+func (tx *Tx) RedeemLobbyTicket(ticketHash string) (*LobbyTicketRecord, error) {
+	var ticket LobbyTicketRecord
+	err := tx.Get(&ticket, "UPDATE lobby_tickets SET redeemed_at = CURRENT_TIMESTAMP WHERE ticket_hash = $1 AND status = $2 AND redeemed_at IS NULL RETURNING "+lobbyColumns, ticketHash, LobbyStatusAdmitted)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ticket, nil
+}
+
+// LobbyTicketByID fetches a lobby ticket
+func (db *Database) LobbyTicketByID(id int64) (*LobbyTicketRecord, error) {
+	var ticket LobbyTicketRecord
+	err := db.Get(&ticket, "SELECT "+lobbyColumns+" FROM lobby_tickets WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ticket, nil
+}
+
+// LobbyTicketByHash fetches the lobby ticket with the hash
+func (db *Database) LobbyTicketByHash(ticketHash string) (*LobbyTicketRecord, error) {
+	var ticket LobbyTicketRecord
+	err := db.Get(&ticket, "SELECT "+lobbyColumns+" FROM lobby_tickets WHERE ticket_hash = $1", ticketHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ticket, nil
+}
+
+// LobbyTickets fetches the tickets of the lobby of the channel in the order participants arrived
+func (db *Database) LobbyTickets(channelID int64) ([]LobbyTicketRecord, error) {
+	tickets := []LobbyTicketRecord{}
+	err := db.Select(&tickets, "SELECT "+lobbyColumns+" FROM lobby_tickets WHERE channel_id = $1 ORDER BY id", channelID)
+	return tickets, err
+}
+
+// NotifyLobby announces a changed lobby ticket to every server listening on LobbyNotifyChannel
+func (db *Database) NotifyLobby(id int64) error {
+	_, err := db.Exec("SELECT pg_notify($1, $2)", LobbyNotifyChannel, strconv.FormatInt(id, 10))
+	return err
+}
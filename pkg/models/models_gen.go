@@ -2,23 +2,152 @@
 
 package models
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type APIKey struct {
+	ID         int           `json:"id"`
+	Name       string        `json:"name"`
+	Key        *string       `json:"key"`
+	Scopes     []APIKeyScope `json:"scopes"`
+	RateLimit  int           `json:"rateLimit"`
+	CreatedAt  string        `json:"createdAt"`
+	LastUsedAt *string       `json:"lastUsedAt"`
+	RevokedAt  *string       `json:"revokedAt"`
+}
+
+type LayoutRegion struct {
+	UID        int         `json:"uid"`
+	X          int         `json:"x"`
+	Y          int         `json:"y"`
+	Width      int         `json:"width"`
+	Height     int         `json:"height"`
+	Alpha      *float64    `json:"alpha"`
+	RenderMode *RenderMode `json:"renderMode"`
+}
+
+type LobbyParticipant struct {
+	ID          int         `json:"id"`
+	DisplayName string      `json:"displayName"`
+	Status      LobbyStatus `json:"status"`
+	RequestedAt string      `json:"requestedAt"`
+	DecidedAt   *string     `json:"decidedAt"`
+}
+
+type LobbyTicket struct {
+	Ticket string      `json:"ticket"`
+	Status LobbyStatus `json:"status"`
+}
+
+type Meeting struct {
+	ID             int            `json:"id"`
+	Title          string         `json:"title"`
+	Channel        string         `json:"channel"`
+	CreatedAt      string         `json:"createdAt"`
+	ExpiresAt      *string        `json:"expiresAt"`
+	EndedAt        *string        `json:"endedAt"`
+	StartTime      *string        `json:"startTime"`
+	Duration       *int           `json:"duration"`
+	Timezone       *string        `json:"timezone"`
+	Recurrence     *string        `json:"recurrence"`
+	Lobby          bool           `json:"lobby"`
+	Status         MeetingStatus  `json:"status"`
+	Share          *ShareResponse `json:"share"`
+	RecordingState RecordingState `json:"recordingState"`
+}
+
+type MeetingConnection struct {
+	Edges    []*MeetingEdge `json:"edges"`
+	PageInfo *PageInfo      `json:"pageInfo"`
+}
+
+type MeetingEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Meeting `json:"node"`
+}
+
+type MeetingFilter struct {
+	Title  *string        `json:"title"`
+	Status *MeetingStatus `json:"status"`
+}
+
+type MeetingSeries struct {
+	ID         int            `json:"id"`
+	Title      string         `json:"title"`
+	CreatedAt  string         `json:"createdAt"`
+	StartTime  string         `json:"startTime"`
+	Duration   int            `json:"duration"`
+	Timezone   string         `json:"timezone"`
+	Recurrence string         `json:"recurrence"`
+	Lobby      bool           `json:"lobby"`
+	Share      *ShareResponse `json:"share"`
+}
+
+type Occurrence struct {
+	StartTime string `json:"startTime"`
+	EndTime   string `json:"endTime"`
+}
+
 type Pstn struct {
 	Number string `json:"number"`
 	Dtmf   string `json:"dtmf"`
 }
 
+type PageInfo struct {
+	EndCursor   *string `json:"endCursor"`
+	HasNextPage bool    `json:"hasNextPage"`
+}
+
 type Passphrase struct {
 	Host *string `json:"host"`
 	View string  `json:"view"`
 }
 
+type Recording struct {
+	ID         int              `json:"id"`
+	Sid        string           `json:"sid"`
+	State      RecordingState   `json:"state"`
+	FilePrefix string           `json:"filePrefix"`
+	Profile    string           `json:"profile"`
+	Mode       RecordingMode    `json:"mode"`
+	StartedAt  string           `json:"startedAt"`
+	StoppedAt  *string          `json:"stoppedAt"`
+	UploadedAt *string          `json:"uploadedAt"`
+	ExpiresAt  *string          `json:"expiresAt"`
+	DeletedAt  *string          `json:"deletedAt"`
+	Files      []*RecordingFile `json:"files"`
+}
+
+type RecordingFile struct {
+	FileName   string  `json:"fileName"`
+	TrackType  *string `json:"trackType"`
+	UID        *string `json:"uid"`
+	IsPlayable bool    `json:"isPlayable"`
+}
+
+type RecordingLayout struct {
+	Regions         []*LayoutRegion `json:"regions"`
+	BackgroundColor *string         `json:"backgroundColor"`
+	BackgroundImage *string         `json:"backgroundImage"`
+}
+
+type RecordingStatus struct {
+	State     RecordingState   `json:"state"`
+	StartedAt *string          `json:"startedAt"`
+	Files     []*RecordingFile `json:"files"`
+}
+
 type Session struct {
 	Channel     string           `json:"channel"`
 	Title       string           `json:"title"`
 	IsHost      bool             `json:"isHost"`
-	Secret      string           `json:"secret"`
+	Secret      *string          `json:"secret"`
 	MainUser    *UserCredentials `json:"mainUser"`
 	ScreenShare *UserCredentials `json:"screenShare"`
+	Lobby       *LobbyTicket     `json:"lobby"`
 }
 
 type ShareResponse struct {
@@ -33,13 +162,329 @@ type UIDMuteState struct {
 	Mute bool `json:"mute"`
 }
 
+type UpdateChannelInput struct {
+	Title         *string `json:"title"`
+	ExpiresIn     *int    `json:"expiresIn"`
+	AutoRecord    *bool   `json:"autoRecord"`
+	Webinar       *bool   `json:"webinar"`
+	RetentionDays *int    `json:"retentionDays"`
+	Lobby         *bool   `json:"lobby"`
+}
+
 type User struct {
 	Name  string `json:"name"`
 	Email string `json:"email"`
 }
 
 type UserCredentials struct {
-	Rtc string  `json:"rtc"`
-	Rtm *string `json:"rtm"`
-	UID int     `json:"uid"`
+	Rtc           string           `json:"rtc"`
+	Rtm           *string          `json:"rtm"`
+	UID           int              `json:"uid"`
+	Account       *string          `json:"account"`
+	Privileges    []TokenPrivilege `json:"privileges"`
+	ExpiresAt     string           `json:"expiresAt"`
+	RenewalSecret *string          `json:"renewalSecret"`
+}
+
+type APIKeyScope string
+
+const (
+	APIKeyScopeRtcTokens APIKeyScope = "RTC_TOKENS"
+	APIKeyScopeRtmTokens APIKeyScope = "RTM_TOKENS"
+)
+
+var AllAPIKeyScope = []APIKeyScope{
+	APIKeyScopeRtcTokens,
+	APIKeyScopeRtmTokens,
+}
+
+func (e APIKeyScope) IsValid() bool {
+	switch e {
+	case APIKeyScopeRtcTokens, APIKeyScopeRtmTokens:
+		return true
+	}
+	return false
+}
+
+func (e APIKeyScope) String() string {
+	return string(e)
+}
+
+func (e *APIKeyScope) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = APIKeyScope(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid APIKeyScope", str)
+	}
+	return nil
+}
+
+func (e APIKeyScope) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type LobbyStatus string
+
+const (
+	LobbyStatusPending  LobbyStatus = "PENDING"
+	LobbyStatusAdmitted LobbyStatus = "ADMITTED"
+	LobbyStatusDenied   LobbyStatus = "DENIED"
+)
+
+var AllLobbyStatus = []LobbyStatus{
+	LobbyStatusPending,
+	LobbyStatusAdmitted,
+	LobbyStatusDenied,
+}
+
+func (e LobbyStatus) IsValid() bool {
+	switch e {
+	case LobbyStatusPending, LobbyStatusAdmitted, LobbyStatusDenied:
+		return true
+	}
+	return false
+}
+
+func (e LobbyStatus) String() string {
+	return string(e)
+}
+
+func (e *LobbyStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = LobbyStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid LobbyStatus", str)
+	}
+	return nil
+}
+
+func (e LobbyStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type MeetingStatus string
+
+const (
+	MeetingStatusActive  MeetingStatus = "ACTIVE"
+	MeetingStatusEnded   MeetingStatus = "ENDED"
+	MeetingStatusExpired MeetingStatus = "EXPIRED"
+)
+
+var AllMeetingStatus = []MeetingStatus{
+	MeetingStatusActive,
+	MeetingStatusEnded,
+	MeetingStatusExpired,
+}
+
+func (e MeetingStatus) IsValid() bool {
+	switch e {
+	case MeetingStatusActive, MeetingStatusEnded, MeetingStatusExpired:
+		return true
+	}
+	return false
+}
+
+func (e MeetingStatus) String() string {
+	return string(e)
+}
+
+func (e *MeetingStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = MeetingStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid MeetingStatus", str)
+	}
+	return nil
+}
+
+func (e MeetingStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type RecordingMode string
+
+const (
+	RecordingModeMix        RecordingMode = "MIX"
+	RecordingModeIndividual RecordingMode = "INDIVIDUAL"
+)
+
+var AllRecordingMode = []RecordingMode{
+	RecordingModeMix,
+	RecordingModeIndividual,
+}
+
+func (e RecordingMode) IsValid() bool {
+	switch e {
+	case RecordingModeMix, RecordingModeIndividual:
+		return true
+	}
+	return false
+}
+
+func (e RecordingMode) String() string {
+	return string(e)
+}
+
+func (e *RecordingMode) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = RecordingMode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid RecordingMode", str)
+	}
+	return nil
+}
+
+func (e RecordingMode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type RecordingState string
+
+const (
+	RecordingStateInactive  RecordingState = "INACTIVE"
+	RecordingStateStarting  RecordingState = "STARTING"
+	RecordingStateRecording RecordingState = "RECORDING"
+	RecordingStateStopping  RecordingState = "STOPPING"
+	RecordingStateStopped   RecordingState = "STOPPED"
+	RecordingStateFailed    RecordingState = "FAILED"
+)
+
+var AllRecordingState = []RecordingState{
+	RecordingStateInactive,
+	RecordingStateStarting,
+	RecordingStateRecording,
+	RecordingStateStopping,
+	RecordingStateStopped,
+	RecordingStateFailed,
+}
+
+func (e RecordingState) IsValid() bool {
+	switch e {
+	case RecordingStateInactive, RecordingStateStarting, RecordingStateRecording, RecordingStateStopping, RecordingStateStopped, RecordingStateFailed:
+		return true
+	}
+	return false
+}
+
+func (e RecordingState) String() string {
+	return string(e)
+}
+
+func (e *RecordingState) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = RecordingState(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid RecordingState", str)
+	}
+	return nil
+}
+
+func (e RecordingState) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type RenderMode string
+
+const (
+	RenderModeCrop RenderMode = "CROP"
+	RenderModeFit  RenderMode = "FIT"
+)
+
+var AllRenderMode = []RenderMode{
+	RenderModeCrop,
+	RenderModeFit,
+}
+
+func (e RenderMode) IsValid() bool {
+	switch e {
+	case RenderModeCrop, RenderModeFit:
+		return true
+	}
+	return false
+}
+
+func (e RenderMode) String() string {
+	return string(e)
+}
+
+func (e *RenderMode) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = RenderMode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid RenderMode", str)
+	}
+	return nil
+}
+
+func (e RenderMode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type TokenPrivilege string
+
+const (
+	TokenPrivilegeJoinChannel        TokenPrivilege = "JOIN_CHANNEL"
+	TokenPrivilegePublishAudioStream TokenPrivilege = "PUBLISH_AUDIO_STREAM"
+	TokenPrivilegePublishVideoStream TokenPrivilege = "PUBLISH_VIDEO_STREAM"
+	TokenPrivilegePublishDataStream  TokenPrivilege = "PUBLISH_DATA_STREAM"
+)
+
+var AllTokenPrivilege = []TokenPrivilege{
+	TokenPrivilegeJoinChannel,
+	TokenPrivilegePublishAudioStream,
+	TokenPrivilegePublishVideoStream,
+	TokenPrivilegePublishDataStream,
+}
+
+func (e TokenPrivilege) IsValid() bool {
+	switch e {
+	case TokenPrivilegeJoinChannel, TokenPrivilegePublishAudioStream, TokenPrivilegePublishVideoStream, TokenPrivilegePublishDataStream:
+		return true
+	}
+	return false
+}
+
+func (e TokenPrivilege) String() string {
+	return string(e)
+}
+
+func (e *TokenPrivilege) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TokenPrivilege(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TokenPrivilege", str)
+	}
+	return nil
+}
+
+func (e TokenPrivilege) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
@@ -0,0 +1,99 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Kinds of recording sessions. Snapshot sessions capture images and run independently of the recording of the channel.
+const (
+	RecordingKindRecording = "recording"
+	RecordingKindSnapshot  = "snapshot"
+)
+
+// RecordingSession Model contains the details of a single cloud recording of a channel
+type RecordingSession struct {
+	ID                 int64          `db:"id"`
+	ChannelID          int64          `db:"channel_id"`
+	StartedBy          sql.NullInt64  `db:"started_by"`
+	UID                int32          `db:"uid"`
+	SID                string         `db:"sid"`
+	RID                string         `db:"rid"`
+	FilePrefix         string         `db:"file_prefix"`
+	Profile            string         `db:"profile"`
+	Mode               string         `db:"mode"`
+	Kind               string         `db:"kind"`
+	StorageDestination string         `db:"storage_destination"`
+	Status             string         `db:"status"`
+	StartedAt          time.Time      `db:"started_at"`
+	StoppedAt          sql.NullTime   `db:"stopped_at"`
+	UploadedAt         sql.NullTime   `db:"uploaded_at"`
+	Files              sql.NullString `db:"files"`
+	ExpiresAt          sql.NullTime   `db:"expires_at"`
+	DeletedAt          sql.NullTime   `db:"deleted_at"`
+	// RetentionCheckedAt is when the retention worker last failed or declined to delete the expired files
+	RetentionCheckedAt  sql.NullTime   `db:"retention_checked_at"`
+	RetentionSkipReason sql.NullString `db:"retention_skip_reason"`
+}
+
+// EndRecording marks the recording or snapshot session with the given sid as finished and removes it from its channel.
+// A session that has already failed keeps its failed status.
+func (db *Database) EndRecording(sid string, status RecordingState, files sql.NullString) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE recordings SET status = CASE WHEN status = $1 THEN status ELSE $2 END, stopped_at = CURRENT_TIMESTAMP, files = COALESCE($3, files) WHERE sid = $4 AND stopped_at IS NULL", string(RecordingStateFailed), string(status), files, sid)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE channels SET recording_sid = NULL, recording_rid = NULL WHERE recording_sid = $1", sid)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE channels SET snapshot_sid = NULL, snapshot_rid = NULL WHERE snapshot_sid = $1", sid)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// recordingLockNamespace is the first key of the advisory locks taken on channels by LockRecording
+const recordingLockNamespace = 1
+
+// LockRecording serializes the recording operations of a channel across every instance of the backend.
+// It blocks until the lock is free or ctx is cancelled. The returned function releases the lock.
+func (db *Database) LockRecording(ctx context.Context, channelID int64) (func(), error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, $2)", recordingLockNamespace, channelID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return func() {
+		tx.Rollback()
+	}, nil
+}
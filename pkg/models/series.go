@@ -0,0 +1,94 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MeetingSeriesRecord Model is a recurring meeting. Its passphrases and DTMF stay the same for every occurrence,
+// while each occurrence is a separate channel with its own channel name.
+type MeetingSeriesRecord struct {
+	ID                 int64          `db:"id"`
+	CreatedAt          time.Time      `db:"created_at"`
+	OwnerID            sql.NullInt64  `db:"owner_id"`
+	Title              string         `db:"title"`
+	HostPassphrase     string         `db:"host_passphrase"`
+	ViewerPassphrase   string         `db:"viewer_passphrase"`
+	DTMF               string         `db:"dtmf"`
+	StorageDestination sql.NullString `db:"storage_destination"`
+	AutoRecord         bool           `db:"auto_record"`
+	RetentionDays      sql.NullInt32  `db:"retention_days"`
+	Webinar            bool           `db:"webinar"`
+	UserAccounts       bool           `db:"user_accounts"`
+	StartTime          time.Time      `db:"start_time"`
+	Duration           int            `db:"duration"`
+	Timezone           string         `db:"timezone"`
+	Recurrence         string         `db:"recurrence"`
+	Lobby              bool           `db:"lobby"`
+}
+
+// OpenOccurrence creates the channel of the occurrence of the series starting at start unless it already exists
+func (db *Database) OpenOccurrence(series *MeetingSeriesRecord, start time.Time, channelName string, channelSecret string) error {
+	occurrence := &Channel{
+		OwnerID:            series.OwnerID,
+		Title:              series.Title,
+		ChannelName:        channelName,
+		ChannelSecret:      channelSecret,
+		HostPassphrase:     series.HostPassphrase,
+		ViewerPassphrase:   series.ViewerPassphrase,
+		DTMF:               series.DTMF,
+		StorageDestination: series.StorageDestination,
+		AutoRecord:         series.AutoRecord,
+		RetentionDays:      series.RetentionDays,
+		Webinar:            series.Webinar,
+		UserAccounts:       series.UserAccounts,
+		StartTime:          sql.NullTime{Time: start, Valid: true},
+		Duration:           sql.NullInt32{Int32: int32(series.Duration), Valid: true},
+		Timezone:           sql.NullString{String: series.Timezone, Valid: true},
+		SeriesID:           sql.NullInt64{Int64: series.ID, Valid: true},
+		Lobby:              series.Lobby,
+	}
+
+	_, err := db.NamedExec("INSERT INTO channels (title, channel_name, channel_secret, host_passphrase, viewer_passphrase, dtmf, storage_destination, auto_record, retention_days, webinar, user_accounts, owner_id, start_time, duration, timezone, series_id, lobby) VALUES (:title, :channel_name, :channel_secret, :host_passphrase, :viewer_passphrase, :dtmf, :storage_destination, :auto_record, :retention_days, :webinar, :user_accounts, :owner_id, :start_time, :duration, :timezone, :series_id, :lobby) ON CONFLICT (series_id, start_time) DO NOTHING", occurrence)
+	return err
+}
+
+// seriesColumns are the columns selected to fill a MeetingSeriesRecord
+const seriesColumns = "id, created_at, owner_id, title, host_passphrase, viewer_passphrase, dtmf, storage_destination, auto_record, retention_days, webinar, user_accounts, start_time, duration, timezone, recurrence, lobby"
+
+// CreateSeries stores a new meeting series and fills in its ID and creation time
+func (db *Database) CreateSeries(series *MeetingSeriesRecord) error {
+	return db.Get(series, "INSERT INTO meeting_series (owner_id, title, host_passphrase, viewer_passphrase, dtmf, storage_destination, auto_record, retention_days, webinar, user_accounts, start_time, duration, timezone, recurrence, lobby) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING "+seriesColumns, series.OwnerID, series.Title, series.HostPassphrase, series.ViewerPassphrase, series.DTMF, series.StorageDestination, series.AutoRecord, series.RetentionDays, series.Webinar, series.UserAccounts, series.StartTime, series.Duration, series.Timezone, series.Recurrence, series.Lobby)
+}
+
+// SeriesByPassphrase fetches the meeting series with the host or viewer passphrase
+func (db *Database) SeriesByPassphrase(passphrase string) (*MeetingSeriesRecord, error) {
+	var series MeetingSeriesRecord
+	err := db.Get(&series, "SELECT "+seriesColumns+" FROM meeting_series WHERE host_passphrase = $1 OR viewer_passphrase = $1", passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return &series, nil
+}
+
+// SeriesByDTMF fetches the meeting series dialled into with the DTMF
+func (db *Database) SeriesByDTMF(dtmf string) (*MeetingSeriesRecord, error) {
+	var series MeetingSeriesRecord
+	err := db.Get(&series, "SELECT "+seriesColumns+" FROM meeting_series WHERE dtmf = $1", dtmf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &series, nil
+}
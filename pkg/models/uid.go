@@ -0,0 +1,84 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Kinds of UIDs issued to the users of a channel
+const (
+	UIDKindMain        = "main"
+	UIDKindScreenShare = "screen_share"
+	UIDKindPSTN        = "pstn"
+	UIDKindRecording   = "recording"
+)
+
+// maxUIDAttempts is the number of random UIDs tried before giving up on a reservation
+const maxUIDAttempts = 10
+
+// ChannelUID Model is a UID that was issued to a user joining a channel
+type ChannelUID struct {
+	ID        int64          `db:"id"`
+	ChannelID int64          `db:"channel_id"`
+	UID       int            `db:"uid"`
+	Kind      string         `db:"kind"`
+	Account   sql.NullString `db:"account"`
+	IssuedAt  time.Time      `db:"issued_at"`
+	ExpiresAt time.Time      `db:"expires_at"`
+	// RenewalHash is the hash of the secret that the user the UID was issued to renews its credentials with
+	RenewalHash sql.NullString `db:"renewal_hash"`
+}
+
+// RenewableUIDKind reports whether the credentials of UIDs of the kind can be renewed by the user they were issued to
+func RenewableUIDKind(kind string) bool {
+	return kind == UIDKindMain || kind == UIDKindScreenShare
+}
+
+// UIDReserver reserves UIDs in channels, either right away through the Database or as part of a Tx
+type UIDReserver interface {
+	ReserveUID(channelID int64, kind string, account sql.NullString, renewalHash sql.NullString, pick func() int, expiresAt time.Time) (int, error)
+}
+
+// ReserveUID reserves a UID picked by pick that no other user of the channel holds until expiresAt.
+// Reservations of other users are released once they expire, so their UIDs can be picked again.
+// The user account is stored for channels where users join with string user accounts.
+// The renewal hash is only set for UIDs whose credentials can be renewed.
+func (db *Database) ReserveUID(channelID int64, kind string, account sql.NullString, renewalHash sql.NullString, pick func() int, expiresAt time.Time) (int, error) {
+	return reserveUID(db, channelID, kind, account, renewalHash, pick, expiresAt)
+}
+
+// ReserveUID reserves a UID like Database.ReserveUID, which is only held once the transaction is committed
+func (tx *Tx) ReserveUID(channelID int64, kind string, account sql.NullString, renewalHash sql.NullString, pick func() int, expiresAt time.Time) (int, error) {
+	return reserveUID(tx, channelID, kind, account, renewalHash, pick, expiresAt)
+}
+
+func reserveUID(q sqlx.Queryer, channelID int64, kind string, account sql.NullString, renewalHash sql.NullString, pick func() int, expiresAt time.Time) (int, error) {
+	for attempt := 0; attempt < maxUIDAttempts; attempt++ {
+		uid := pick()
+
+		var id int64
+		err := sqlx.Get(q, &id, "INSERT INTO channel_uids (channel_id, uid, kind, account, renewal_hash, expires_at) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (channel_id, uid) DO UPDATE SET kind = EXCLUDED.kind, account = EXCLUDED.account, renewal_hash = EXCLUDED.renewal_hash, issued_at = CURRENT_TIMESTAMP, expires_at = EXCLUDED.expires_at WHERE channel_uids.expires_at < CURRENT_TIMESTAMP RETURNING id", channelID, uid, kind, account, renewalHash, expiresAt)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+
+		return uid, nil
+	}
+
+	return 0, errors.New("Could not find a free UID in the channel")
+}
@@ -0,0 +1,112 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// calendarUIDDomain makes the UID of calendar events globally unique as recommended by RFC 5545
+const calendarUIDDomain = "appbuilder.agora.io"
+
+// Calendar serves the invite of a scheduled meeting as iCalendar file.
+// Both passphrases of the channel are accepted, but the invite only contains the view passphrase.
+func (router *ServiceRouter) Calendar(w http.ResponseWriter, r *http.Request) {
+	passphrase := mux.Vars(r)["passphrase"]
+
+	var channelData models.Channel
+
+	// The invite of a meeting series repeats with the series, not just its current occurrence
+	series, err := router.DB.SeriesByPassphrase(passphrase)
+	if err == nil {
+		channelData = models.Channel{
+			Title:            series.Title,
+			ChannelName:      "series-" + strconv.FormatInt(series.ID, 10),
+			ViewerPassphrase: series.ViewerPassphrase,
+			DTMF:             series.DTMF,
+			StartTime:        sql.NullTime{Time: series.StartTime, Valid: true},
+			Duration:         sql.NullInt32{Int32: int32(series.Duration), Valid: true},
+			Timezone:         sql.NullString{String: series.Timezone, Valid: true},
+			Recurrence:       sql.NullString{String: series.Recurrence, Valid: true},
+			Lobby:            series.Lobby,
+		}
+	} else if err == sql.ErrNoRows {
+		err = router.DB.Get(&channelData, "SELECT title, channel_name, viewer_passphrase, COALESCE(dtmf, '') AS dtmf, expires_at, ended_at, start_time, duration, timezone, recurrence, lobby FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1 ORDER BY id DESC LIMIT 1", passphrase)
+	}
+
+	if err != nil {
+		router.Logger.Debug().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
+		http.Error(w, "Meeting not found", http.StatusNotFound)
+		return
+	}
+
+	if !channelData.StartTime.Valid {
+		http.Error(w, "Meeting is not scheduled", http.StatusNotFound)
+		return
+	}
+
+	if reason := channelData.ClosedReason(); reason != "" {
+		http.Error(w, "Meeting is no longer available", http.StatusGone)
+		return
+	}
+
+	location := time.UTC
+	if channelData.Timezone.Valid {
+		location, err = time.LoadLocation(channelData.Timezone.String)
+		if err != nil {
+			router.Logger.Error().Err(err).Str("timezone", channelData.Timezone.String).Msg("Could not load timezone of the meeting")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var link string
+	if frontendURL := strings.TrimSuffix(viper.GetString("FRONTEND_URL"), "/"); frontendURL != "" {
+		link = frontendURL + "/" + channelData.ViewerPassphrase
+	}
+
+	description := []string{}
+	if link != "" {
+		description = append(description, "Join the meeting: "+link)
+	} else {
+		description = append(description, "Meeting passphrase: "+channelData.ViewerPassphrase)
+	}
+
+	// Calls to channels with a lobby are rejected, so the invite does not advertise them
+	if channelData.DTMF != "" && !channelData.Lobby {
+		description = append(description, "Join by phone: "+viper.GetString("PSTN_NUMBER"), "PIN: "+channelData.DTMF)
+	}
+
+	event := &utils.CalendarEvent{
+		UID:         channelData.ChannelName + "@" + calendarUIDDomain,
+		Title:       channelData.Title,
+		Description: strings.Join(description, "\n"),
+		URL:         link,
+		Start:       channelData.StartTime.Time,
+		Duration:    time.Duration(channelData.Duration.Int32) * time.Minute,
+		Location:    location,
+		Recurrence:  channelData.Recurrence.String,
+		Timestamp:   time.Now(),
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="invite.ics"`)
+	w.Write([]byte(utils.BuildCalendar(event)))
+}
@@ -0,0 +1,86 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+)
+
+// seriesRows returns a weekly meeting series starting on Monday 2 March 2026 at 9:00 in Los Angeles
+func seriesRows(lobby bool) *sqlmock.Rows {
+	location, _ := time.LoadLocation("America/Los_Angeles")
+	return sqlmock.NewRows([]string{"id", "created_at", "owner_id", "title", "host_passphrase", "viewer_passphrase", "dtmf", "storage_destination", "auto_record", "retention_days", "webinar", "user_accounts", "start_time", "duration", "timezone", "recurrence", "lobby"}).
+		AddRow(5, time.Now(), 1, "Standup", "host-passphrase", "viewer-passphrase", "123456", nil, false, nil, false, false, time.Date(2026, time.March, 2, 9, 0, 0, 0, location), 30, "America/Los_Angeles", "FREQ=WEEKLY;BYDAY=MO", lobby)
+}
+
+// channelRows returns a meeting scheduled on Monday 2 March 2026 at 17:00 UTC
+func channelRows(lobby bool) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"title", "channel_name", "viewer_passphrase", "dtmf", "expires_at", "ended_at", "start_time", "duration", "timezone", "recurrence", "lobby"}).
+		AddRow("Review", "review", "viewer-passphrase", "123456", nil, nil, time.Date(2026, time.March, 2, 17, 0, 0, 0, time.UTC), 60, nil, nil, lobby)
+}
+
+// getCalendar requests the invite of the passphrase
+func getCalendar(router *ServiceRouter, passphrase string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/ics/"+passphrase, nil)
+	request = mux.SetURLVars(request, map[string]string{"passphrase": passphrase})
+
+	recorder := httptest.NewRecorder()
+	router.Calendar(recorder, request)
+	return recorder
+}
+
+func TestCalendarOmitsPINOfLobby(t *testing.T) {
+	viper.Set("PSTN_NUMBER", "+1 555 0100")
+	viper.Set("FRONTEND_URL", "")
+
+	for _, test := range []struct {
+		name   string
+		series bool
+		lobby  bool
+	}{
+		{name: "channel", lobby: false},
+		{name: "channel with lobby", lobby: true},
+		{name: "series", series: true, lobby: false},
+		{name: "series with lobby", series: true, lobby: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			router, mock := newTestServiceRouter(t)
+
+			if test.series {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM meeting_series WHERE host_passphrase = $1")).WithArgs("viewer-passphrase").WillReturnRows(seriesRows(test.lobby))
+			} else {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM meeting_series WHERE host_passphrase = $1")).WithArgs("viewer-passphrase").WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(regexp.QuoteMeta("FROM channels WHERE host_passphrase = $1")).WithArgs("viewer-passphrase").WillReturnRows(channelRows(test.lobby))
+			}
+
+			recorder := getCalendar(router, "viewer-passphrase")
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("Calendar returned status %d: %s", recorder.Code, recorder.Body.String())
+			}
+
+			// The description is folded, so the text is compared after unfolding
+			calendar := strings.ReplaceAll(recorder.Body.String(), "\r\n ", "")
+			if pin := strings.Contains(calendar, "PIN: 123456"); pin == test.lobby {
+				t.Errorf("Invite contains the PIN: %v, want %v", pin, !test.lobby)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+// lobbyBufferSize is the number of lobby changes buffered for a slow subscriber before changes are dropped
+const lobbyBufferSize = 16
+
+// lobbyPingInterval is how often the connection of the listener is checked while no notifications arrive
+const lobbyPingInterval = 90 * time.Second
+
+// LobbyBroker delivers changed lobby tickets to the GraphQL subscriptions of this server.
+// Changes are announced through PostgreSQL notifications, so that subscribers are
+// notified no matter which server admitted or denied a participant.
+type LobbyBroker struct {
+	DB          *models.Database
+	Logger      *utils.Logger
+	listener    *pq.Listener
+	mutex       sync.Mutex
+	subscribers map[int64]map[chan *models.LobbyTicketRecord]bool
+}
+
+// NewLobbyBroker creates a LobbyBroker listening for lobby notifications on its own database connection
+func NewLobbyBroker(db *models.Database, logger *utils.Logger, databaseURL string) (*LobbyBroker, error) {
+	listener := pq.NewListener(databaseURL, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Error().Err(err).Msg("Lobby listener connection failed")
+		}
+	})
+
+	err := listener.Listen(models.LobbyNotifyChannel)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return &LobbyBroker{
+		DB:          db,
+		Logger:      logger,
+		listener:    listener,
+		subscribers: map[int64]map[chan *models.LobbyTicketRecord]bool{},
+	}, nil
+}
+
+// Run delivers notifications to the subscribers of the lobby they belong to. It never returns.
+func (b *LobbyBroker) Run() {
+	ticker := time.NewTicker(lobbyPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case notification := <-b.listener.Notify:
+			// A nil notification is sent after the connection was re-established
+			if notification == nil {
+				continue
+			}
+
+			id, err := strconv.ParseInt(notification.Extra, 10, 64)
+			if err != nil {
+				b.Logger.Error().Err(err).Str("payload", notification.Extra).Msg("Invalid lobby notification")
+				continue
+			}
+
+			ticket, err := b.DB.LobbyTicketByID(id)
+			if err != nil {
+				b.Logger.Error().Err(err).Int64("ticket", id).Msg("Could not fetch changed lobby ticket")
+				continue
+			}
+
+			b.publish(ticket)
+		case <-ticker.C:
+			go b.listener.Ping()
+		}
+	}
+}
+
+func (b *LobbyBroker) publish(ticket *models.LobbyTicketRecord) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for subscriber := range b.subscribers[ticket.ChannelID] {
+		select {
+		case subscriber <- ticket:
+		default:
+			b.Logger.Warn().Int64("channel", ticket.ChannelID).Int64("ticket", ticket.ID).Msg("Dropped lobby change for slow subscriber")
+		}
+	}
+}
+
+// Subscribe returns the changed tickets of the lobby of the channel.
+// The returned channel is closed once the context is done.
+func (b *LobbyBroker) Subscribe(ctx context.Context, channelID int64) <-chan *models.LobbyTicketRecord {
+	subscriber := make(chan *models.LobbyTicketRecord, lobbyBufferSize)
+
+	b.mutex.Lock()
+	if b.subscribers[channelID] == nil {
+		b.subscribers[channelID] = map[chan *models.LobbyTicketRecord]bool{}
+	}
+	b.subscribers[channelID][subscriber] = true
+	b.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		delete(b.subscribers[channelID], subscriber)
+		if len(b.subscribers[channelID]) == 0 {
+			delete(b.subscribers, channelID)
+		}
+		close(subscriber)
+	}()
+
+	return subscriber
+}
@@ -11,99 +11,85 @@
 package services
 
 import (
-	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/samyak-jain/agora_backend/pkg/models"
 	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/samyak-jain/agora_backend/utils/rtctoken"
 	"github.com/spf13/viper"
 )
 
-type AuthAccount struct {
-	Email     string `json:"email"`
-	Password  string `json:"password"`
-	PartnerID string `json:"partnerID"`
-	AccountID string `json:"accountID"`
+// PSTNCall is a single phone call that is currently connected to a bridge
+type PSTNCall struct {
+	CallID string
+	UID    string
 }
 
-type BridgeConfig struct {
-	ConferenceID        string `json:"conferenceID"`
-	MinimumParticipants int    `json:"minParticipants"`
-	ExitChimes          string `json:"exitChimes"`
-	ConfigParameterURL  string `json:"confParamsUrl"`
+// PSTNProvider is implemented by every telephony vendor that can dial callers into a channel
+type PSTNProvider interface {
+	// CreateBridge creates a bridge for the conference ID which fetches the channel details from backendURL
+	CreateBridge(ctx context.Context, confID string, backendURL string) error
+	// ListCalls returns all the calls currently connected to the bridge
+	ListCalls(ctx context.Context, confID string) ([]PSTNCall, error)
+	// SetMuteState mutes or unmutes a single call on the bridge
+	SetMuteState(ctx context.Context, confID string, callID string, muteState bool) error
+	// HangUp disconnects a single call from the bridge
+	HangUp(ctx context.Context, confID string, callID string) error
 }
 
-type BridgeRequest struct {
-	SetBridge BridgeConfig `json:"setBridge"`
-}
-
-type PSTNRequest struct {
-	AuthAccount AuthAccount     `json:"authAccount"`
-	RequestList []BridgeRequest `json:"requestList"`
-}
-
-type Request struct {
-	Request PSTNRequest `json:"request"`
-}
+var errCallNotFound = errors.New("No matching UID found")
 
-func CreateBridge(logger *utils.Logger, confID string, backendURL string) {
-	request := Request{
-		Request: PSTNRequest{
-			AuthAccount: AuthAccount{
-				Email:     viper.GetString("PSTN_EMAIL"),
-				Password:  viper.GetString("PSTN_PASSWORD"),
-				PartnerID: "turbobridge",
-				AccountID: viper.GetString("PSTN_ACCOUNT"),
-			},
-			RequestList: []BridgeRequest{
-				{
-					SetBridge: BridgeConfig{
-						ConferenceID:        confID,
-						MinimumParticipants: 1,
-						ExitChimes:          "none",
-						ConfigParameterURL:  backendURL + "/pstn",
-					},
-				},
-			},
-		},
+// NewPSTNProvider returns the PSTN provider configured through PSTN_PROVIDER, whose name is case insensitive
+func NewPSTNProvider(logger *utils.Logger) (PSTNProvider, error) {
+	switch strings.ToLower(viper.GetString("PSTN_PROVIDER")) {
+	case "turbobridge":
+		return NewTurboBridge(logger), nil
+	case "fake":
+		return NewFakePSTN(), nil
+	default:
+		return nil, errors.New("Unknown PSTN provider")
 	}
+}
 
-	requestBody, err := json.Marshal(&request)
+// MutePSTN is a helper method to mute and unmute a PSTN User
+func MutePSTN(ctx context.Context, provider PSTNProvider, uid int, muteState bool, confID string) error {
+	call, err := findCall(ctx, provider, uid, confID)
 	if err != nil {
-		logger.Error().Err(err).Interface("Request", request).Msg("Unable to Marshal JSON")
-		return
+		return err
 	}
 
-	logger.Debug().Str("Create Bridge parameters", string(requestBody)).Msg("Create Bridge")
+	return provider.SetMuteState(ctx, confID, call.CallID, muteState)
+}
 
-	req, err := http.NewRequest("POST", "https://api-dev.turbobridge.com/4.3/Bridge", bytes.NewBuffer(requestBody))
+// HangUpPSTN is a helper method to disconnect a PSTN User
+func HangUpPSTN(ctx context.Context, provider PSTNProvider, uid int, confID string) error {
+	call, err := findCall(ctx, provider, uid, confID)
 	if err != nil {
-		logger.Error().Err(err).Msg("Unable to Create Request")
-		return
+		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	return provider.HangUp(ctx, confID, call.CallID)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func findCall(ctx context.Context, provider PSTNProvider, uid int, confID string) (*PSTNCall, error) {
+	calls, err := provider.ListCalls(ctx, confID)
 	if err != nil {
-		logger.Error().Err(err).Interface("Request", req).Msg("Unable to Create Bridge")
-		return
+		return nil, err
 	}
 
-	defer resp.Body.Close()
-
-	var result map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&result)
-
-	if resp.StatusCode != 200 {
-		logger.Error().Int("Status Code", resp.StatusCode).Interface("Response", result).Msg("Error response in create bridge")
-	} else {
-		logger.Info().Interface("Response", result).Msg("Create Bridge Response")
+	for index := range calls {
+		if calls[index].UID == strconv.Itoa(uid) {
+			return &calls[index], nil
+		}
 	}
 
+	return nil, errCallNotFound
 }
 
 type AgoraFields struct {
@@ -126,20 +112,71 @@ type PSTNResponse struct {
 	CallData CallData    `json:"callDataPerm"`
 }
 
+// PSTNErrorResponse is returned when a call can not join the channel of the conference ID
+type PSTNErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
 func (router *ServiceRouter) PSTN(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	conferenceID := query.Get("confID")
 
 	router.Logger.Debug().Str("Conference ID", conferenceID).Msg("Got conference ID")
 
+	// Calls to a meeting series join its current occurrence
+	series, err := router.DB.SeriesByDTMF(conferenceID)
+	if err == nil {
+		err = utils.OpenCurrentOccurrence(router.DB, series)
+	}
+
+	if err == utils.ErrMeetingNotStarted {
+		router.Logger.Info().Str("Conference ID", conferenceID).Msg("Rejected call to meeting series that has not started")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooEarly)
+		json.NewEncoder(w).Encode(PSTNErrorResponse{
+			Error: "Meeting has not started yet",
+			Code:  models.ChannelErrorNotStarted,
+		})
+		return
+	}
+
+	if err != nil && err != sql.ErrNoRows {
+		router.Logger.Error().Err(err).Str("Conference ID", conferenceID).Msg("Could not open occurrence of meeting series")
+		return
+	}
+
 	var channelData models.Channel
-	err := router.DB.Get(&channelData, "SELECT channel_name, channel_secret FROM channels WHERE dtmf=$1", conferenceID)
+	err = router.DB.Get(&channelData, "SELECT id, channel_name, channel_secret, expires_at, ended_at, lobby FROM channels WHERE dtmf = $1 ORDER BY id DESC LIMIT 1", conferenceID)
 	if err != nil {
 		router.Logger.Error().Err(err).Str("Conference ID", conferenceID).Msg("Could not fetch relevant channel from DB")
 		return
 	}
 
-	user, err := utils.GenerateUserCredentials(channelData.ChannelName, false, true)
+	if reason := channelData.ClosedReason(); reason != "" {
+		router.Logger.Info().Str("Conference ID", conferenceID).Str("reason", reason).Msg("Rejected call to closed channel")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusGone)
+		json.NewEncoder(w).Encode(PSTNErrorResponse{
+			Error: "Meeting is no longer available",
+			Code:  reason,
+		})
+		return
+	}
+
+	// Callers would skip the lobby, since the DTMF is shared with viewers
+	if channelData.Lobby {
+		router.Logger.Info().Str("Conference ID", conferenceID).Msg("Rejected call to channel with a lobby")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(PSTNErrorResponse{
+			Error: "Meeting does not accept calls while the lobby is enabled",
+			Code:  models.LobbyErrorDialIn,
+		})
+		return
+	}
+
+	user, err := utils.ReserveUserCredentials(router.DB, channelData.ID, channelData.ChannelName, models.UIDKindPSTN, "", false, utils.CredentialPSTN, rtctoken.RolePublisher)
 	if err != nil {
 		router.Logger.Error().Err(err).Msg("Could not generate main user credentials")
 		return
@@ -196,204 +233,3 @@ func (router *ServiceRouter) PSTN(w http.ResponseWriter, r *http.Request) {
 
 	json.NewEncoder(w).Encode(response)
 }
-
-type ConferenceInfo struct {
-	ConferenceID string `json:"conferenceID"`
-}
-
-type ConferenceRequest struct {
-	ConferenceInfo ConferenceInfo `json:"getConferenceInfo"`
-}
-
-type GetConferenceRequest struct {
-	AuthAccount AuthAccount         `json:"authAccount"`
-	RequestList []ConferenceRequest `json:"requestList"`
-}
-
-type ConferencePSTNRequest struct {
-	Request GetConferenceRequest `json:"request"`
-}
-
-type CustomData struct {
-	UID string `json:"uid"`
-}
-
-type Call struct {
-	CustomData CustomData `json:"dataPerm"`
-	CallID     string     `json:"callID"`
-}
-
-type Calls struct {
-	Call []Call `json:"call"`
-}
-
-type Conference struct {
-	Calls Calls `json:"calls"`
-}
-
-type Result struct {
-	Conference Conference `json:"conference"`
-}
-
-type RequestItem struct {
-	Result Result `json:"result"`
-}
-
-type ConferenceResponse struct {
-	RequestItem []RequestItem `json:"requestItem"`
-}
-
-type ConferencePSTNResponse struct {
-	Response ConferenceResponse `json:"responseList"`
-}
-
-// MutePSTN is a helper method to mute and unmute a PSTN User
-func MutePSTN(logger *utils.Logger, uid int, muteState bool, confID string) {
-	request := ConferencePSTNRequest{
-		Request: GetConferenceRequest{
-			AuthAccount: AuthAccount{
-				Email:     viper.GetString("PSTN_EMAIL"),
-				Password:  viper.GetString("PSTN_PASSWORD"),
-				PartnerID: "turbobridge",
-				AccountID: viper.GetString("PSTN_ACCOUNT"),
-			},
-			RequestList: []ConferenceRequest{
-				{
-					ConferenceInfo: ConferenceInfo{
-						ConferenceID: confID,
-					},
-				},
-			},
-		},
-	}
-
-	requestBody, err := json.Marshal(&request)
-	if err != nil {
-		logger.Error().Err(err).Interface("Request", request).Msg("Unable to Marshal JSON")
-		return
-	}
-
-	logger.Debug().Str("Conference Info Parameters", string(requestBody)).Msg("Get Conference Info")
-
-	req, err := http.NewRequest("POST", "https://api-dev.turbobridge.com/4.3/LCM", bytes.NewBuffer(requestBody))
-	if err != nil {
-		logger.Error().Err(err).Msg("Unable to Create Request")
-		return
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.Error().Err(err).Interface("Request", req).Msg("Unable to get conference info")
-		return
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		logger.Error().Int("Status Code", resp.StatusCode).Msg("Error response in create bridge")
-		return
-	}
-
-	var result ConferencePSTNResponse
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	if err != nil {
-		logger.Error().Err(err).Msg("Unable to decode JSON response")
-	}
-
-	for _, call := range result.Response.RequestItem[0].Result.Conference.Calls.Call {
-		if call.CustomData.UID == strconv.Itoa(uid) {
-			SetMuteState(logger, call.CallID, confID, muteState)
-			return
-		}
-	}
-
-	logger.Error().Interface("Conference Response", result).Msg("No matching UID found")
-}
-
-type ChangeConferenceCallDetails struct {
-	ConferenceID string `json:"conferenceID"`
-	CallID       string `json:"callID"`
-	Command      string `json:"command"`
-	Value        string `json:"value"`
-}
-
-type ChangeConferenceRequest struct {
-	ChangeConferenceCallDetails ChangeConferenceCallDetails `json:"changeConferenceCall"`
-}
-
-type ChangeConferenceRequestList struct {
-	AuthAccount AuthAccount               `json:"authAccount"`
-	RequestList []ChangeConferenceRequest `json:"requestList"`
-}
-
-type ChangeConferenceCall struct {
-	Request ChangeConferenceRequestList `json:"request"`
-}
-
-func SetMuteState(logger *utils.Logger, callID string, confID string, muteState bool) {
-	var numberMuteState string
-	if muteState {
-		numberMuteState = "1"
-	} else {
-		numberMuteState = "0"
-	}
-
-	request := ChangeConferenceCall{
-		Request: ChangeConferenceRequestList{
-			AuthAccount: AuthAccount{
-				Email:     viper.GetString("PSTN_EMAIL"),
-				Password:  viper.GetString("PSTN_PASSWORD"),
-				PartnerID: "turbobridge",
-				AccountID: viper.GetString("PSTN_ACCOUNT"),
-			},
-			RequestList: []ChangeConferenceRequest{
-				{
-					ChangeConferenceCallDetails: ChangeConferenceCallDetails{
-						ConferenceID: confID,
-						CallID:       callID,
-						Command:      "setMute",
-						Value:        numberMuteState,
-					},
-				},
-			},
-		},
-	}
-
-	requestBody, err := json.Marshal(&request)
-	if err != nil {
-		logger.Error().Err(err).Interface("Request", request).Msg("Unable to Marshal JSON")
-		return
-	}
-
-	logger.Debug().Str("Change Conference parameters", string(requestBody)).Msg("Mute user in conference")
-
-	req, err := http.NewRequest("POST", "https://api-dev.turbobridge.com/4.3/LCM", bytes.NewBuffer(requestBody))
-	if err != nil {
-		logger.Error().Err(err).Msg("Unable to Create Request")
-		return
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.Error().Err(err).Interface("Request", req).Msg("Unable to Change Conference")
-		return
-	}
-
-	defer resp.Body.Close()
-
-	var result map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&result)
-
-	if resp.StatusCode != 200 {
-		logger.Error().Int("Status Code", resp.StatusCode).Interface("Response", result).Msg("Error response in change conference")
-	} else {
-		logger.Info().Interface("Response", result).Msg("Change Conference Response")
-	}
-
-}
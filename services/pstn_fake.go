@@ -0,0 +1,145 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// FakeBridge is the state of a single bridge held by FakePSTN
+type FakeBridge struct {
+	BackendURL string
+	Calls      []PSTNCall
+	Muted      map[string]bool
+}
+
+// FakePSTN is an in-memory PSTN provider for local development and testing
+type FakePSTN struct {
+	mu      sync.Mutex
+	nextID  int
+	Bridges map[string]*FakeBridge
+}
+
+// NewFakePSTN creates an empty in-memory PSTN provider
+func NewFakePSTN() *FakePSTN {
+	return &FakePSTN{
+		Bridges: map[string]*FakeBridge{},
+	}
+}
+
+var errBridgeNotFound = errors.New("Bridge does not exist")
+
+// CreateBridge registers a bridge for the conference ID
+func (f *FakePSTN) CreateBridge(ctx context.Context, confID string, backendURL string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Bridges[confID] = &FakeBridge{
+		BackendURL: backendURL,
+		Calls:      []PSTNCall{},
+		Muted:      map[string]bool{},
+	}
+
+	return nil
+}
+
+// Dial simulates a caller with the given UID joining the bridge and returns the call ID
+func (f *FakePSTN) Dial(confID string, uid int) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bridge, ok := f.Bridges[confID]
+	if !ok {
+		return "", errBridgeNotFound
+	}
+
+	f.nextID++
+	callID := strconv.Itoa(f.nextID)
+	bridge.Calls = append(bridge.Calls, PSTNCall{
+		CallID: callID,
+		UID:    strconv.Itoa(uid),
+	})
+
+	return callID, nil
+}
+
+// ListCalls returns the calls connected to the bridge
+func (f *FakePSTN) ListCalls(ctx context.Context, confID string) ([]PSTNCall, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bridge, ok := f.Bridges[confID]
+	if !ok {
+		return nil, errBridgeNotFound
+	}
+
+	calls := make([]PSTNCall, len(bridge.Calls))
+	copy(calls, bridge.Calls)
+
+	return calls, nil
+}
+
+// SetMuteState records the mute state of a call
+func (f *FakePSTN) SetMuteState(ctx context.Context, confID string, callID string, muteState bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bridge, ok := f.Bridges[confID]
+	if !ok {
+		return errBridgeNotFound
+	}
+
+	for _, call := range bridge.Calls {
+		if call.CallID == callID {
+			bridge.Muted[callID] = muteState
+			return nil
+		}
+	}
+
+	return errCallNotFound
+}
+
+// IsMuted reports whether the call was muted through SetMuteState
+func (f *FakePSTN) IsMuted(confID string, callID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bridge, ok := f.Bridges[confID]
+	if !ok {
+		return false
+	}
+
+	return bridge.Muted[callID]
+}
+
+// HangUp removes a call from the bridge
+func (f *FakePSTN) HangUp(ctx context.Context, confID string, callID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bridge, ok := f.Bridges[confID]
+	if !ok {
+		return errBridgeNotFound
+	}
+
+	for index, call := range bridge.Calls {
+		if call.CallID == callID {
+			bridge.Calls = append(bridge.Calls[:index], bridge.Calls[index+1:]...)
+			delete(bridge.Muted, callID)
+			return nil
+		}
+	}
+
+	return errCallNotFound
+}
@@ -0,0 +1,49 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+)
+
+func TestPSTNRejectsLobbyChannels(t *testing.T) {
+	router, mock := newTestServiceRouter(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM meeting_series WHERE dtmf = $1")).WithArgs("123456").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM channels WHERE dtmf = $1")).WithArgs("123456").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "channel_name", "channel_secret", "expires_at", "ended_at", "lobby"}).
+			AddRow(1, "standup", "secret", nil, nil, true))
+
+	recorder := httptest.NewRecorder()
+	router.PSTN(recorder, httptest.NewRequest(http.MethodGet, "/pstn?confID=123456", nil))
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Call was answered with status %d, want %d", recorder.Code, http.StatusForbidden)
+	}
+
+	var response PSTNErrorResponse
+	err := json.NewDecoder(recorder.Body).Decode(&response)
+	if err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+
+	if response.Code != models.LobbyErrorDialIn {
+		t.Errorf("Error code is %q, want %q", response.Code, models.LobbyErrorDialIn)
+	}
+}
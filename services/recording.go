@@ -0,0 +1,207 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// Product ID and event types sent by the Agora Message Notification Service for Cloud Recording
+const (
+	cloudRecordingProductID = 3
+
+	recordingEventError           = 1
+	recordingEventFileInfos       = 4
+	recordingEventSessionExit     = 11
+	recordingEventUploaded        = 31
+	recordingEventRecorderStarted = 40
+	recordingEventRecorderLeave   = 41
+)
+
+// leaveCodeIdle is set in the leave code when the recorder left because of maxIdleTime
+const leaveCodeIdle = 2
+
+// RecordingNotification is a callback sent by the Agora Message Notification Service
+type RecordingNotification struct {
+	NoticeID  string                     `json:"noticeId"`
+	ProductID int                        `json:"productId"`
+	EventType int                        `json:"eventType"`
+	NotifyMs  int64                      `json:"notifyMs"`
+	Payload   RecordingNotificationEvent `json:"payload"`
+}
+
+// RecordingNotificationEvent contains the details of a cloud recording event
+type RecordingNotificationEvent struct {
+	Cname    string                       `json:"cname"`
+	UID      string                       `json:"uid"`
+	SID      string                       `json:"sid"`
+	Sequence int                          `json:"sequence"`
+	SendTs   int64                        `json:"sendts"`
+	Details  RecordingNotificationDetails `json:"details"`
+}
+
+// RecordingNotificationDetails contains the event specific fields of a cloud recording event
+type RecordingNotificationDetails struct {
+	MsgName    string                      `json:"msgName"`
+	Module     int                         `json:"module"`
+	ErrorCode  int                         `json:"errorCode"`
+	ErrorMsg   string                      `json:"errorMsg"`
+	LeaveCode  int                         `json:"leaveCode"`
+	ExitStatus int                         `json:"exitStatus"`
+	FileList   []RecordingNotificationFile `json:"fileList"`
+}
+
+// RecordingNotificationFile is a single file in the file infos event
+type RecordingNotificationFile struct {
+	FileName       string `json:"fileName"`
+	TrackType      string `json:"trackType"`
+	UID            string `json:"uid"`
+	MixedAllUser   bool   `json:"mixedAllUser"`
+	IsPlayable     bool   `json:"isPlayable"`
+	SliceStartTime int64  `json:"sliceStartTime"`
+}
+
+// verifySignature checks the HMAC of the body against the signature headers sent by Agora
+func verifySignature(r *http.Request, body []byte, secret string) bool {
+	var signature string
+	var hashFunc func() hash.Hash
+
+	if v2 := r.Header.Get("Agora-Signature-V2"); v2 != "" {
+		signature = v2
+		hashFunc = sha256.New
+	} else if v1 := r.Header.Get("Agora-Signature"); v1 != "" {
+		signature = v1
+		hashFunc = sha1.New
+	} else {
+		return false
+	}
+
+	decodedSignature, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(hashFunc, []byte(secret))
+	mac.Write(body)
+
+	return hmac.Equal(decodedSignature, mac.Sum(nil))
+}
+
+// RecordingWebhook is a REST route that receives Cloud Recording events from the Agora Message Notification Service
+func (router *ServiceRouter) RecordingWebhook(w http.ResponseWriter, r *http.Request) {
+	secret := viper.GetString("RECORDING_WEBHOOK_SECRET")
+	if secret == "" {
+		router.Logger.Error().Msg("Recording webhook secret is not configured")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		router.Logger.Error().Err(err).Msg("Could not read recording notification")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !verifySignature(r, body, secret) {
+		router.Logger.Error().Msg("Invalid recording notification signature")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	var notification RecordingNotification
+	err = json.Unmarshal(body, &notification)
+	if err != nil {
+		router.Logger.Error().Err(err).Msg("Could not decode recording notification")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	router.Logger.Info().Interface("Notification", notification).Msg("Recording Notification")
+
+	if notification.ProductID != cloudRecordingProductID || notification.Payload.SID == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	err = router.handleRecordingEvent(&notification)
+	if err != nil {
+		router.Logger.Error().Err(err).Str("Notice ID", notification.NoticeID).Int("Event Type", notification.EventType).Msg("Could not handle recording notification")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (router *ServiceRouter) handleRecordingEvent(notification *RecordingNotification) error {
+	sid := notification.Payload.SID
+	details := notification.Payload.Details
+
+	switch notification.EventType {
+	case recordingEventRecorderStarted:
+		_, err := router.DB.Exec("UPDATE recordings SET status = $1 WHERE sid = $2 AND stopped_at IS NULL", string(models.RecordingStateRecording), sid)
+		return err
+	case recordingEventError:
+		router.Logger.Error().Str("sid", sid).Int("Module", details.Module).Int("Error Code", details.ErrorCode).Str("Error Message", details.ErrorMsg).Msg("Cloud Recording reported an error")
+		_, err := router.DB.Exec("UPDATE recordings SET status = $1 WHERE sid = $2 AND stopped_at IS NULL", string(models.RecordingStateFailed), sid)
+		return err
+	case recordingEventFileInfos:
+		files := []utils.RecordingFile{}
+		for _, file := range details.FileList {
+			files = append(files, utils.RecordingFile{
+				FileName:       file.FileName,
+				TrackType:      file.TrackType,
+				UID:            file.UID,
+				MixedAllUser:   file.MixedAllUser,
+				IsPlayable:     file.IsPlayable,
+				SliceStartTime: file.SliceStartTime,
+			})
+		}
+
+		encodedFiles, err := json.Marshal(files)
+		if err != nil {
+			return err
+		}
+
+		_, err = router.DB.Exec("UPDATE recordings SET files = $1 WHERE sid = $2", string(encodedFiles), sid)
+		return err
+	case recordingEventUploaded:
+		_, err := router.DB.Exec("UPDATE recordings SET uploaded_at = CURRENT_TIMESTAMP WHERE sid = $1", sid)
+		return err
+	case recordingEventRecorderLeave:
+		if details.LeaveCode&leaveCodeIdle != 0 {
+			router.Logger.Info().Str("sid", sid).Str("Channel", notification.Payload.Cname).Msg("Recording stopped because the channel was idle")
+		}
+
+		return router.DB.EndRecording(sid, models.RecordingStateStopped, sql.NullString{})
+	case recordingEventSessionExit:
+		if details.ExitStatus != 0 {
+			return router.DB.EndRecording(sid, models.RecordingStateFailed, sql.NullString{})
+		}
+
+		return router.DB.EndRecording(sid, models.RecordingStateStopped, sql.NullString{})
+	default:
+		return nil
+	}
+}
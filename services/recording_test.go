@@ -0,0 +1,191 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/spf13/viper"
+)
+
+const testWebhookSecret = "webhook-secret"
+
+// sign returns the hexadecimal HMAC of the body with the webhook secret
+func sign(hashFunc func() hash.Hash, secret string, body []byte) string {
+	mac := hmac.New(hashFunc, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// recordingNotification encodes a Cloud Recording notification of the event for the session
+func recordingNotification(t *testing.T, eventType int, details RecordingNotificationDetails) []byte {
+	t.Helper()
+
+	body, err := json.Marshal(RecordingNotification{
+		NoticeID:  "notice",
+		ProductID: cloudRecordingProductID,
+		EventType: eventType,
+		Payload: RecordingNotificationEvent{
+			Cname:   "standup",
+			SID:     "sid",
+			Details: details,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not encode notification: %v", err)
+	}
+
+	return body
+}
+
+// postNotification sends the body to the webhook with the signature headers and returns the status code
+func postNotification(router *ServiceRouter, body []byte, headers map[string]string) int {
+	request := httptest.NewRequest(http.MethodPost, "/recording/webhook", bytes.NewReader(body))
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.RecordingWebhook(recorder, request)
+	return recorder.Code
+}
+
+// expectEndRecording expects the session to be marked as ended with the status
+func expectEndRecording(mock sqlmock.Sqlmock, status models.RecordingState) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE recordings SET status = CASE WHEN status = $1 THEN status ELSE $2 END")).WithArgs(string(models.RecordingStateFailed), string(status), nil, "sid").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE channels SET recording_sid = NULL")).WithArgs("sid").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE channels SET snapshot_sid = NULL")).WithArgs("sid").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+}
+
+func TestRecordingWebhookSignatures(t *testing.T) {
+	viper.Set("RECORDING_WEBHOOK_SECRET", testWebhookSecret)
+	body := recordingNotification(t, recordingEventUploaded, RecordingNotificationDetails{})
+
+	for _, test := range []struct {
+		name       string
+		headers    map[string]string
+		statusCode int
+	}{
+		{name: "v1", headers: map[string]string{"Agora-Signature": sign(sha1.New, testWebhookSecret, body)}, statusCode: http.StatusOK},
+		{name: "v2", headers: map[string]string{"Agora-Signature-V2": sign(sha256.New, testWebhookSecret, body)}, statusCode: http.StatusOK},
+		{name: "missing", headers: map[string]string{}, statusCode: http.StatusForbidden},
+		{name: "not hexadecimal", headers: map[string]string{"Agora-Signature-V2": "signature"}, statusCode: http.StatusForbidden},
+		{name: "wrong secret", headers: map[string]string{"Agora-Signature-V2": sign(sha256.New, "other-secret", body)}, statusCode: http.StatusForbidden},
+		{name: "v1 hash in v2 header", headers: map[string]string{"Agora-Signature-V2": sign(sha1.New, testWebhookSecret, body)}, statusCode: http.StatusForbidden},
+		{name: "bad v2 with good v1", headers: map[string]string{"Agora-Signature": sign(sha1.New, testWebhookSecret, body), "Agora-Signature-V2": sign(sha256.New, "other-secret", body)}, statusCode: http.StatusForbidden},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			router, mock := newTestServiceRouter(t)
+			if test.statusCode == http.StatusOK {
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE recordings SET uploaded_at = CURRENT_TIMESTAMP WHERE sid = $1")).WithArgs("sid").WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			if statusCode := postNotification(router, body, test.headers); statusCode != test.statusCode {
+				t.Errorf("Webhook returned status code %d, want %d", statusCode, test.statusCode)
+			}
+		})
+	}
+}
+
+func TestRecordingWebhookRequiresSecret(t *testing.T) {
+	viper.Set("RECORDING_WEBHOOK_SECRET", "")
+	router, _ := newTestServiceRouter(t)
+
+	// Without a secret anyone could sign notifications with the empty key
+	body := recordingNotification(t, recordingEventUploaded, RecordingNotificationDetails{})
+	if statusCode := postNotification(router, body, map[string]string{"Agora-Signature-V2": sign(sha256.New, "", body)}); statusCode != http.StatusForbidden {
+		t.Errorf("Webhook returned status code %d without a secret, want %d", statusCode, http.StatusForbidden)
+	}
+}
+
+func TestRecordingWebhookEvents(t *testing.T) {
+	viper.Set("RECORDING_WEBHOOK_SECRET", testWebhookSecret)
+
+	for _, test := range []struct {
+		name      string
+		eventType int
+		details   RecordingNotificationDetails
+		expect    func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:      "stopped when the recorder leaves",
+			eventType: recordingEventRecorderLeave,
+			details:   RecordingNotificationDetails{LeaveCode: leaveCodeIdle},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectEndRecording(mock, models.RecordingStateStopped)
+			},
+		},
+		{
+			name:      "stopped when the session exits",
+			eventType: recordingEventSessionExit,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectEndRecording(mock, models.RecordingStateStopped)
+			},
+		},
+		{
+			name:      "failed when the session exits with an error",
+			eventType: recordingEventSessionExit,
+			details:   RecordingNotificationDetails{ExitStatus: 1},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectEndRecording(mock, models.RecordingStateFailed)
+			},
+		},
+		{
+			name:      "failed on an error",
+			eventType: recordingEventError,
+			details:   RecordingNotificationDetails{Module: 2, ErrorCode: 53, ErrorMsg: "upload failed"},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE recordings SET status = $1 WHERE sid = $2 AND stopped_at IS NULL")).WithArgs(string(models.RecordingStateFailed), "sid").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:      "uploaded",
+			eventType: recordingEventUploaded,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE recordings SET uploaded_at = CURRENT_TIMESTAMP WHERE sid = $1")).WithArgs("sid").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:      "file infos",
+			eventType: recordingEventFileInfos,
+			details:   RecordingNotificationDetails{FileList: []RecordingNotificationFile{{FileName: "sid_standup.m3u8", TrackType: "audio_and_video", UID: "0", MixedAllUser: true, IsPlayable: true}}},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE recordings SET files = $1 WHERE sid = $2")).
+					WithArgs(`[{"filename":"sid_standup.m3u8","trackType":"audio_and_video","uid":"0","mixedAllUser":true,"isPlayable":true,"sliceStartTime":0}]`, "sid").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			router, mock := newTestServiceRouter(t)
+			test.expect(mock)
+
+			body := recordingNotification(t, test.eventType, test.details)
+			if statusCode := postNotification(router, body, map[string]string{"Agora-Signature-V2": sign(sha256.New, testWebhookSecret, body)}); statusCode != http.StatusOK {
+				t.Errorf("Webhook returned status code %d, want %d", statusCode, http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// retentionBatchSize is the number of expired recordings handled by a single run of the worker
+const retentionBatchSize = 100
+
+// RetentionWorker periodically deletes the files of recordings whose retention has expired
+type RetentionWorker struct {
+	DB       *models.Database
+	Logger   *utils.Logger
+	Storage  map[string]utils.StorageDestination
+	Client   utils.StorageClient
+	Interval time.Duration
+	// DryRun only logs the files that would be deleted
+	DryRun bool
+
+	// dryRunCursor is the id of the last recording logged by the previous dry run
+	dryRunCursor int64
+}
+
+// errPrefixRetained is returned for expired recordings whose prefix is shared with recordings that have not expired
+var errPrefixRetained = errors.New("Prefix is shared with recordings that have not expired")
+
+// NewRetentionWorker creates a RetentionWorker from RETENTION_INTERVAL and RETENTION_DRY_RUN
+func NewRetentionWorker(db *models.Database, logger *utils.Logger, storage map[string]utils.StorageDestination, client utils.StorageClient) (*RetentionWorker, error) {
+	interval := viper.GetInt("RETENTION_INTERVAL")
+	if interval <= 0 {
+		return nil, errors.New("RETENTION_INTERVAL must be a positive number of minutes")
+	}
+
+	return &RetentionWorker{
+		DB:       db,
+		Logger:   logger,
+		Storage:  storage,
+		Client:   client,
+		Interval: time.Duration(interval) * time.Minute,
+		DryRun:   viper.GetBool("RETENTION_DRY_RUN"),
+	}, nil
+}
+
+// Run deletes expired recordings every interval. It never returns.
+func (w *RetentionWorker) Run() {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		err := w.RunOnce()
+		if err != nil {
+			w.Logger.Error().Err(err).Msg("Retention run failed")
+		}
+
+		<-ticker.C
+	}
+}
+
+// RunOnce deletes the files of the recordings that have expired and marks them as deleted.
+// Recordings that could not be deleted are marked as checked with the reason, and are only retried
+// after the recordings that have not been checked yet, so that they cannot hold up the rest.
+func (w *RetentionWorker) RunOnce() error {
+	if w.DryRun {
+		return w.dryRun()
+	}
+
+	expired := []models.RecordingSession{}
+	err := w.DB.Select(&expired, "SELECT id, channel_id, sid, file_prefix, storage_destination, expires_at FROM recordings WHERE deleted_at IS NULL AND stopped_at IS NOT NULL AND expires_at <= CURRENT_TIMESTAMP ORDER BY retention_checked_at NULLS FIRST, expires_at, id LIMIT $1", retentionBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, recording := range expired {
+		deleteErr := w.deleteRecording(&recording)
+		if deleteErr == nil {
+			continue
+		}
+
+		if deleteErr == errPrefixRetained {
+			w.Logger.Info().Str("sid", recording.SID).Str("prefix", recording.FilePrefix).Msg("Prefix is shared with recordings that have not expired")
+		} else {
+			w.Logger.Error().Err(deleteErr).Str("sid", recording.SID).Str("prefix", recording.FilePrefix).Msg("Could not delete expired recording")
+		}
+
+		_, err = w.DB.Exec("UPDATE recordings SET retention_checked_at = CURRENT_TIMESTAMP, retention_skip_reason = $1 WHERE id = $2", deleteErr.Error(), recording.ID)
+		if err != nil {
+			w.Logger.Error().Err(err).Str("sid", recording.SID).Msg("Could not record retention check")
+		}
+	}
+
+	return nil
+}
+
+// dryRun logs the files of the next page of expired recordings.
+// Nothing is written to the database, so the pages are walked with a cursor and start over once every page has been logged.
+func (w *RetentionWorker) dryRun() error {
+	expired := []models.RecordingSession{}
+	err := w.DB.Select(&expired, "SELECT id, channel_id, sid, file_prefix, storage_destination, expires_at FROM recordings WHERE deleted_at IS NULL AND stopped_at IS NOT NULL AND expires_at <= CURRENT_TIMESTAMP AND id > $1 ORDER BY id LIMIT $2", w.dryRunCursor, retentionBatchSize)
+	if err != nil {
+		return err
+	}
+
+	if len(expired) < retentionBatchSize {
+		w.dryRunCursor = 0
+	} else {
+		w.dryRunCursor = expired[len(expired)-1].ID
+	}
+
+	for _, recording := range expired {
+		err = w.deleteRecording(&recording)
+		if err == errPrefixRetained {
+			w.Logger.Info().Str("sid", recording.SID).Str("prefix", recording.FilePrefix).Msg("Dry run, prefix is shared with recordings that have not expired")
+		} else if err != nil {
+			w.Logger.Error().Err(err).Str("sid", recording.SID).Str("prefix", recording.FilePrefix).Msg("Dry run, could not list expired recording")
+		}
+	}
+
+	return nil
+}
+
+func (w *RetentionWorker) deleteRecording(recording *models.RecordingSession) error {
+	if recording.FilePrefix == "" {
+		return errors.New("Recording has no file prefix")
+	}
+
+	// Prefixes built from templates without a unique placeholder can be shared by several recordings,
+	// the files are only deleted once every recording using the prefix has expired
+	var retained int
+	err := w.DB.Get(&retained, "SELECT COUNT(*) FROM recordings WHERE file_prefix = $1 AND storage_destination = $2 AND deleted_at IS NULL AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)", recording.FilePrefix, recording.StorageDestination)
+	if err != nil {
+		return err
+	}
+
+	if retained > 0 {
+		return errPrefixRetained
+	}
+
+	destination, ok := w.Storage[recording.StorageDestination]
+	if !ok {
+		return errors.New("Storage destination " + recording.StorageDestination + " is no longer configured")
+	}
+
+	keys, err := w.Client.List(&destination, recording.FilePrefix+"/")
+	if err != nil {
+		return err
+	}
+
+	if w.DryRun {
+		w.Logger.Info().Str("sid", recording.SID).Str("prefix", recording.FilePrefix).Strs("keys", keys).Msg("Dry run, expired recording files would be deleted")
+		return nil
+	}
+
+	err = w.Client.Delete(&destination, keys)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.DB.Exec("UPDATE recordings SET deleted_at = CURRENT_TIMESTAMP WHERE file_prefix = $1 AND storage_destination = $2 AND deleted_at IS NULL AND expires_at <= CURRENT_TIMESTAMP", recording.FilePrefix, recording.StorageDestination)
+	if err != nil {
+		return err
+	}
+
+	w.Logger.Info().Str("sid", recording.SID).Str("prefix", recording.FilePrefix).Int("objects", len(keys)).Msg("Deleted expired recording")
+
+	return nil
+}
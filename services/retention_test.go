@@ -0,0 +1,148 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+// stubStorage lists the same keys under every prefix and records the deleted keys
+type stubStorage struct {
+	keys    []string
+	listErr error
+	deleted []string
+}
+
+func (s *stubStorage) List(destination *utils.StorageDestination, prefix string) ([]string, error) {
+	return s.keys, s.listErr
+}
+
+func (s *stubStorage) Delete(destination *utils.StorageDestination, keys []string) error {
+	s.deleted = append(s.deleted, keys...)
+	return nil
+}
+
+func newTestRetentionWorker(t *testing.T, storage *stubStorage) (*RetentionWorker, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Could not create mock database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+
+		db.Close()
+	})
+
+	logger := zerolog.Nop()
+
+	return &RetentionWorker{
+		DB:     &models.Database{DB: sqlx.NewDb(db, "postgres")},
+		Logger: &utils.Logger{Logger: &logger},
+		Storage: map[string]utils.StorageDestination{
+			utils.DefaultStorageDestination: {Vendor: utils.StorageVendorAWS, Bucket: "recordings"},
+		},
+		Client:   storage,
+		Interval: time.Minute,
+	}, mock
+}
+
+func expiredRows(ids ...int64) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "channel_id", "sid", "file_prefix", "storage_destination", "expires_at"})
+	for _, id := range ids {
+		rows.AddRow(id, 1, "sid", "prefix", utils.DefaultStorageDestination, time.Now())
+	}
+
+	return rows
+}
+
+func TestRunOnceMarksSkippedRecordings(t *testing.T) {
+	storage := &stubStorage{listErr: errors.New("Access denied")}
+	worker, mock := newTestRetentionWorker(t, storage)
+
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY retention_checked_at NULLS FIRST, expires_at, id LIMIT $1")).WithArgs(retentionBatchSize).WillReturnRows(expiredRows(1, 2))
+
+	// The prefix of the first recording is still used by a recording that has not expired
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM recordings")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE recordings SET retention_checked_at = CURRENT_TIMESTAMP, retention_skip_reason = $1 WHERE id = $2")).WithArgs(errPrefixRetained.Error(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// The files of the second recording cannot be listed
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM recordings")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE recordings SET retention_checked_at = CURRENT_TIMESTAMP, retention_skip_reason = $1 WHERE id = $2")).WithArgs("Access denied", 2).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := worker.RunOnce()
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+}
+
+func TestRunOnceDeletesExpiredRecordings(t *testing.T) {
+	storage := &stubStorage{keys: []string{"prefix/a.m3u8", "prefix/a.ts"}}
+	worker, mock := newTestRetentionWorker(t, storage)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM recordings WHERE deleted_at IS NULL")).WithArgs(retentionBatchSize).WillReturnRows(expiredRows(1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM recordings")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE recordings SET deleted_at = CURRENT_TIMESTAMP")).WithArgs("prefix", utils.DefaultStorageDestination).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := worker.RunOnce()
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+
+	if len(storage.deleted) != 2 {
+		t.Errorf("Deleted %v, want both files", storage.deleted)
+	}
+}
+
+func TestDryRunPagesWithCursor(t *testing.T) {
+	storage := &stubStorage{keys: []string{"prefix/a.m3u8"}}
+	worker, mock := newTestRetentionWorker(t, storage)
+	worker.DryRun = true
+
+	fullPage := make([]int64, retentionBatchSize)
+	for index := range fullPage {
+		fullPage[index] = int64(index + 1)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("AND id > $1 ORDER BY id LIMIT $2")).WithArgs(0, retentionBatchSize).WillReturnRows(expiredRows(fullPage...))
+	for range fullPage {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM recordings")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	}
+
+	// The next run continues after the last recording of the full page and starts over once it reaches the end
+	mock.ExpectQuery(regexp.QuoteMeta("AND id > $1 ORDER BY id LIMIT $2")).WithArgs(retentionBatchSize, retentionBatchSize).WillReturnRows(expiredRows(retentionBatchSize + 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM recordings")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("AND id > $1 ORDER BY id LIMIT $2")).WithArgs(0, retentionBatchSize).WillReturnRows(expiredRows())
+
+	for run := 0; run < 3; run++ {
+		err := worker.RunOnce()
+		if err != nil {
+			t.Fatalf("RunOnce failed: %v", err)
+		}
+	}
+
+	if len(storage.deleted) != 0 {
+		t.Errorf("Dry run deleted %v", storage.deleted)
+	}
+}
@@ -0,0 +1,225 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/samyak-jain/agora_backend/utils/rtctoken"
+	"github.com/spf13/viper"
+)
+
+// apiKeyHeader is the header carrying the API key of requests to the token API
+const apiKeyHeader = "X-API-Key"
+
+type apiKeyContextKey struct{}
+
+// RtcTokenRequest is the body of a request to /v1/tokens/rtc, either a UID or a user account must be set
+type RtcTokenRequest struct {
+	Channel string `json:"channel"`
+	UID     *int   `json:"uid"`
+	Account string `json:"account"`
+	Role    string `json:"role"`
+	TTL     int    `json:"ttl"`
+}
+
+// RtmTokenRequest is the body of a request to /v1/tokens/rtm
+type RtmTokenRequest struct {
+	User string `json:"user"`
+	TTL  int    `json:"ttl"`
+}
+
+// TokenResponse is returned by the token API
+type TokenResponse struct {
+	Token     string `json:"token"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// TokenErrorResponse is returned by the token API when a request fails
+type TokenErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeTokenResponse(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func writeTokenError(w http.ResponseWriter, status int, message string) {
+	writeTokenResponse(w, status, TokenErrorResponse{Error: message})
+}
+
+// RequireAPIKey authenticates requests with an API key that was granted the scope and enforces its rate limit
+func (router *ServiceRouter) RequireAPIKey(scope models.APIKeyScope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(apiKeyHeader)
+		if key == "" {
+			writeTokenError(w, http.StatusUnauthorized, "Missing API key")
+			return
+		}
+
+		apiKey, err := router.DB.UseAPIKey(utils.HashAPIKey(key))
+		if err == sql.ErrNoRows {
+			router.Logger.Debug().Msg("Invalid API key")
+			writeTokenError(w, http.StatusUnauthorized, "Invalid API key")
+			return
+		} else if err != nil {
+			router.Logger.Error().Err(err).Msg("Could not fetch API key")
+			writeTokenError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		if !apiKey.HasScope(scope) {
+			router.Logger.Debug().Int64("key", apiKey.ID).Str("scope", string(scope)).Msg("API key is missing scope")
+			writeTokenError(w, http.StatusForbidden, "API key is not allowed to use this endpoint")
+			return
+		}
+
+		if apiKey.WindowRequests > apiKey.RateLimit {
+			retryAfter := apiKey.WindowRemaining
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeTokenError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, apiKey)))
+	}
+}
+
+// tokenExpiry returns the expiry of a token requested with the given TTL in seconds
+func tokenExpiry(ttl int) (time.Time, bool) {
+	if ttl == 0 {
+		ttl = viper.GetInt("TOKEN_API_DEFAULT_TTL")
+	}
+
+	if ttl < 1 || ttl > viper.GetInt("TOKEN_API_MAX_TTL") {
+		return time.Time{}, false
+	}
+
+	return time.Now().UTC().Add(time.Duration(ttl) * time.Second), true
+}
+
+func parseRole(role string) (rtctoken.Role, bool) {
+	switch strings.ToLower(role) {
+	case "", "publisher":
+		return rtctoken.RolePublisher, true
+	case "subscriber":
+		return rtctoken.RoleSubscriber, true
+	default:
+		return 0, false
+	}
+}
+
+// RtcToken is a REST route that generates a RTC token for a UID or user account
+func (router *ServiceRouter) RtcToken(w http.ResponseWriter, r *http.Request) {
+	var request RtcTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeTokenError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if request.Channel == "" {
+		writeTokenError(w, http.StatusBadRequest, "Channel cannot be empty")
+		return
+	}
+
+	if (request.UID == nil) == (request.Account == "") {
+		writeTokenError(w, http.StatusBadRequest, "Either uid or account must be set")
+		return
+	}
+
+	if request.UID != nil && (*request.UID < 0 || int64(*request.UID) > int64(^uint32(0))) {
+		writeTokenError(w, http.StatusBadRequest, "Invalid uid")
+		return
+	}
+
+	role, ok := parseRole(request.Role)
+	if !ok {
+		writeTokenError(w, http.StatusBadRequest, "Role must be publisher or subscriber")
+		return
+	}
+
+	expiresAt, ok := tokenExpiry(request.TTL)
+	if !ok {
+		writeTokenError(w, http.StatusBadRequest, "Invalid ttl")
+		return
+	}
+
+	var token string
+	if request.UID != nil {
+		token, err = utils.GetRtcToken(request.Channel, *request.UID, role, uint32(expiresAt.Unix()))
+	} else {
+		token, err = utils.GetRtcTokenWithAccount(request.Channel, request.Account, role, uint32(expiresAt.Unix()))
+	}
+	if err != nil {
+		router.Logger.Error().Err(err).Str("channel", request.Channel).Msg("Could not generate RTC token")
+		writeTokenError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	apiKey := r.Context().Value(apiKeyContextKey{}).(*models.APIKeyRecord)
+	router.Logger.Info().Int64("key", apiKey.ID).Str("channel", request.Channel).Msg("Issued RTC token")
+
+	writeTokenResponse(w, http.StatusOK, TokenResponse{
+		Token:     token,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+	})
+}
+
+// RtmToken is a REST route that generates a RTM token for a user
+func (router *ServiceRouter) RtmToken(w http.ResponseWriter, r *http.Request) {
+	var request RtmTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeTokenError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if request.User == "" {
+		writeTokenError(w, http.StatusBadRequest, "User cannot be empty")
+		return
+	}
+
+	expiresAt, ok := tokenExpiry(request.TTL)
+	if !ok {
+		writeTokenError(w, http.StatusBadRequest, "Invalid ttl")
+		return
+	}
+
+	token, err := utils.GetRtmToken(request.User, uint32(expiresAt.Unix()))
+	if err != nil {
+		router.Logger.Error().Err(err).Str("user", request.User).Msg("Could not generate RTM token")
+		writeTokenError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	apiKey := r.Context().Value(apiKeyContextKey{}).(*models.APIKeyRecord)
+	router.Logger.Info().Int64("key", apiKey.ID).Str("user", request.User).Msg("Issued RTM token")
+
+	writeTokenResponse(w, http.StatusOK, TokenResponse{
+		Token:     token,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+	})
+}
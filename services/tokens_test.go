@@ -0,0 +1,228 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+const testAPIKey = "test-api-key"
+
+// apiKeyWindow is the state of the rate limit window returned by the UPDATE counting a request
+type apiKeyWindow struct {
+	requests  int
+	remaining int
+}
+
+func newTokensTest(t *testing.T) (*ServiceRouter, sqlmock.Sqlmock) {
+	t.Helper()
+
+	utils.SetDefaults()
+	viper.Set("APP_ID", "970CA35de60c44645bbae8a215061b33")
+	viper.Set("APP_CERTIFICATE", "5CFd2fd1755d40ecb72977518be15d3b")
+
+	return newTestServiceRouter(t)
+}
+
+// expectUseAPIKey expects the request to be counted against a key with a rate limit of 10 requests
+func expectUseAPIKey(mock sqlmock.Sqlmock, scopes string, window apiKeyWindow) {
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE api_keys SET window_requests")).WithArgs(utils.HashAPIKey(testAPIKey)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "key_hash", "scopes", "rate_limit", "window_started_at", "window_requests", "window_remaining", "created_by", "created_at", "last_used_at", "revoked_at"}).
+			AddRow(3, "Backend", utils.HashAPIKey(testAPIKey), scopes, 10, time.Now(), window.requests, window.remaining, 1, time.Now(), time.Now(), nil))
+}
+
+// postToken posts the body to the token route behind the API key check and returns the response
+func postToken(router *ServiceRouter, scope models.APIKeyScope, route http.HandlerFunc, key string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/v1/tokens", strings.NewReader(body))
+	if key != "" {
+		request.Header.Set(apiKeyHeader, key)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.RequireAPIKey(scope, route)(recorder, request)
+	return recorder
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		scopes     string
+		window     apiKeyWindow
+		keyMissing bool
+		status     int
+		retryAfter string
+	}{
+		{name: "missing key", status: http.StatusUnauthorized},
+		{name: "unknown or revoked key", key: testAPIKey, keyMissing: true, status: http.StatusUnauthorized},
+		{name: "key without scope", key: testAPIKey, scopes: "RTM_TOKENS", window: apiKeyWindow{requests: 1, remaining: 60}, status: http.StatusForbidden},
+		{name: "at rate limit", key: testAPIKey, scopes: "RTC_TOKENS RTM_TOKENS", window: apiKeyWindow{requests: 10, remaining: 12}, status: http.StatusOK},
+		{name: "over rate limit", key: testAPIKey, scopes: "RTC_TOKENS", window: apiKeyWindow{requests: 11, remaining: 12}, status: http.StatusTooManyRequests, retryAfter: "12"},
+		{name: "over rate limit as window ends", key: testAPIKey, scopes: "RTC_TOKENS", window: apiKeyWindow{requests: 11, remaining: 0}, status: http.StatusTooManyRequests, retryAfter: "1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router, mock := newTokensTest(t)
+
+			if test.keyMissing {
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE api_keys SET window_requests")).WithArgs(utils.HashAPIKey(testAPIKey)).WillReturnError(sql.ErrNoRows)
+			} else if test.key != "" {
+				expectUseAPIKey(mock, test.scopes, test.window)
+			}
+
+			recorder := postToken(router, models.APIKeyScopeRtcTokens, router.RtcToken, test.key, `{"channel": "standup", "uid": 42}`)
+			if recorder.Code != test.status {
+				t.Errorf("Request was answered with status %d, want %d: %s", recorder.Code, test.status, recorder.Body)
+			}
+
+			if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != test.retryAfter {
+				t.Errorf("Retry-After is %q, want %q", retryAfter, test.retryAfter)
+			}
+		})
+	}
+}
+
+func TestRequireAPIKeyAcceptsRequestsOnceWindowResets(t *testing.T) {
+	router, mock := newTokensTest(t)
+
+	// The UPDATE starts a new window once the previous one is a minute old, counting the request as the first of it
+	expectUseAPIKey(mock, "RTM_TOKENS", apiKeyWindow{requests: 11, remaining: 1})
+	expectUseAPIKey(mock, "RTM_TOKENS", apiKeyWindow{requests: 1, remaining: 60})
+
+	recorder := postToken(router, models.APIKeyScopeRtmTokens, router.RtmToken, testAPIKey, `{"user": "alice"}`)
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("Request over the rate limit was answered with status %d", recorder.Code)
+	}
+
+	recorder = postToken(router, models.APIKeyScopeRtmTokens, router.RtmToken, testAPIKey, `{"user": "alice"}`)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Request in a new window was answered with status %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestRtcToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "uid", body: `{"channel": "standup", "uid": 42}`, status: http.StatusOK},
+		{name: "account", body: `{"channel": "standup", "account": "alice", "role": "subscriber"}`, status: http.StatusOK},
+		{name: "largest uid", body: `{"channel": "standup", "uid": 4294967295}`, status: http.StatusOK},
+		{name: "uid and account", body: `{"channel": "standup", "uid": 42, "account": "alice"}`, status: http.StatusBadRequest},
+		{name: "neither uid nor account", body: `{"channel": "standup"}`, status: http.StatusBadRequest},
+		{name: "uid above uint32", body: `{"channel": "standup", "uid": 4294967296}`, status: http.StatusBadRequest},
+		{name: "negative uid", body: `{"channel": "standup", "uid": -1}`, status: http.StatusBadRequest},
+		{name: "missing channel", body: `{"uid": 42}`, status: http.StatusBadRequest},
+		{name: "unknown role", body: `{"channel": "standup", "uid": 42, "role": "admin"}`, status: http.StatusBadRequest},
+		{name: "default ttl", body: `{"channel": "standup", "uid": 42, "ttl": 0}`, status: http.StatusOK},
+		{name: "maximum ttl", body: `{"channel": "standup", "uid": 42, "ttl": 86400}`, status: http.StatusOK},
+		{name: "negative ttl", body: `{"channel": "standup", "uid": 42, "ttl": -1}`, status: http.StatusBadRequest},
+		{name: "ttl above maximum", body: `{"channel": "standup", "uid": 42, "ttl": 86401}`, status: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router, mock := newTokensTest(t)
+			expectUseAPIKey(mock, "RTC_TOKENS", apiKeyWindow{requests: 1, remaining: 60})
+
+			recorder := postToken(router, models.APIKeyScopeRtcTokens, router.RtcToken, testAPIKey, test.body)
+			if recorder.Code != test.status {
+				t.Fatalf("Request was answered with status %d, want %d: %s", recorder.Code, test.status, recorder.Body)
+			}
+
+			if test.status != http.StatusOK {
+				return
+			}
+
+			var response TokenResponse
+			err := json.NewDecoder(recorder.Body).Decode(&response)
+			if err != nil {
+				t.Fatalf("Could not decode response: %v", err)
+			}
+
+			if !strings.HasPrefix(response.Token, "006") {
+				t.Errorf("Token is %q, want a 006 token", response.Token)
+			}
+
+			expiresAt, err := time.Parse(time.RFC3339, response.ExpiresAt)
+			if err != nil {
+				t.Fatalf("Could not parse expiry %q: %v", response.ExpiresAt, err)
+			}
+
+			if expiresAt.Before(time.Now()) || expiresAt.After(time.Now().Add(24*time.Hour+time.Minute)) {
+				t.Errorf("Token expires at %s", response.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestRtcTokenDefaultTTL(t *testing.T) {
+	router, mock := newTokensTest(t)
+	expectUseAPIKey(mock, "RTC_TOKENS", apiKeyWindow{requests: 1, remaining: 60})
+
+	recorder := postToken(router, models.APIKeyScopeRtcTokens, router.RtcToken, testAPIKey, `{"channel": "standup", "uid": 42}`)
+
+	var response TokenResponse
+	err := json.NewDecoder(recorder.Body).Decode(&response)
+	if err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, response.ExpiresAt)
+	if err != nil {
+		t.Fatalf("Could not parse expiry %q: %v", response.ExpiresAt, err)
+	}
+
+	want := time.Now().Add(time.Duration(viper.GetInt("TOKEN_API_DEFAULT_TTL")) * time.Second)
+	if diff := expiresAt.Sub(want); diff < -time.Minute || diff > time.Minute {
+		t.Errorf("Token expires at %s, want about %s", expiresAt, want)
+	}
+}
+
+func TestRtmToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "user", body: `{"user": "alice"}`, status: http.StatusOK},
+		{name: "maximum ttl", body: `{"user": "alice", "ttl": 86400}`, status: http.StatusOK},
+		{name: "missing user", body: `{"ttl": 60}`, status: http.StatusBadRequest},
+		{name: "negative ttl", body: `{"user": "alice", "ttl": -1}`, status: http.StatusBadRequest},
+		{name: "ttl above maximum", body: `{"user": "alice", "ttl": 86401}`, status: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router, mock := newTokensTest(t)
+			expectUseAPIKey(mock, "RTM_TOKENS", apiKeyWindow{requests: 1, remaining: 60})
+
+			recorder := postToken(router, models.APIKeyScopeRtmTokens, router.RtmToken, testAPIKey, test.body)
+			if recorder.Code != test.status {
+				t.Errorf("Request was answered with status %d, want %d: %s", recorder.Code, test.status, recorder.Body)
+			}
+		})
+	}
+}
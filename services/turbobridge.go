@@ -0,0 +1,295 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// TurboBridge is the PSTN provider backed by the TurboBridge API
+type TurboBridge struct {
+	Client    *http.Client
+	BaseURL   string
+	Email     string
+	Password  string
+	AccountID string
+	Logger    *utils.Logger
+}
+
+// NewTurboBridge creates a TurboBridge provider from the PSTN configuration.
+// Requests time out after PSTN_TIMEOUT so that a slow TurboBridge cannot hold up channel creation.
+func NewTurboBridge(logger *utils.Logger) *TurboBridge {
+	return &TurboBridge{
+		Client: &http.Client{
+			Timeout: time.Duration(viper.GetInt("PSTN_TIMEOUT")) * time.Second,
+		},
+		BaseURL:   strings.TrimSuffix(viper.GetString("PSTN_BASE_URL"), "/"),
+		Email:     viper.GetString("PSTN_EMAIL"),
+		Password:  viper.GetString("PSTN_PASSWORD"),
+		AccountID: viper.GetString("PSTN_ACCOUNT"),
+		Logger:    logger,
+	}
+}
+
+type AuthAccount struct {
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	PartnerID string `json:"partnerID"`
+	AccountID string `json:"accountID"`
+}
+
+type BridgeConfig struct {
+	ConferenceID        string `json:"conferenceID"`
+	MinimumParticipants int    `json:"minParticipants"`
+	ExitChimes          string `json:"exitChimes"`
+	ConfigParameterURL  string `json:"confParamsUrl"`
+}
+
+type BridgeRequest struct {
+	SetBridge BridgeConfig `json:"setBridge"`
+}
+
+type PSTNRequest struct {
+	AuthAccount AuthAccount     `json:"authAccount"`
+	RequestList []BridgeRequest `json:"requestList"`
+}
+
+type Request struct {
+	Request PSTNRequest `json:"request"`
+}
+
+func (tb *TurboBridge) authAccount() AuthAccount {
+	return AuthAccount{
+		Email:     tb.Email,
+		Password:  tb.Password,
+		PartnerID: "turbobridge",
+		AccountID: tb.AccountID,
+	}
+}
+
+// post sends the request to the given TurboBridge endpoint and decodes the response into result
+func (tb *TurboBridge) post(ctx context.Context, endpoint string, request interface{}, result interface{}) error {
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		tb.Logger.Error().Err(err).Interface("Request", request).Msg("Unable to Marshal JSON")
+		return err
+	}
+
+	tb.Logger.Debug().Str("Endpoint", endpoint).Str("Parameters", string(requestBody)).Msg("TurboBridge Request")
+
+	req, err := http.NewRequestWithContext(ctx, "POST", tb.BaseURL+"/"+endpoint, bytes.NewBuffer(requestBody))
+	if err != nil {
+		tb.Logger.Error().Err(err).Msg("Unable to Create Request")
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := tb.Client.Do(req)
+	if err != nil {
+		tb.Logger.Error().Err(err).Str("Endpoint", endpoint).Msg("TurboBridge request failed")
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		tb.Logger.Error().Int("Status Code", resp.StatusCode).Str("Endpoint", endpoint).Msg("Error response from TurboBridge")
+		return fmt.Errorf("TurboBridge returned status code %d", resp.StatusCode)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		tb.Logger.Error().Err(err).Msg("Unable to decode JSON response")
+		return err
+	}
+
+	tb.Logger.Info().Str("Endpoint", endpoint).Interface("Response", result).Msg("TurboBridge Response")
+
+	return nil
+}
+
+// CreateBridge creates a bridge which dials callers into the channel fetched from backendURL
+func (tb *TurboBridge) CreateBridge(ctx context.Context, confID string, backendURL string) error {
+	request := Request{
+		Request: PSTNRequest{
+			AuthAccount: tb.authAccount(),
+			RequestList: []BridgeRequest{
+				{
+					SetBridge: BridgeConfig{
+						ConferenceID:        confID,
+						MinimumParticipants: 1,
+						ExitChimes:          "none",
+						ConfigParameterURL:  backendURL + "/pstn",
+					},
+				},
+			},
+		},
+	}
+
+	var result map[string]interface{}
+	return tb.post(ctx, "Bridge", &request, &result)
+}
+
+type ConferenceInfo struct {
+	ConferenceID string `json:"conferenceID"`
+}
+
+type ConferenceRequest struct {
+	ConferenceInfo ConferenceInfo `json:"getConferenceInfo"`
+}
+
+type GetConferenceRequest struct {
+	AuthAccount AuthAccount         `json:"authAccount"`
+	RequestList []ConferenceRequest `json:"requestList"`
+}
+
+type ConferencePSTNRequest struct {
+	Request GetConferenceRequest `json:"request"`
+}
+
+type CustomData struct {
+	UID string `json:"uid"`
+}
+
+type Call struct {
+	CustomData CustomData `json:"dataPerm"`
+	CallID     string     `json:"callID"`
+}
+
+type Calls struct {
+	Call []Call `json:"call"`
+}
+
+type Conference struct {
+	Calls Calls `json:"calls"`
+}
+
+type Result struct {
+	Conference Conference `json:"conference"`
+}
+
+type RequestItem struct {
+	Result Result `json:"result"`
+}
+
+type ConferenceResponse struct {
+	RequestItem []RequestItem `json:"requestItem"`
+}
+
+type ConferencePSTNResponse struct {
+	Response ConferenceResponse `json:"responseList"`
+}
+
+// ListCalls fetches the calls that are connected to the bridge
+func (tb *TurboBridge) ListCalls(ctx context.Context, confID string) ([]PSTNCall, error) {
+	request := ConferencePSTNRequest{
+		Request: GetConferenceRequest{
+			AuthAccount: tb.authAccount(),
+			RequestList: []ConferenceRequest{
+				{
+					ConferenceInfo: ConferenceInfo{
+						ConferenceID: confID,
+					},
+				},
+			},
+		},
+	}
+
+	var result ConferencePSTNResponse
+	err := tb.post(ctx, "LCM", &request, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Response.RequestItem) == 0 {
+		tb.Logger.Error().Interface("Conference Response", result).Msg("Empty conference response")
+		return nil, errors.New("Empty conference response")
+	}
+
+	calls := []PSTNCall{}
+	for _, call := range result.Response.RequestItem[0].Result.Conference.Calls.Call {
+		calls = append(calls, PSTNCall{
+			CallID: call.CallID,
+			UID:    call.CustomData.UID,
+		})
+	}
+
+	return calls, nil
+}
+
+type ChangeConferenceCallDetails struct {
+	ConferenceID string `json:"conferenceID"`
+	CallID       string `json:"callID"`
+	Command      string `json:"command"`
+	Value        string `json:"value"`
+}
+
+type ChangeConferenceRequest struct {
+	ChangeConferenceCallDetails ChangeConferenceCallDetails `json:"changeConferenceCall"`
+}
+
+type ChangeConferenceRequestList struct {
+	AuthAccount AuthAccount               `json:"authAccount"`
+	RequestList []ChangeConferenceRequest `json:"requestList"`
+}
+
+type ChangeConferenceCall struct {
+	Request ChangeConferenceRequestList `json:"request"`
+}
+
+func (tb *TurboBridge) changeConferenceCall(ctx context.Context, confID string, callID string, command string, value string) error {
+	request := ChangeConferenceCall{
+		Request: ChangeConferenceRequestList{
+			AuthAccount: tb.authAccount(),
+			RequestList: []ChangeConferenceRequest{
+				{
+					ChangeConferenceCallDetails: ChangeConferenceCallDetails{
+						ConferenceID: confID,
+						CallID:       callID,
+						Command:      command,
+						Value:        value,
+					},
+				},
+			},
+		},
+	}
+
+	var result map[string]interface{}
+	return tb.post(ctx, "LCM", &request, &result)
+}
+
+// SetMuteState mutes or unmutes a call on the bridge
+func (tb *TurboBridge) SetMuteState(ctx context.Context, confID string, callID string, muteState bool) error {
+	var numberMuteState string
+	if muteState {
+		numberMuteState = "1"
+	} else {
+		numberMuteState = "0"
+	}
+
+	return tb.changeConferenceCall(ctx, confID, callID, "setMute", numberMuteState)
+}
+
+// HangUp disconnects a call from the bridge
+func (tb *TurboBridge) HangUp(ctx context.Context, confID string, callID string) error {
+	return tb.changeConferenceCall(ctx, confID, callID, "hangup", "")
+}
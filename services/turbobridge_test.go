@@ -0,0 +1,115 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// newStalledTurboBridge returns a TurboBridge whose API does not answer until the test ends
+func newStalledTurboBridge(t *testing.T) *TurboBridge {
+	t.Helper()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() {
+		close(release)
+	})
+
+	logger := zerolog.Nop()
+	return &TurboBridge{
+		Client:  &http.Client{},
+		BaseURL: server.URL,
+		Logger:  &utils.Logger{Logger: &logger},
+	}
+}
+
+func TestNewPSTNProviderIgnoresCase(t *testing.T) {
+	utils.SetDefaults()
+	logger := zerolog.Nop()
+
+	viper.Set("PSTN_PROVIDER", "Fake")
+	provider, err := NewPSTNProvider(&utils.Logger{Logger: &logger})
+	if err != nil {
+		t.Fatalf("Could not create the provider: %v", err)
+	}
+
+	if _, ok := provider.(*FakePSTN); !ok {
+		t.Errorf("Created %T, want the fake provider", provider)
+	}
+
+	viper.Set("PSTN_PROVIDER", "TurboBridge")
+	provider, err = NewPSTNProvider(&utils.Logger{Logger: &logger})
+	if err != nil {
+		t.Fatalf("Could not create the provider: %v", err)
+	}
+
+	turboBridge, ok := provider.(*TurboBridge)
+	if !ok {
+		t.Fatalf("Created %T, want TurboBridge", provider)
+	}
+
+	if turboBridge.Client.Timeout != 10*time.Second {
+		t.Errorf("TurboBridge requests time out after %v, want the default of 10s", turboBridge.Client.Timeout)
+	}
+}
+
+func TestTurboBridgeTimesOut(t *testing.T) {
+	tb := newStalledTurboBridge(t)
+	tb.Client.Timeout = 50 * time.Millisecond
+
+	done := make(chan error, 1)
+	go func() {
+		done <- tb.CreateBridge(context.Background(), "123456", "https://backend.example.com")
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Creating a bridge succeeded without a response")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Creating a bridge did not time out")
+	}
+}
+
+func TestTurboBridgeStopsWithContext(t *testing.T) {
+	tb := newStalledTurboBridge(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := tb.ListCalls(ctx, "123456")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Listing calls succeeded without a response")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Listing calls ignored the cancelled context")
+	}
+}
@@ -0,0 +1,304 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+// Package accesstoken2 builds version 007 Agora access tokens (AccessToken2).
+// Unlike the legacy AccessToken every privilege of a service has its own expiry.
+package accesstoken2
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Version is the prefix of every AccessToken2
+const Version = "007"
+
+// Service types
+const (
+	ServiceTypeRtc = 1
+	ServiceTypeRtm = 2
+)
+
+// Privileges of the RTC service
+const (
+	PrivilegeJoinChannel        = 1
+	PrivilegePublishAudioStream = 2
+	PrivilegePublishVideoStream = 3
+	PrivilegePublishDataStream  = 4
+)
+
+// Privileges of the RTM service
+const (
+	PrivilegeLogin = 1
+)
+
+// Service is a service the token grants privileges for
+type Service interface {
+	ServiceType() uint16
+	Pack(w io.Writer) error
+}
+
+// Privileges maps a privilege to the number of seconds after the token was issued it expires
+type Privileges map[uint16]uint32
+
+// ServiceRtc grants privileges in a RTC channel to a uid or user account
+type ServiceRtc struct {
+	ChannelName string
+	UID         string
+	Privileges  Privileges
+}
+
+// NewServiceRtc creates a RTC service without privileges, a uid of 0 allows any uid to join
+func NewServiceRtc(channelName string, uid string) *ServiceRtc {
+	if uid == "0" {
+		uid = ""
+	}
+
+	return &ServiceRtc{
+		ChannelName: channelName,
+		UID:         uid,
+		Privileges:  Privileges{},
+	}
+}
+
+// AddPrivilege grants a privilege that expires the given number of seconds after the token was issued
+func (s *ServiceRtc) AddPrivilege(privilege uint16, expire uint32) {
+	s.Privileges[privilege] = expire
+}
+
+// ServiceType returns ServiceTypeRtc
+func (s *ServiceRtc) ServiceType() uint16 {
+	return ServiceTypeRtc
+}
+
+// Pack writes the service in the binary token format
+func (s *ServiceRtc) Pack(w io.Writer) error {
+	err := packService(w, ServiceTypeRtc, s.Privileges)
+	if err != nil {
+		return err
+	}
+
+	err = packString(w, s.ChannelName)
+	if err != nil {
+		return err
+	}
+
+	return packString(w, s.UID)
+}
+
+// ServiceRtm grants privileges to a RTM user
+type ServiceRtm struct {
+	UserID     string
+	Privileges Privileges
+}
+
+// NewServiceRtm creates a RTM service without privileges
+func NewServiceRtm(userID string) *ServiceRtm {
+	return &ServiceRtm{
+		UserID:     userID,
+		Privileges: Privileges{},
+	}
+}
+
+// AddPrivilege grants a privilege that expires the given number of seconds after the token was issued
+func (s *ServiceRtm) AddPrivilege(privilege uint16, expire uint32) {
+	s.Privileges[privilege] = expire
+}
+
+// ServiceType returns ServiceTypeRtm
+func (s *ServiceRtm) ServiceType() uint16 {
+	return ServiceTypeRtm
+}
+
+// Pack writes the service in the binary token format
+func (s *ServiceRtm) Pack(w io.Writer) error {
+	err := packService(w, ServiceTypeRtm, s.Privileges)
+	if err != nil {
+		return err
+	}
+
+	return packString(w, s.UserID)
+}
+
+// AccessToken is an AccessToken2 that is valid for Expire seconds after IssueTs
+type AccessToken struct {
+	AppID    string
+	AppCert  string
+	IssueTs  uint32
+	Expire   uint32
+	Salt     uint32
+	Services map[uint16]Service
+}
+
+// NewAccessToken creates a token issued now that is valid for expire seconds
+func NewAccessToken(appID string, appCert string, expire uint32) *AccessToken {
+	return &AccessToken{
+		AppID:    appID,
+		AppCert:  appCert,
+		IssueTs:  uint32(time.Now().Unix()),
+		Expire:   expire,
+		Salt:     uint32(rand.Int31n(99999999) + 1),
+		Services: map[uint16]Service{},
+	}
+}
+
+// AddService adds a service to the token, replacing the service of the same type
+func (token *AccessToken) AddService(service Service) {
+	token.Services[service.ServiceType()] = service
+}
+
+// Build signs the token and encodes it
+func (token *AccessToken) Build() (string, error) {
+	if !isUUID(token.AppID) || !isUUID(token.AppCert) {
+		return "", errors.New("App ID and App Certificate must be 32 hexadecimal characters")
+	}
+
+	var info bytes.Buffer
+	err := packString(&info, token.AppID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, value := range []uint32{token.IssueTs, token.Expire, token.Salt} {
+		err = packUint32(&info, value)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = packUint16(&info, uint16(len(token.Services)))
+	if err != nil {
+		return "", err
+	}
+
+	serviceTypes := []int{}
+	for serviceType := range token.Services {
+		serviceTypes = append(serviceTypes, int(serviceType))
+	}
+	sort.Ints(serviceTypes)
+
+	for _, serviceType := range serviceTypes {
+		err = token.Services[uint16(serviceType)].Pack(&info)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	mac := hmac.New(sha256.New, token.signingKey())
+	mac.Write(info.Bytes())
+
+	var content bytes.Buffer
+	err = packString(&content, string(mac.Sum(nil)))
+	if err != nil {
+		return "", err
+	}
+	content.Write(info.Bytes())
+
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	_, err = writer.Write(content.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return Version + base64.StdEncoding.EncodeToString(compressed.Bytes()), nil
+}
+
+// signingKey derives the key signing the token from the certificate, the issue time and the salt
+func (token *AccessToken) signingKey() []byte {
+	issueTs := hmac.New(sha256.New, uint32Bytes(token.IssueTs))
+	issueTs.Write([]byte(token.AppCert))
+
+	salt := hmac.New(sha256.New, uint32Bytes(token.Salt))
+	salt.Write(issueTs.Sum(nil))
+
+	return salt.Sum(nil)
+}
+
+func isUUID(value string) bool {
+	if len(value) != 32 {
+		return false
+	}
+
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+func uint32Bytes(value uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, value)
+	return buf
+}
+
+func packUint16(w io.Writer, value uint16) error {
+	return binary.Write(w, binary.LittleEndian, value)
+}
+
+func packUint32(w io.Writer, value uint32) error {
+	return binary.Write(w, binary.LittleEndian, value)
+}
+
+func packString(w io.Writer, value string) error {
+	err := packUint16(w, uint16(len(value)))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, value)
+	return err
+}
+
+// packService writes the service type followed by its privileges ordered by privilege
+func packService(w io.Writer, serviceType uint16, privileges Privileges) error {
+	err := packUint16(w, serviceType)
+	if err != nil {
+		return err
+	}
+
+	err = packUint16(w, uint16(len(privileges)))
+	if err != nil {
+		return err
+	}
+
+	keys := []int{}
+	for privilege := range privileges {
+		keys = append(keys, int(privilege))
+	}
+	sort.Ints(keys)
+
+	for _, privilege := range keys {
+		err = packUint16(w, uint16(privilege))
+		if err != nil {
+			return err
+		}
+
+		err = packUint32(w, privileges[uint16(privilege)])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package accesstoken2
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// The sample app, channel and user of the AgoraDynamicKey tests, with a fixed issue time, salt and expiry
+const (
+	testAppID          = "970CA35de60c44645bbae8a215061b33"
+	testAppCertificate = "5CFd2fd1755d40ecb72977518be15d3b"
+	testChannelName    = "7d72365eb983485397e3e3f9d460bdda"
+	testUID            = "2882341273"
+	testAccount        = "test_user"
+	testIssueTs        = 1111111
+	testSalt           = 1
+	testExpire         = 600
+)
+
+// newTestAccessToken returns a token with a fixed issue time and salt so that it always builds to the same string
+func newTestAccessToken() *AccessToken {
+	token := NewAccessToken(testAppID, testAppCertificate, testExpire)
+	token.IssueTs = testIssueTs
+	token.Salt = testSalt
+	return token
+}
+
+func newTestServiceRtc(uid string) *ServiceRtc {
+	service := NewServiceRtc(testChannelName, uid)
+	service.AddPrivilege(PrivilegeJoinChannel, testExpire)
+	service.AddPrivilege(PrivilegePublishAudioStream, testExpire)
+	service.AddPrivilege(PrivilegePublishVideoStream, testExpire)
+	service.AddPrivilege(PrivilegePublishDataStream, testExpire)
+	return service
+}
+
+// Tokens published in the accesstoken2 tests of AgoraDynamicKey for the sample app, channel and user.
+// They were compressed by other zlib implementations, which frame the last deflate block differently,
+// so they are compared with built tokens after decompression.
+const (
+	publishedRtcToken         = "007eJxSYBBbsMMnKq7p9Hf/HcIX5kce9b518kCiQgSr5Zrp4X1Tu6UUGCzNDZwdjU1TUs0Mkk1MzExMk5ISUy0SjQxNDcwMk4yN3b8IMEQwMTAwMoAwBIL4CgzmKeZGxmamqUmWFsYmFqbGluapxqnGaZYpJmYGSSkpiVwMRhYWRsYmhkbmxoAAAAD//8JqJOM="
+	publishedRtcUID0Token     = "007eJxSYLhzZP08Lxa1Pg57+TcXb/3cZ3wi4V6kbpbOog0G2dOYk20UGCzNDZwdjU1TUs0Mkk1MzExMk5ISUy0SjQxNDcwMk4yN3b8IMEQwMTAwMoAwBIL4CgzmKeZGxmamqUmWFsYmFqbGluapxqnGaZYpJmYGSSkpiQwMgAAAAP//Npwiag=="
+	publishedRtmToken         = "007eJxSYOCdJftjyTM2zxW6Xhm/5T0j5LdcUt/xYVt48fb5Mp3PX9coMFiaGzg7GpumpJoZJJuYmJmYJiUlplokGhmaGpgZJhkbu38RYIhgYmBgZABhJgZGBkYwn5OhJLW4JL60OLUIEAAA//9ZVh6A"
+	publishedPythonRtcToken   = "007eJxTYBBbsMMnKq7p9Hf/HcIX5kce9b518kCiQgSr5Zrp4X1Tu6UUGCzNDZwdjU1TUs0Mkk1MzExMk5ISUy0SjQxNDcwMk4yN3b8IMEQwMTAwMoAwBIL4CgzmKeZGxmamqUmWFsYmFqbGluapxqnGaZYpJmYGSSkpiVwMRhYWRsYmhkbmxgDCaiTj"
+	publishedPythonMultiToken = "007eJxTYOAQsrQ5s3TfH+1tvy8zZZ46EpCc0V43JXdGd2jS8porKo4KDJbmBs6OxqYpqWYGySYmZiamSUmJqRaJRoamBmaGScbG7l8EGCKYGBgYGRgYmIAkCxCD+ExgkhlMsoBJBQbzFHMjYzPT1CRLC2MTC1NjS/NU41TjNMsUEzODpJSURC4GIwsLI2MTQyNzY5BZEJM4GUpSi0viS4tTiwAipyp4"
+)
+
+// decodeContent returns the signature and the signed token info of a token
+func decodeContent(token string) ([]byte, error) {
+	if !strings.HasPrefix(token, Version) {
+		return nil, errors.New("Token does not start with the version")
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(token, Version))
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+// verifySignature checks the signature at the start of the content against the info that follows it
+func verifySignature(content []byte, appCert string) bool {
+	if len(content) < 2 {
+		return false
+	}
+
+	length := int(binary.LittleEndian.Uint16(content))
+	if len(content) < 2+length {
+		return false
+	}
+
+	token := newTestAccessToken()
+	token.AppCert = appCert
+
+	mac := hmac.New(sha256.New, token.signingKey())
+	mac.Write(content[2+length:])
+	return hmac.Equal(content[2:2+length], mac.Sum(nil))
+}
+
+func TestBuild(t *testing.T) {
+	rtcJoin := NewServiceRtc(testChannelName, testUID)
+	rtcJoin.AddPrivilege(PrivilegeJoinChannel, testExpire)
+
+	rtcUID0 := NewServiceRtc(testChannelName, "")
+	rtcUID0.AddPrivilege(PrivilegeJoinChannel, testExpire)
+
+	rtm := NewServiceRtm(testAccount)
+	rtm.AddPrivilege(PrivilegeLogin, testExpire)
+
+	tests := []struct {
+		name      string
+		services  []Service
+		published string
+	}{
+		{name: "rtc", services: []Service{rtcJoin}, published: publishedRtcToken},
+		{name: "rtc uid 0", services: []Service{rtcUID0}, published: publishedRtcUID0Token},
+		{name: "rtm", services: []Service{rtm}, published: publishedRtmToken},
+		{name: "rtc from python", services: []Service{rtcJoin}, published: publishedPythonRtcToken},
+		{name: "rtc and rtm from python", services: []Service{rtm, newTestServiceRtc(testUID)}, published: publishedPythonMultiToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want, err := decodeContent(test.published)
+			if err != nil {
+				t.Fatalf("Could not decode published token: %v", err)
+			}
+
+			if !verifySignature(want, testAppCertificate) {
+				t.Fatal("Signature of the published token does not verify with the signing key")
+			}
+
+			if verifySignature(want, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa") {
+				t.Fatal("Signature of the published token verifies with the wrong certificate")
+			}
+
+			token := newTestAccessToken()
+			for _, service := range test.services {
+				token.AddService(service)
+			}
+
+			built, err := token.Build()
+			if err != nil {
+				t.Fatalf("Build failed: %v", err)
+			}
+
+			got, err := decodeContent(built)
+			if err != nil {
+				t.Fatalf("Could not decode %s: %v", built, err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Errorf("Token content = %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestBuildRejectsInvalidAppID(t *testing.T) {
+	token := newTestAccessToken()
+	token.AppID = "970CA35de60c44645bbae8a215061b3"
+	token.AddService(newTestServiceRtc(testUID))
+
+	_, err := token.Build()
+	if err == nil {
+		t.Error("Built a token with an App ID of 31 characters")
+	}
+}
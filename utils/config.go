@@ -40,8 +40,35 @@ func SetDefaults() {
 	viper.SetDefault("ALLOW_LIST", []string{"*"})
 	viper.SetDefault("RECORDING_VENDOR", 1)
 	viper.SetDefault("RECORDING_REGION", 0)
+	viper.SetDefault("RECORDING_BASE_URL", "https://api.agora.io/v1")
+	viper.SetDefault("RECORDING_TIMEOUT", 10)
+	viper.SetDefault("RECORDING_MAX_RETRIES", 3)
+	viper.SetDefault("AUTO_RECORD_TIMEOUT", 45)
+	viper.SetDefault("RECORDING_RETRY_DELAY", 250)
+	viper.SetDefault("RECORDING_FILE_PREFIX", "{host}/{date}/{time}")
+	viper.SetDefault("RECORDING_TIMEZONE", "America/Los_Angeles")
+	viper.SetDefault("SNAPSHOT_CAPTURE_INTERVAL", 10)
+	viper.SetDefault("SNAPSHOT_FILE_PREFIX", "snapshots/{channel}/{date}/{time}")
+	viper.SetDefault("RECORDING_RETENTION_DAYS", 0)
+	viper.SetDefault("RETENTION_INTERVAL", 60)
+	viper.SetDefault("RETENTION_DRY_RUN", false)
+	viper.SetDefault("ADMIN_EMAILS", []string{})
 	viper.SetDefault("RUN_MIGRATION", false)
+	viper.SetDefault("TOKEN_TTL_HOST", 86400)
+	viper.SetDefault("TOKEN_TTL_ATTENDEE", 86400)
+	viper.SetDefault("TOKEN_TTL_SCREEN_SHARE", 86400)
+	viper.SetDefault("TOKEN_TTL_PSTN", 86400)
+	viper.SetDefault("TOKEN_TTL_RECORDING", 86400)
+	viper.SetDefault("TOKEN_VERSION", "006")
+	viper.SetDefault("TOKEN_API_DEFAULT_TTL", 3600)
+	viper.SetDefault("TOKEN_API_MAX_TTL", 86400)
+	viper.SetDefault("API_KEY_RATE_LIMIT", 60)
 	viper.SetDefault("PSTN_NUMBER", "(800) 309-2350")
+	viper.SetDefault("EARLY_JOIN_MINUTES", 10)
+	viper.SetDefault("FRONTEND_URL", "")
+	viper.SetDefault("PSTN_PROVIDER", "turbobridge")
+	viper.SetDefault("PSTN_BASE_URL", "https://api-dev.turbobridge.com/4.3")
+	viper.SetDefault("PSTN_TIMEOUT", 10)
 
 	if viper.GetString("RUN_MIGRATION") == "true" {
 		viper.SetDefault("RUN_MIGRATION", true)
@@ -0,0 +1,159 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// maxFileNamePrefixLength is the maximum length of the entries of fileNamePrefix joined with "/" allowed by Cloud Recording
+const maxFileNamePrefixLength = 128
+
+var prefixCharacters = regexp.MustCompile("[^a-zA-Z0-9]+")
+var placeholderRegex = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// Placeholders supported in RECORDING_FILE_PREFIX
+var filePrefixPlaceholders = map[string]bool{
+	"channel":   true,
+	"title":     true,
+	"host":      true,
+	"date":      true,
+	"time":      true,
+	"timezone":  true,
+	"recording": true,
+}
+
+// FilePrefixValues are the values substituted into the placeholders of the file prefix template
+type FilePrefixValues struct {
+	Channel     string
+	Title       string
+	Host        string
+	RecordingID string
+	Time        time.Time
+}
+
+// FilePrefixTemplate builds the storage prefix of the recorded files.
+// Entries of the template are separated by / and can contain the placeholders
+// {channel}, {title}, {host}, {date}, {time}, {timezone} and {recording}.
+type FilePrefixTemplate struct {
+	Template string
+	Location *time.Location
+}
+
+// LoadFilePrefixTemplate reads and validates RECORDING_FILE_PREFIX and RECORDING_TIMEZONE
+func LoadFilePrefixTemplate() (*FilePrefixTemplate, error) {
+	return loadFilePrefixTemplate("RECORDING_FILE_PREFIX")
+}
+
+// loadFilePrefixTemplate reads and validates the template stored in key and RECORDING_TIMEZONE
+func loadFilePrefixTemplate(key string) (*FilePrefixTemplate, error) {
+	template := viper.GetString(key)
+	for _, match := range placeholderRegex.FindAllStringSubmatch(template, -1) {
+		if !filePrefixPlaceholders[match[1]] {
+			return nil, fmt.Errorf("Unknown placeholder %s in %s", match[0], key)
+		}
+	}
+
+	location, err := time.LoadLocation(viper.GetString("RECORDING_TIMEZONE"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid RECORDING_TIMEZONE: %s", err)
+	}
+
+	return &FilePrefixTemplate{
+		Template: template,
+		Location: location,
+	}, nil
+}
+
+// Build fills in the template and returns the entries of fileNamePrefix
+func (t *FilePrefixTemplate) Build(values FilePrefixValues) ([]string, error) {
+	timestamp := values.Time.In(t.Location)
+	host := values.Host
+	if host == "" {
+		host = values.Title
+	}
+
+	replacements := map[string]string{
+		"channel":   values.Channel,
+		"title":     values.Title,
+		"host":      host,
+		"date":      timestamp.Format("20060102"),
+		"time":      timestamp.Format("150405"),
+		"timezone":  timestamp.Format("MST"),
+		"recording": values.RecordingID,
+	}
+
+	entries := []string{}
+	for _, entry := range strings.Split(t.Template, "/") {
+		filled := placeholderRegex.ReplaceAllStringFunc(entry, func(placeholder string) string {
+			return replacements[strings.Trim(placeholder, "{}")]
+		})
+
+		entries = append(entries, filled)
+	}
+
+	return SanitizeFileNamePrefix(entries)
+}
+
+// SanitizeFileNamePrefix applies the restrictions of Cloud Recording on fileNamePrefix.
+// Every character that is not a letter or a number is removed, empty entries are dropped
+// and the longest entries are shortened until the entries joined with "/" fit.
+func SanitizeFileNamePrefix(entries []string) ([]string, error) {
+	result := []string{}
+	total := 0
+	for _, entry := range entries {
+		sanitized := prefixCharacters.ReplaceAllString(entry, "")
+		if sanitized == "" {
+			continue
+		}
+
+		result = append(result, sanitized)
+		total += len(sanitized)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("File name prefix is empty")
+	}
+
+	// Cloud Recording stores the files under the entries joined with "/"
+	separators := len(result) - 1
+	total += separators
+
+	// Every entry keeps at least one character
+	if len(result)+separators > maxFileNamePrefixLength {
+		return nil, fmt.Errorf("File name prefix does not fit in %d characters", maxFileNamePrefixLength)
+	}
+
+	for total > maxFileNamePrefixLength {
+		longest := 0
+		for index := range result {
+			if len(result[index]) > len(result[longest]) {
+				longest = index
+			}
+		}
+
+		excess := total - maxFileNamePrefixLength
+		newLength := len(result[longest]) - excess
+		if newLength < 1 {
+			newLength = 1
+		}
+
+		total -= len(result[longest]) - newLength
+		result[longest] = FirstN(result[longest], newLength)
+	}
+
+	return result, nil
+}
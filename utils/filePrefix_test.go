@@ -0,0 +1,62 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFileNamePrefixCountsSeparators(t *testing.T) {
+	entries := []string{strings.Repeat("a", 60), strings.Repeat("b", 60), strings.Repeat("c", 8)}
+
+	result, err := SanitizeFileNamePrefix(entries)
+	if err != nil {
+		t.Fatalf("Could not sanitize prefix: %v", err)
+	}
+
+	joined := strings.Join(result, "/")
+	if len(joined) != maxFileNamePrefixLength {
+		t.Errorf("Joined prefix has %d characters, want %d", len(joined), maxFileNamePrefixLength)
+	}
+}
+
+func TestSanitizeFileNamePrefixKeepsShortPrefixes(t *testing.T) {
+	result, err := SanitizeFileNamePrefix([]string{"host-name", "20261018", "", "120000"})
+	if err != nil {
+		t.Fatalf("Could not sanitize prefix: %v", err)
+	}
+
+	if strings.Join(result, "/") != "hostname/20261018/120000" {
+		t.Errorf("Got %v", result)
+	}
+}
+
+func TestSanitizeFileNamePrefixTooManyEntries(t *testing.T) {
+	entries := make([]string, maxFileNamePrefixLength/2+1)
+	for index := range entries {
+		entries[index] = "ab"
+	}
+
+	_, err := SanitizeFileNamePrefix(entries)
+	if err == nil {
+		t.Error("A prefix that cannot fit was accepted")
+	}
+
+	result, err := SanitizeFileNamePrefix(entries[:maxFileNamePrefixLength/2])
+	if err != nil {
+		t.Fatalf("Could not sanitize prefix: %v", err)
+	}
+
+	if len(strings.Join(result, "/")) > maxFileNamePrefixLength {
+		t.Errorf("Joined prefix %v does not fit", result)
+	}
+}
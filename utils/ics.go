@@ -0,0 +1,329 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// icsLineLength is the longest line in octets allowed by RFC 5545 before it must be folded
+const icsLineLength = 75
+
+// icsDateTime is the format of local date-time values in iCalendar
+const icsDateTime = "20060102T150405"
+
+var recurrenceFrequencies = map[string]bool{
+	"SECONDLY": true,
+	"MINUTELY": true,
+	"HOURLY":   true,
+	"DAILY":    true,
+	"WEEKLY":   true,
+	"MONTHLY":  true,
+	"YEARLY":   true,
+}
+
+var recurrenceParts = map[string]bool{
+	"FREQ":       true,
+	"UNTIL":      true,
+	"COUNT":      true,
+	"INTERVAL":   true,
+	"BYSECOND":   true,
+	"BYMINUTE":   true,
+	"BYHOUR":     true,
+	"BYDAY":      true,
+	"BYMONTHDAY": true,
+	"BYYEARDAY":  true,
+	"BYWEEKNO":   true,
+	"BYMONTH":    true,
+	"BYSETPOS":   true,
+	"WKST":       true,
+}
+
+var weekdays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// ParseRecurrenceRule validates a RFC 5545 recurrence rule such as FREQ=WEEKLY;BYDAY=MO,WE
+// and returns it in upper case without the RRULE: prefix
+func ParseRecurrenceRule(rule string) (string, error) {
+	rule = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+	if rule == "" {
+		return "", errors.New("Recurrence rule is empty")
+	}
+
+	seen := map[string]bool{}
+	for _, part := range strings.Split(rule, ";") {
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) != 2 || pair[1] == "" {
+			return "", fmt.Errorf("Invalid recurrence rule part %s", part)
+		}
+
+		name, value := pair[0], pair[1]
+		if !recurrenceParts[name] {
+			return "", fmt.Errorf("Unknown recurrence rule part %s", name)
+		}
+
+		if seen[name] {
+			return "", fmt.Errorf("Recurrence rule part %s is repeated", name)
+		}
+		seen[name] = true
+
+		for _, char := range value {
+			if !(char >= 'A' && char <= 'Z') && !(char >= '0' && char <= '9') && !strings.ContainsRune(",+-", char) {
+				return "", fmt.Errorf("Invalid value %s of recurrence rule part %s", value, name)
+			}
+		}
+
+		switch name {
+		case "FREQ":
+			if !recurrenceFrequencies[value] {
+				return "", fmt.Errorf("Unknown recurrence frequency %s", value)
+			}
+		case "COUNT", "INTERVAL":
+			number, err := strconv.Atoi(value)
+			if err != nil || number < 1 {
+				return "", fmt.Errorf("%s must be a positive number", name)
+			}
+		case "UNTIL":
+			_, err := time.Parse(icsDateTime+"Z", value)
+			if err != nil {
+				_, err = time.Parse("20060102", value)
+			}
+
+			if err != nil {
+				return "", errors.New("UNTIL must be a date or a UTC date-time")
+			}
+		}
+	}
+
+	if !seen["FREQ"] {
+		return "", errors.New("Recurrence rule must contain FREQ")
+	}
+
+	if seen["UNTIL"] && seen["COUNT"] {
+		return "", errors.New("Recurrence rule cannot contain both UNTIL and COUNT")
+	}
+
+	return rule, nil
+}
+
+// CalendarEvent is a meeting that is exported as iCalendar event
+type CalendarEvent struct {
+	UID         string
+	Title       string
+	Description string
+	URL         string
+	Start       time.Time
+	Duration    time.Duration
+	Location    *time.Location
+	Recurrence  string
+	// Timestamp is when the calendar was generated
+	Timestamp time.Time
+}
+
+// BuildCalendar returns a RFC 5545 calendar containing the event.
+// Events with a location other than UTC are written in local time with the matching time zone
+// definition, so that recurring events stay at the same local time across daylight saving changes.
+func BuildCalendar(event *CalendarEvent) string {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Agora//App Builder//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+	}
+
+	local := event.Location != nil && event.Location != time.UTC && event.Location.String() != "UTC"
+	if local {
+		lines = append(lines, timezoneLines(event.Location, event.Start)...)
+	}
+
+	lines = append(lines,
+		"BEGIN:VEVENT",
+		"UID:"+event.UID,
+		"DTSTAMP:"+event.Timestamp.UTC().Format(icsDateTime)+"Z",
+	)
+
+	if local {
+		lines = append(lines, "DTSTART;TZID="+event.Location.String()+":"+event.Start.In(event.Location).Format(icsDateTime))
+	} else {
+		lines = append(lines, "DTSTART:"+event.Start.UTC().Format(icsDateTime)+"Z")
+	}
+
+	if event.Duration > 0 {
+		lines = append(lines, fmt.Sprintf("DURATION:PT%dM", int(event.Duration.Minutes())))
+	}
+
+	if event.Recurrence != "" {
+		lines = append(lines, "RRULE:"+event.Recurrence)
+	}
+
+	lines = append(lines, "SUMMARY:"+escapeText(event.Title))
+	if event.Description != "" {
+		lines = append(lines, "DESCRIPTION:"+escapeText(event.Description))
+	}
+
+	if event.URL != "" {
+		lines = append(lines, "URL:"+event.URL, "LOCATION:"+escapeText(event.URL))
+	}
+
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+
+	var calendar strings.Builder
+	for _, line := range lines {
+		calendar.WriteString(foldLine(line))
+		calendar.WriteString("\r\n")
+	}
+
+	return calendar.String()
+}
+
+// escapeText escapes a TEXT property value
+func escapeText(value string) string {
+	return strings.NewReplacer(
+		"\\", "\\\\",
+		";", "\\;",
+		",", "\\,",
+		"\r\n", "\\n",
+		"\n", "\\n",
+		"\r", "\\n",
+	).Replace(value)
+}
+
+// foldLine splits lines longer than 75 octets, continuation lines start with a space.
+// Lines are only split between characters so that UTF-8 sequences stay intact.
+func foldLine(line string) string {
+	var folded strings.Builder
+	length := 0
+	for _, char := range line {
+		size := len(string(char))
+		if length+size > icsLineLength {
+			folded.WriteString("\r\n ")
+			length = 1
+		}
+
+		folded.WriteRune(char)
+		length += size
+	}
+
+	return folded.String()
+}
+
+// timezoneTransition is a change of the UTC offset of a time zone
+type timezoneTransition struct {
+	At         time.Time
+	OffsetFrom int
+	OffsetTo   int
+	Name       string
+}
+
+// timezoneLines defines the time zone of the location by the rules it follows in the year of start
+func timezoneLines(location *time.Location, start time.Time) []string {
+	lines := []string{"BEGIN:VTIMEZONE", "TZID:" + location.String()}
+
+	transitions := yearTransitions(location, start.In(location).Year())
+	if len(transitions) == 0 {
+		name, offset := start.In(location).Zone()
+		lines = append(lines,
+			"BEGIN:STANDARD",
+			"DTSTART:19700101T000000",
+			"TZOFFSETFROM:"+formatOffset(offset),
+			"TZOFFSETTO:"+formatOffset(offset),
+			"TZNAME:"+name,
+			"END:STANDARD",
+		)
+	}
+
+	for _, transition := range transitions {
+		component := "STANDARD"
+		if transition.OffsetTo > transition.OffsetFrom {
+			component = "DAYLIGHT"
+		}
+
+		// DTSTART of an observance is the local time before the transition
+		onset := transition.At.Add(time.Duration(transition.OffsetFrom) * time.Second).UTC()
+		lines = append(lines,
+			"BEGIN:"+component,
+			"DTSTART:"+onset.Format(icsDateTime),
+			"RRULE:"+yearlyRule(onset),
+			"TZOFFSETFROM:"+formatOffset(transition.OffsetFrom),
+			"TZOFFSETTO:"+formatOffset(transition.OffsetTo),
+			"TZNAME:"+transition.Name,
+			"END:"+component,
+		)
+	}
+
+	return append(lines, "END:VTIMEZONE")
+}
+
+// yearTransitions finds the changes of the UTC offset of the location during the year
+func yearTransitions(location *time.Location, year int) []timezoneTransition {
+	transitions := []timezoneTransition{}
+	current := time.Date(year, time.January, 1, 0, 0, 0, 0, location)
+	end := time.Date(year+1, time.January, 1, 0, 0, 0, 0, location)
+	_, offset := current.Zone()
+
+	for current.Before(end) {
+		next := current.Add(time.Hour)
+		_, nextOffset := next.Zone()
+		if nextOffset != offset {
+			// Narrow down the second at which the offset changes
+			low, high := current, next
+			for high.Sub(low) > time.Second {
+				middle := low.Add(high.Sub(low) / 2)
+				if _, middleOffset := middle.Zone(); middleOffset == offset {
+					low = middle
+				} else {
+					high = middle
+				}
+			}
+
+			name, _ := high.Zone()
+			transitions = append(transitions, timezoneTransition{
+				At:         high.UTC(),
+				OffsetFrom: offset,
+				OffsetTo:   nextOffset,
+				Name:       name,
+			})
+			offset = nextOffset
+		}
+
+		current = next
+	}
+
+	return transitions
+}
+
+// yearlyRule describes the local date of a transition as the nth or last weekday of its month
+func yearlyRule(onset time.Time) string {
+	week := strconv.Itoa((onset.Day()-1)/7 + 1)
+	daysInMonth := time.Date(onset.Year(), onset.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if onset.Day()+7 > daysInMonth {
+		week = "-1"
+	}
+
+	return fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%s%s", int(onset.Month()), week, weekdays[onset.Weekday()])
+}
+
+// formatOffset formats an offset in seconds east of UTC as +hhmm
+func formatOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+
+	hours := offset / 3600
+	minutes := offset % 3600 / 60
+	return fmt.Sprintf("%s%02d%02d", sign, hours, minutes)
+}
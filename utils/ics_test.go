@@ -0,0 +1,335 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// loadLocation loads the time zone or fails the test
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("Could not load time zone %s: %v", name, err)
+	}
+
+	return location
+}
+
+func TestBuildCalendar(t *testing.T) {
+	timestamp := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		golden   string
+		location string
+		start    string
+		event    CalendarEvent
+	}{
+		{
+			golden:   "utc.ics",
+			location: "UTC",
+			start:    "2026-03-02T17:00:00",
+			event: CalendarEvent{
+				UID:         "standup@appbuilder.agora.io",
+				Title:       "Standup; planning, Q3 \\ review",
+				Description: "Join the meeting: https://example.com/host-passphrase\nDial in: +1 555 0100, PIN 123456#",
+				URL:         "https://example.com/host-passphrase",
+				Duration:    30 * time.Minute,
+				Recurrence:  "FREQ=DAILY;COUNT=5",
+			},
+		},
+		{
+			golden:   "america_los_angeles.ics",
+			location: "America/Los_Angeles",
+			start:    "2026-03-02T09:00:00",
+			event: CalendarEvent{
+				UID:        "weekly@appbuilder.agora.io",
+				Title:      "Weekly sync",
+				URL:        "https://example.com/host-passphrase",
+				Duration:   time.Hour,
+				Recurrence: "FREQ=WEEKLY;BYDAY=MO;UNTIL=20261231T000000Z",
+			},
+		},
+		{
+			golden:   "asia_kolkata.ics",
+			location: "Asia/Kolkata",
+			start:    "2026-03-02T09:30:00",
+			event: CalendarEvent{
+				UID:         "kolkata@appbuilder.agora.io",
+				Title:       "साप्ताहिक टीम बैठक और योजना",
+				Description: "हर सोमवार सुबह की बैठक, जिसमें पिछले सप्ताह की समीक्षा होती है",
+				Duration:    45 * time.Minute,
+				Recurrence:  "FREQ=WEEKLY;BYDAY=MO",
+			},
+		},
+		{
+			golden:   "europe_berlin.ics",
+			location: "Europe/Berlin",
+			start:    "2026-03-31T10:00:00",
+			event: CalendarEvent{
+				UID:        "monthly@appbuilder.agora.io",
+				Title:      "Monthly review",
+				Duration:   90 * time.Minute,
+				Recurrence: "FREQ=MONTHLY;BYDAY=-1TU",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.golden, func(t *testing.T) {
+			location := loadLocation(t, test.location)
+			start, err := time.ParseInLocation("2006-01-02T15:04:05", test.start, location)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			event := test.event
+			event.Start = start
+			event.Location = location
+			event.Timestamp = timestamp
+			calendar := BuildCalendar(&event)
+
+			path := filepath.Join("testdata", test.golden)
+			if *updateGolden {
+				err = ioutil.WriteFile(path, []byte(calendar), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			golden, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Could not read golden file: %v", err)
+			}
+
+			if calendar != string(golden) {
+				t.Errorf("Calendar differs from %s:\n%s", path, calendar)
+			}
+
+			for _, line := range strings.Split(strings.TrimSuffix(calendar, "\r\n"), "\r\n") {
+				if len(line) > icsLineLength {
+					t.Errorf("Line %q has %d octets", line, len(line))
+				}
+
+				if !utf8.ValidString(line) {
+					t.Errorf("Line %q splits a character", line)
+				}
+			}
+		})
+	}
+}
+
+func TestFoldLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{
+			name: "short",
+			line: "SUMMARY:Standup",
+			want: "SUMMARY:Standup",
+		},
+		{
+			name: "exactly 75 octets",
+			line: "SUMMARY:" + strings.Repeat("a", 67),
+			want: "SUMMARY:" + strings.Repeat("a", 67),
+		},
+		{
+			name: "76 octets",
+			line: "SUMMARY:" + strings.Repeat("a", 68),
+			want: "SUMMARY:" + strings.Repeat("a", 67) + "\r\n a",
+		},
+		{
+			// The 75th octet is the second of the three octets of é, so the line is split before it
+			name: "inside a character of two octets",
+			line: "SUMMARY:" + strings.Repeat("a", 66) + "éé",
+			want: "SUMMARY:" + strings.Repeat("a", 66) + "\r\n éé",
+		},
+		{
+			name: "inside a character of three octets",
+			line: "SUMMARY:" + strings.Repeat("a", 65) + "बैठक",
+			want: "SUMMARY:" + strings.Repeat("a", 65) + "\r\n बैठक",
+		},
+		{
+			name: "inside a character of four octets",
+			line: "SUMMARY:" + strings.Repeat("a", 64) + "📅📅",
+			want: "SUMMARY:" + strings.Repeat("a", 64) + "\r\n 📅📅",
+		},
+		{
+			name: "continuation lines",
+			line: strings.Repeat("a", 75+74+10),
+			want: strings.Repeat("a", 75) + "\r\n " + strings.Repeat("a", 74) + "\r\n " + strings.Repeat("a", 10),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := foldLine(test.line)
+			if got != test.want {
+				t.Errorf("foldLine(%q) = %q, want %q", test.line, got, test.want)
+			}
+
+			if unfolded := strings.ReplaceAll(got, "\r\n ", ""); unfolded != test.line {
+				t.Errorf("Unfolded line is %q, want %q", unfolded, test.line)
+			}
+		})
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "Standup", want: "Standup"},
+		{value: "a;b,c", want: `a\;b\,c`},
+		{value: `C:\meetings`, want: `C:\\meetings`},
+		{value: `\;`, want: `\\\;`},
+		{value: "first\nsecond\r\nthird\rfourth", want: `first\nsecond\nthird\nfourth`},
+		{value: "Time: 10:00", want: "Time: 10:00"},
+	}
+
+	for _, test := range tests {
+		if got := escapeText(test.value); got != test.want {
+			t.Errorf("escapeText(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestTimezoneLines(t *testing.T) {
+	tests := []struct {
+		location string
+		want     []string
+	}{
+		{
+			location: "Asia/Kolkata",
+			want: []string{
+				"BEGIN:VTIMEZONE", "TZID:Asia/Kolkata",
+				"BEGIN:STANDARD", "DTSTART:19700101T000000", "TZOFFSETFROM:+0530", "TZOFFSETTO:+0530", "TZNAME:IST", "END:STANDARD",
+				"END:VTIMEZONE",
+			},
+		},
+		{
+			location: "America/Los_Angeles",
+			want: []string{
+				"BEGIN:VTIMEZONE", "TZID:America/Los_Angeles",
+				"BEGIN:DAYLIGHT", "DTSTART:20260308T020000", "RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU", "TZOFFSETFROM:-0800", "TZOFFSETTO:-0700", "TZNAME:PDT", "END:DAYLIGHT",
+				"BEGIN:STANDARD", "DTSTART:20261101T020000", "RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU", "TZOFFSETFROM:-0700", "TZOFFSETTO:-0800", "TZNAME:PST", "END:STANDARD",
+				"END:VTIMEZONE",
+			},
+		},
+		{
+			location: "Europe/Berlin",
+			want: []string{
+				"BEGIN:VTIMEZONE", "TZID:Europe/Berlin",
+				"BEGIN:DAYLIGHT", "DTSTART:20260329T020000", "RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU", "TZOFFSETFROM:+0100", "TZOFFSETTO:+0200", "TZNAME:CEST", "END:DAYLIGHT",
+				"BEGIN:STANDARD", "DTSTART:20261025T030000", "RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU", "TZOFFSETFROM:+0200", "TZOFFSETTO:+0100", "TZNAME:CET", "END:STANDARD",
+				"END:VTIMEZONE",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.location, func(t *testing.T) {
+			location := loadLocation(t, test.location)
+			got := timezoneLines(location, time.Date(2026, time.June, 1, 12, 0, 0, 0, location))
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("timezoneLines(%s) = %q, want %q", test.location, got, test.want)
+			}
+		})
+	}
+}
+
+func TestYearlyRule(t *testing.T) {
+	tests := []struct {
+		onset string
+		want  string
+	}{
+		{onset: "2026-03-08", want: "FREQ=YEARLY;BYMONTH=3;BYDAY=2SU"},
+		{onset: "2026-11-01", want: "FREQ=YEARLY;BYMONTH=11;BYDAY=1SU"},
+		// The 29th of March is the fifth Sunday, which is written as the last one so that it matches every year
+		{onset: "2026-03-29", want: "FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU"},
+		// The 25th of October is the fourth Sunday, but the last one in a month of 31 days
+		{onset: "2026-10-25", want: "FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU"},
+		// The 24th of a month of 31 days can be followed by another of the same weekday
+		{onset: "2026-10-24", want: "FREQ=YEARLY;BYMONTH=10;BYDAY=4SA"},
+		// The 22nd of February in a common year is the last one
+		{onset: "2026-02-22", want: "FREQ=YEARLY;BYMONTH=2;BYDAY=-1SU"},
+	}
+
+	for _, test := range tests {
+		onset, err := time.Parse("2006-01-02", test.onset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := yearlyRule(onset); got != test.want {
+			t.Errorf("yearlyRule(%s) = %s, want %s", test.onset, got, test.want)
+		}
+	}
+}
+
+func TestParseRecurrenceRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    string
+		invalid bool
+	}{
+		{rule: "FREQ=WEEKLY;BYDAY=MO,WE", want: "FREQ=WEEKLY;BYDAY=MO,WE"},
+		{rule: " rrule:freq=monthly;byday=-1fr ", want: "FREQ=MONTHLY;BYDAY=-1FR"},
+		{rule: "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", want: "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29"},
+		{rule: "FREQ=DAILY;COUNT=10", want: "FREQ=DAILY;COUNT=10"},
+		{rule: "FREQ=WEEKLY;UNTIL=20261231", want: "FREQ=WEEKLY;UNTIL=20261231"},
+		{rule: "FREQ=WEEKLY;UNTIL=20261231T235959Z;WKST=SU", want: "FREQ=WEEKLY;UNTIL=20261231T235959Z;WKST=SU"},
+		{rule: "", invalid: true},
+		{rule: "RRULE:", invalid: true},
+		{rule: "BYDAY=MO", invalid: true},
+		{rule: "FREQ=FORTNIGHTLY", invalid: true},
+		{rule: "FREQ=WEEKLY;BYDAY", invalid: true},
+		{rule: "FREQ=WEEKLY;BYDAY=", invalid: true},
+		{rule: "FREQ=WEEKLY;FREQ=DAILY", invalid: true},
+		{rule: "FREQ=WEEKLY;BYEASTER=1", invalid: true},
+		{rule: "FREQ=WEEKLY;COUNT=0", invalid: true},
+		{rule: "FREQ=WEEKLY;INTERVAL=-1", invalid: true},
+		{rule: "FREQ=WEEKLY;COUNT=2;UNTIL=20261231", invalid: true},
+		{rule: "FREQ=WEEKLY;UNTIL=20261231T235959", invalid: true},
+		{rule: "FREQ=WEEKLY;UNTIL=2026-12-31", invalid: true},
+		{rule: "FREQ=WEEKLY;BYDAY=MO\r\nATTENDEE:mailto:someone@example.com", invalid: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseRecurrenceRule(test.rule)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("ParseRecurrenceRule(%q) = %q, want an error", test.rule, got)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("ParseRecurrenceRule(%q) failed: %v", test.rule, err)
+		} else if got != test.want {
+			t.Errorf("ParseRecurrenceRule(%q) = %q, want %q", test.rule, got, test.want)
+		}
+	}
+}
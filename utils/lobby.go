@@ -0,0 +1,59 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+)
+
+// maxLobbyNameLength is the longest display name in runes shown to hosts for a participant waiting in a lobby
+const maxLobbyNameLength = 64
+
+// GenerateLobbyTicket generates the secret handed to a participant waiting in a lobby
+func GenerateLobbyTicket() (string, error) {
+	ticket := make([]byte, 32)
+	_, err := rand.Read(ticket)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(ticket), nil
+}
+
+// HashLobbyTicket returns the hash under which the lobby ticket is stored
+func HashLobbyTicket(ticket string) string {
+	hash := sha256.Sum256([]byte(ticket))
+	return hex.EncodeToString(hash[:])
+}
+
+// LobbyDisplayName returns the name shown to hosts for a participant waiting in a lobby.
+// The display name chosen by the participant takes precedence over the name of their account.
+func LobbyDisplayName(user *models.UserAccount, displayName string) string {
+	name := strings.TrimSpace(displayName)
+	if name == "" && user != nil && user.UserName.Valid {
+		name = strings.TrimSpace(user.UserName.String)
+	}
+
+	if name == "" {
+		return guestAccount
+	}
+
+	if runes := []rune(name); len(runes) > maxLobbyNameLength {
+		return strings.TrimSpace(string(runes[:maxLobbyNameLength]))
+	}
+
+	return name
+}
@@ -12,12 +12,22 @@ package utils
 
 import (
 	"crypto/rand"
+	"encoding/binary"
 	"io"
 	mrand "math/rand"
+	"time"
 
 	"github.com/gofrs/uuid"
 )
 
+// init seeds RandomRange so that restarted servers do not hand out the same sequence of UIDs
+func init() {
+	var seed [8]byte
+	rand.Read(seed[:])
+
+	mrand.Seed(int64(binary.LittleEndian.Uint64(seed[:])) ^ time.Now().UnixNano())
+}
+
 // GenerateDTMF generates a random string of 8 digits
 func GenerateDTMF() (*string, error) {
 	const size = 8
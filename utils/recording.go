@@ -11,24 +11,29 @@
 package utils
 
 import (
-	"bytes"
-	"encoding/json"
-	"net/http"
+	"context"
+	"errors"
 	"strconv"
-	"time"
+)
 
-	"github.com/spf13/viper"
+// Modes supported by Cloud Recording
+const (
+	RecordingModeMix        = "mix"
+	RecordingModeIndividual = "individual"
 )
 
 // Recorder manages cloud recording
 type Recorder struct {
-	http.Client
+	Client  RecordingClient
+	Mode    string
 	Channel string
 	Token   string
 	UID     int32
 	RID     string
 	SID     string
-	Logger  *Logger
+	// FileNamePrefix is the storage prefix of the recorded files once the recording has started
+	FileNamePrefix []string
+	Logger         *Logger
 }
 
 type AcquireClientRequest struct {
@@ -42,31 +47,63 @@ type AcquireRequest struct {
 }
 
 type TranscodingConfig struct {
-	Height           int    `json:"height"`
-	Width            int    `json:"width"`
-	Bitrate          int    `json:"bitrate"`
-	Fps              int    `json:"fps"`
-	MixedVideoLayout int    `json:"mixedVideoLayout"`
-	MaxResolutionUID string `json:"maxResolutionUid,omitempty"`
-	BackgroundColor  string `json:"backgroundColor"`
+	Height           int            `json:"height"`
+	Width            int            `json:"width"`
+	Bitrate          int            `json:"bitrate"`
+	Fps              int            `json:"fps"`
+	MixedVideoLayout int            `json:"mixedVideoLayout"`
+	MaxResolutionUID string         `json:"maxResolutionUid,omitempty"`
+	BackgroundColor  string         `json:"backgroundColor"`
+	BackgroundImage  string         `json:"backgroundImage,omitempty"`
+	LayoutConfig     []LayoutConfig `json:"layoutConfig,omitempty"`
 }
 
 type RecordingConfig struct {
-	MaxIdleTime       int               `json:"maxIdleTime"`
-	StreamTypes       int               `json:"streamTypes"`
-	ChannelType       int               `json:"channelType"`
-	DecryptionMode    int               `json:"decryptionMode,omitempty"`
-	Secret            string            `json:"secret,omitempty"`
-	TranscodingConfig TranscodingConfig `json:"transcodingConfig"`
+	MaxIdleTime       int                `json:"maxIdleTime"`
+	StreamTypes       int                `json:"streamTypes"`
+	ChannelType       int                `json:"channelType"`
+	DecryptionMode    int                `json:"decryptionMode,omitempty"`
+	Secret            string             `json:"secret,omitempty"`
+	TranscodingConfig *TranscodingConfig `json:"transcodingConfig,omitempty"`
+
+	SubscribeAudioUIDs   []string `json:"subscribeAudioUids,omitempty"`
+	SubscribeVideoUIDs   []string `json:"subscribeVideoUids,omitempty"`
+	UnsubscribeAudioUIDs []string `json:"unSubscribeAudioUids,omitempty"`
+	UnsubscribeVideoUIDs []string `json:"unSubscribeVideoUids,omitempty"`
+}
+
+// Subscription restricts the UIDs whose streams are recorded.
+// Only one of SubscribeUIDs and UnsubscribeUIDs can be set.
+type Subscription struct {
+	SubscribeUIDs   []string
+	UnsubscribeUIDs []string
+}
+
+// Validate checks that the allow and deny lists are not used together
+func (s *Subscription) Validate() error {
+	if len(s.SubscribeUIDs) > 0 && len(s.UnsubscribeUIDs) > 0 {
+		return errors.New("Subscribe and unsubscribe UIDs cannot be used together")
+	}
+
+	return nil
+}
+
+// mode returns the mode of the recording, defaulting to mix
+func (rec *Recorder) mode() string {
+	if rec.Mode == "" {
+		return RecordingModeMix
+	}
+
+	return rec.Mode
 }
 
 type StorageConfig struct {
-	Vendor         int      `json:"vendor"`
-	Region         int      `json:"region"`
-	Bucket         string   `json:"bucket"`
-	AccessKey      string   `json:"accessKey"`
-	SecretKey      string   `json:"secretKey"`
-	FileNamePrefix []string `json:"fileNamePrefix"`
+	Vendor         StorageVendor `json:"vendor"`
+	Region         StorageRegion `json:"region"`
+	Bucket         string        `json:"bucket"`
+	AccessKey      string        `json:"accessKey"`
+	SecretKey      string        `json:"secretKey"`
+	FileNamePrefix []string      `json:"fileNamePrefix"`
 }
 
 type RecordingFileConfig struct {
@@ -74,10 +111,11 @@ type RecordingFileConfig struct {
 }
 
 type ClientRequest struct {
-	Token               string              `json:"token"`
-	RecordingConfig     RecordingConfig     `json:"recordingConfig"`
-	RecordingFileConfig RecordingFileConfig `json:"recordingFileConfig"`
-	StorageConfig       StorageConfig       `json:"storageConfig"`
+	Token               string               `json:"token"`
+	RecordingConfig     RecordingConfig      `json:"recordingConfig"`
+	RecordingFileConfig *RecordingFileConfig `json:"recordingFileConfig,omitempty"`
+	SnapshotConfig      *SnapshotConfig      `json:"snapshotConfig,omitempty"`
+	StorageConfig       StorageConfig        `json:"storageConfig"`
 }
 
 type StartRecordRequest struct {
@@ -87,85 +125,79 @@ type StartRecordRequest struct {
 }
 
 // Acquire runs the acquire endpoint for Cloud Recording
-func (rec *Recorder) Acquire() error {
-	creds, err := GenerateUserCredentials(rec.Channel, false, false)
-	if err != nil {
-		return err
+func (rec *Recorder) Acquire(ctx context.Context) error {
+	if rec.UID == 0 || rec.Token == "" {
+		return errors.New("Recorder has no credentials")
 	}
 
-	rec.UID = int32(creds.UID)
-	rec.Token = creds.Rtc
-
-	requestBody, err := json.Marshal(&AcquireRequest{
+	result, err := rec.Client.Acquire(ctx, AcquireRequest{
 		Cname: rec.Channel,
 		UID:   strconv.Itoa(int(rec.UID)),
 		ClientRequest: AcquireClientRequest{
 			ResourceExpiredHour: 24,
 		},
 	})
-
-	req, err := http.NewRequest("POST", "https://api.agora.io/v1/apps/"+viper.GetString("APP_ID")+"/cloud_recording/acquire",
-		bytes.NewBuffer(requestBody))
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth(viper.GetString("CUSTOMER_ID"), viper.GetString("CUSTOMER_CERTIFICATE"))
-
-	resp, err := rec.Do(req)
 	if err != nil {
 		return err
 	}
 
-	defer resp.Body.Close()
-
-	var result map[string]string
-	json.NewDecoder(resp.Body).Decode(&result)
-
-	rec.RID = result["resourceId"]
+	rec.RID = result.ResourceID
 
 	rec.Logger.Debug().Interface("Result", result).Msg("Recording Result")
 
 	return nil
 }
 
-// Start starts the recording
-func (rec *Recorder) Start(channelTitle string, secret *string) error {
-	// currentTime := strconv.FormatInt(time.Now().Unix(), 10)
-	location, err := time.LoadLocation("America/Los_Angeles")
+// Start starts the recording with the settings of the recording profile.
+// The files are stored under fileNamePrefix, which should be built with FilePrefixTemplate.
+// The subscription is optional and records every UID when it is nil.
+// The files are uploaded to the storage destination chosen for the channel.
+func (rec *Recorder) Start(ctx context.Context, fileNamePrefix []string, secret *string, profile *RecordingProfile, subscription *Subscription, storage *StorageDestination) error {
+	err := profile.SupportsMode(rec.mode())
 	if err != nil {
 		return err
 	}
-	currentTimeStamp := time.Now().In(location)
-	currentDate := currentTimeStamp.Format("20060102")
-	currentTime := currentTimeStamp.Format("150405")
-
-	transcodingConfig := TranscodingConfig{
-		Height:           720,
-		Width:            1280,
-		Bitrate:          2260,
-		Fps:              15,
-		MixedVideoLayout: 1,
-		BackgroundColor:  "#000000",
+
+	if subscription != nil {
+		err = subscription.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	var transcodingConfig *TranscodingConfig
+	if profile.HasVideo() && rec.mode() == RecordingModeMix {
+		transcodingConfig = &TranscodingConfig{
+			Height:           profile.Height,
+			Width:            profile.Width,
+			Bitrate:          profile.Bitrate,
+			Fps:              profile.Fps,
+			MixedVideoLayout: profile.MixedVideoLayout,
+			BackgroundColor:  profile.BackgroundColor,
+		}
+	}
+
+	recordingConfig := RecordingConfig{
+		MaxIdleTime:       profile.MaxIdleTime,
+		StreamTypes:       profile.StreamTypes,
+		ChannelType:       1,
+		TranscodingConfig: transcodingConfig,
 	}
-	var recordingConfig RecordingConfig
+
 	if secret != nil && *secret != "" {
+		recordingConfig.DecryptionMode = 1
+		recordingConfig.Secret = *secret
+	}
 
-		recordingConfig = RecordingConfig{
-			MaxIdleTime:       30,
-			StreamTypes:       2,
-			ChannelType:       1,
-			DecryptionMode:    1,
-			Secret:            *secret,
-			TranscodingConfig: transcodingConfig,
+	if subscription != nil {
+		if profile.StreamTypes != StreamTypeVideo {
+			recordingConfig.SubscribeAudioUIDs = subscription.SubscribeUIDs
+			recordingConfig.UnsubscribeAudioUIDs = subscription.UnsubscribeUIDs
 		}
-	} else {
-		recordingConfig = RecordingConfig{
-			MaxIdleTime:       30,
-			StreamTypes:       2,
-			ChannelType:       1,
-			TranscodingConfig: transcodingConfig,
+
+		if profile.HasVideo() {
+			recordingConfig.SubscribeVideoUIDs = subscription.SubscribeUIDs
+			recordingConfig.UnsubscribeVideoUIDs = subscription.UnsubscribeUIDs
 		}
 	}
 
@@ -175,17 +207,15 @@ func (rec *Recorder) Start(channelTitle string, secret *string) error {
 		ClientRequest: ClientRequest{
 			Token: rec.Token,
 			StorageConfig: StorageConfig{
-				Vendor:    viper.GetInt("RECORDING_VENDOR"),
-				Region:    viper.GetInt("RECORDING_REGION"),
-				Bucket:    viper.GetString("BUCKET_NAME"),
-				AccessKey: viper.GetString("BUCKET_ACCESS_KEY"),
-				SecretKey: viper.GetString("BUCKET_ACCESS_SECRET"),
-				FileNamePrefix: []string{
-					channelTitle, currentDate, currentTime,
-				},
+				Vendor:         storage.Vendor,
+				Region:         storage.Region,
+				Bucket:         storage.Bucket,
+				AccessKey:      storage.AccessKey,
+				SecretKey:      storage.SecretKey,
+				FileNamePrefix: fileNamePrefix,
 			},
-			RecordingFileConfig: RecordingFileConfig{
-				AVFileType: []string{"hls", "mp4"},
+			RecordingFileConfig: &RecordingFileConfig{
+				AVFileType: profile.AVFileType,
 			},
 			RecordingConfig: recordingConfig,
 		},
@@ -193,121 +223,115 @@ func (rec *Recorder) Start(channelTitle string, secret *string) error {
 
 	rec.Logger.Info().Interface("Start Request", recordingRequest).Msg("Recording request")
 
-	requestBody, err := json.Marshal(&recordingRequest)
+	result, err := rec.Client.Start(ctx, rec.RID, rec.mode(), recordingRequest)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", "https://api.agora.io/v1/apps/"+viper.GetString("APP_ID")+"/cloud_recording/resourceid/"+rec.RID+"/mode/mix/start",
-		bytes.NewBuffer(requestBody))
-	if err != nil {
-		return err
-	}
+	rec.SID = result.SID
+	rec.FileNamePrefix = fileNamePrefix
+
+	rec.Logger.Debug().Interface("Result", result).Msg("Recording Result")
 
-	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth(viper.GetString("CUSTOMER_ID"), viper.GetString("CUSTOMER_CERTIFICATE"))
+	return nil
+}
 
-	resp, err := rec.Do(req)
+// Query fetches the current status of the recording
+func (rec *Recorder) Query(ctx context.Context) (*QueryResponse, error) {
+	result, err := rec.Client.Query(ctx, rec.RID, rec.SID, rec.mode())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	defer resp.Body.Close()
-
-	var result map[string]string
-	json.NewDecoder(resp.Body).Decode(&result)
-	rec.SID = result["sid"]
+	rec.Logger.Debug().Interface("Result", result).Msg("Query Recording Result")
 
-	rec.Logger.Debug().Interface("Result", result).Msg("Recording Result")
+	return result, nil
+}
 
-	return nil
+// UpdateLayoutClientRequest holds the fields of the transcoding config that can be changed while recording.
+// The canvas size, bitrate and frame rate are fixed when the recording starts, so updateLayout rejects them.
+type UpdateLayoutClientRequest struct {
+	MixedVideoLayout int            `json:"mixedVideoLayout,omitempty"`
+	MaxResolutionUID string         `json:"maxResolutionUid,omitempty"`
+	BackgroundColor  string         `json:"backgroundColor,omitempty"`
+	BackgroundImage  string         `json:"backgroundImage,omitempty"`
+	LayoutConfig     []LayoutConfig `json:"layoutConfig,omitempty"`
 }
 
+// UpdateRecordRequest changes the layout of a mixed recording through the updateLayout endpoint
 type UpdateRecordRequest struct {
-	Cname         string            `json:"cname"`
-	UID           string            `json:"uid"`
-	ClientRequest TranscodingConfig `json:"clientRequest"`
+	Cname         string                    `json:"cname"`
+	UID           string                    `json:"uid"`
+	ClientRequest UpdateLayoutClientRequest `json:"clientRequest"`
 }
 
-func ChangeRecordingMode(channel string, uid int, rid string, sid string, mode int, maxUID string, logger *Logger) error {
-	recordingRequest := UpdateRecordRequest{
-		Cname: channel,
-		UID:   strconv.Itoa(uid),
-		ClientRequest: TranscodingConfig{
-			MixedVideoLayout: mode,
-			MaxResolutionUID: maxUID,
-		},
-	}
+type AudioUIDList struct {
+	SubscribeAudioUIDs   []string `json:"subscribeAudioUids,omitempty"`
+	UnsubscribeAudioUIDs []string `json:"unSubscribeAudioUids,omitempty"`
+}
 
-	logger.Info().Interface("Change Recording", recordingRequest).Msg("Change Recording Mode")
+type VideoUIDList struct {
+	SubscribeVideoUIDs   []string `json:"subscribeVideoUids,omitempty"`
+	UnsubscribeVideoUIDs []string `json:"unSubscribeVideoUids,omitempty"`
+}
 
-	requestBody, err := json.Marshal(&recordingRequest)
+type StreamSubscribe struct {
+	AudioUIDList *AudioUIDList `json:"audioUidList,omitempty"`
+	VideoUIDList *VideoUIDList `json:"videoUidList,omitempty"`
+}
 
-	if err != nil {
-		return err
-	}
+type UpdateSubscriptionClientRequest struct {
+	StreamSubscribe StreamSubscribe `json:"streamSubscribe"`
+}
 
-	req, err := http.NewRequest("POST", "https://api.agora.io/v1/apps/"+viper.GetString("APP_ID")+"/cloud_recording/resourceid/"+rid+"/sid/"+sid+"/mode/mix/update",
-		bytes.NewBuffer(requestBody))
-	if err != nil {
-		return err
+// UpdateSubscriptionRequest changes the subscribed UIDs of a recording through the update endpoint
+type UpdateSubscriptionRequest struct {
+	Cname         string                          `json:"cname"`
+	UID           string                          `json:"uid"`
+	ClientRequest UpdateSubscriptionClientRequest `json:"clientRequest"`
+}
+
+// ChangeRecordingMode changes the mixed video layout of the recording
+func (rec *Recorder) ChangeRecordingMode(ctx context.Context, mode int, maxUID string) error {
+	recordingRequest := UpdateRecordRequest{
+		Cname: rec.Channel,
+		UID:   strconv.Itoa(int(rec.UID)),
+		ClientRequest: UpdateLayoutClientRequest{
+			MixedVideoLayout: mode,
+			MaxResolutionUID: maxUID,
+		},
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth(viper.GetString("CUSTOMER_ID"), viper.GetString("CUSTOMER_CERTIFICATE"))
+	rec.Logger.Info().Interface("Change Recording", recordingRequest).Msg("Change Recording Mode")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	result, err := rec.Client.UpdateLayout(ctx, rec.RID, rec.SID, rec.mode(), recordingRequest)
 	if err != nil {
 		return err
 	}
 
-	defer resp.Body.Close()
-
-	var result map[string]string
-	json.NewDecoder(resp.Body).Decode(&result)
-
-	logger.Info().Interface("response", result).Msg("Update Cloud Recording Response")
+	rec.Logger.Info().Interface("response", result).Msg("Update Cloud Recording Response")
 
 	return nil
-
 }
 
 // Stop stops the cloud recording
-func Stop(channel string, uid int, rid string, sid string, logger *Logger) error {
+func (rec *Recorder) Stop(ctx context.Context) (*StopResponse, error) {
 	recordingRequest := AcquireRequest{
-		Cname:         channel,
-		UID:           strconv.Itoa(uid),
+		Cname:         rec.Channel,
+		UID:           strconv.Itoa(int(rec.UID)),
 		ClientRequest: AcquireClientRequest{},
 	}
 
-	logger.Info().Interface("Stop Request", recordingRequest).Msg("Stop Recording Request")
+	rec.Logger.Info().Interface("Stop Request", recordingRequest).Msg("Stop Recording Request")
 
-	requestBody, err := json.Marshal(&recordingRequest)
-
-	req, err := http.NewRequest("POST", "https://api.agora.io/v1/apps/"+viper.GetString("APP_ID")+"/cloud_recording/resourceid/"+rid+"/sid/"+sid+"/mode/mix/stop",
-		bytes.NewBuffer([]byte(requestBody)))
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth(viper.GetString("CUSTOMER_ID"), viper.GetString("CUSTOMER_CERTIFICATE"))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	result, err := rec.Client.Stop(ctx, rec.RID, rec.SID, rec.mode(), recordingRequest)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	defer resp.Body.Close()
-
-	var result map[string]string
-	json.NewDecoder(resp.Body).Decode(&result)
+	rec.Logger.Info().Interface("response", result).Msg("Stop Cloud Recording Response")
 
-	logger.Info().Interface("response", result).Msg("Stop Cloud Recording Response")
-
-	return nil
+	return result, nil
 }
 
 // FirstN is to return the first N characters of a string
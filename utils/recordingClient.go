@@ -0,0 +1,315 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// RecordingClient is used to call the Agora Cloud Recording REST API
+type RecordingClient interface {
+	Acquire(ctx context.Context, request AcquireRequest) (*AcquireResponse, error)
+	Start(ctx context.Context, resourceID string, mode string, request StartRecordRequest) (*StartResponse, error)
+	Query(ctx context.Context, resourceID string, sid string, mode string) (*QueryResponse, error)
+	Update(ctx context.Context, resourceID string, sid string, mode string, request UpdateSubscriptionRequest) (*UpdateResponse, error)
+	UpdateLayout(ctx context.Context, resourceID string, sid string, mode string, request UpdateRecordRequest) (*UpdateResponse, error)
+	Stop(ctx context.Context, resourceID string, sid string, mode string, request AcquireRequest) (*StopResponse, error)
+}
+
+// AcquireResponse is the response of the acquire endpoint
+type AcquireResponse struct {
+	ResourceID string `json:"resourceId"`
+}
+
+// StartResponse is the response of the start endpoint
+type StartResponse struct {
+	ResourceID string `json:"resourceId"`
+	SID        string `json:"sid"`
+}
+
+// UpdateResponse is the response of the update and updateLayout endpoints
+type UpdateResponse struct {
+	ResourceID string `json:"resourceId"`
+	SID        string `json:"sid"`
+}
+
+// RecordingFile is a single file uploaded by cloud recording
+type RecordingFile struct {
+	FileName       string `json:"filename"`
+	TrackType      string `json:"trackType"`
+	UID            string `json:"uid"`
+	MixedAllUser   bool   `json:"mixedAllUser"`
+	IsPlayable     bool   `json:"isPlayable"`
+	SliceStartTime int64  `json:"sliceStartTime"`
+}
+
+// ServerResponse contains the recording details returned by the query and stop endpoints
+type ServerResponse struct {
+	FileListMode    string          `json:"fileListMode,omitempty"`
+	FileList        json.RawMessage `json:"fileList,omitempty"`
+	Status          int             `json:"status,omitempty"`
+	SliceStartTime  int64           `json:"sliceStartTime,omitempty"`
+	UploadingStatus string          `json:"uploadingStatus,omitempty"`
+}
+
+// Files returns the file list irrespective of whether it was returned as a string or as json
+func (s *ServerResponse) Files() ([]RecordingFile, error) {
+	if len(s.FileList) == 0 {
+		return []RecordingFile{}, nil
+	}
+
+	if s.FileListMode == "json" {
+		var files []RecordingFile
+		err := json.Unmarshal(s.FileList, &files)
+		if err != nil {
+			return nil, err
+		}
+
+		return files, nil
+	}
+
+	var fileName string
+	err := json.Unmarshal(s.FileList, &fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if fileName == "" {
+		return []RecordingFile{}, nil
+	}
+
+	return []RecordingFile{
+		{
+			FileName:       fileName,
+			MixedAllUser:   true,
+			IsPlayable:     true,
+			SliceStartTime: s.SliceStartTime,
+		},
+	}, nil
+}
+
+// QueryResponse is the response of the query endpoint
+type QueryResponse struct {
+	ResourceID     string         `json:"resourceId"`
+	SID            string         `json:"sid"`
+	ServerResponse ServerResponse `json:"serverResponse"`
+}
+
+// StopResponse is the response of the stop endpoint
+type StopResponse struct {
+	ResourceID     string         `json:"resourceId"`
+	SID            string         `json:"sid"`
+	ServerResponse ServerResponse `json:"serverResponse"`
+}
+
+// RecordingError is returned when the Cloud Recording API responds with a non 2xx status code
+type RecordingError struct {
+	StatusCode int
+	Code       int    `json:"code"`
+	Reason     string `json:"reason"`
+}
+
+func (e *RecordingError) Error() string {
+	return fmt.Sprintf("Cloud Recording returned status code %d (code %d): %s", e.StatusCode, e.Code, e.Reason)
+}
+
+// IsRecordingNotFound reports whether the error means the recording session no longer exists
+func IsRecordingNotFound(err error) bool {
+	var recordingErr *RecordingError
+	if !errors.As(err, &recordingErr) {
+		return false
+	}
+
+	return recordingErr.StatusCode == http.StatusNotFound || recordingErr.Code == 404 || recordingErr.Code == 435
+}
+
+// AgoraRecordingClient is the RecordingClient for the Agora REST API.
+// Requests failing with a network error, 429 or a 5xx status code are retried
+// with exponential backoff and jitter up to MaxRetries times.
+type AgoraRecordingClient struct {
+	Client              *http.Client
+	BaseURL             string
+	AppID               string
+	CustomerID          string
+	CustomerCertificate string
+	MaxRetries          int
+	RetryDelay          time.Duration
+}
+
+// NewRecordingClient creates a RecordingClient from the recording configuration.
+// The HTTP client is shared by every request so that connections are reused.
+func NewRecordingClient() *AgoraRecordingClient {
+	return &AgoraRecordingClient{
+		Client: &http.Client{
+			Timeout: time.Duration(viper.GetInt("RECORDING_TIMEOUT")) * time.Second,
+		},
+		BaseURL:             strings.TrimSuffix(viper.GetString("RECORDING_BASE_URL"), "/"),
+		AppID:               viper.GetString("APP_ID"),
+		CustomerID:          viper.GetString("CUSTOMER_ID"),
+		CustomerCertificate: viper.GetString("CUSTOMER_CERTIFICATE"),
+		MaxRetries:          viper.GetInt("RECORDING_MAX_RETRIES"),
+		RetryDelay:          time.Duration(viper.GetInt("RECORDING_RETRY_DELAY")) * time.Millisecond,
+	}
+}
+
+func (c *AgoraRecordingClient) url(path string) string {
+	return c.BaseURL + "/apps/" + c.AppID + "/cloud_recording/" + path
+}
+
+// backoff returns the delay before the given retry, picked at random between half and all of the exponential backoff
+func (c *AgoraRecordingClient) backoff(retry int) time.Duration {
+	delay := c.RetryDelay << uint(retry)
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(mrand.Int63n(int64(delay/2)+1))
+}
+
+func (c *AgoraRecordingClient) do(ctx context.Context, method string, path string, request interface{}, result interface{}) error {
+	var body []byte
+	if request != nil {
+		encoded, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+
+		body = encoded
+	}
+
+	for retry := 0; ; retry++ {
+		retryable, err := c.send(ctx, method, path, body, result)
+		if err == nil || !retryable || retry >= c.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(c.backoff(retry))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// send makes a single request and reports whether it can be retried when it fails
+func (c *AgoraRecordingClient) send(ctx context.Context, method string, path string, body []byte, result interface{}) (bool, error) {
+	req, err := http.NewRequest(method, c.url(path), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(c.CustomerID, c.CustomerCertificate)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		recordingErr := &RecordingError{
+			StatusCode: resp.StatusCode,
+		}
+		json.NewDecoder(resp.Body).Decode(recordingErr)
+		return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, recordingErr
+	}
+
+	return false, json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Acquire gets a resource ID for the channel
+func (c *AgoraRecordingClient) Acquire(ctx context.Context, request AcquireRequest) (*AcquireResponse, error) {
+	var result AcquireResponse
+	err := c.do(ctx, "POST", "acquire", &request, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.ResourceID == "" {
+		return nil, errors.New("Empty resourceId in acquire response")
+	}
+
+	return &result, nil
+}
+
+// Start starts recording the channel
+func (c *AgoraRecordingClient) Start(ctx context.Context, resourceID string, mode string, request StartRecordRequest) (*StartResponse, error) {
+	var result StartResponse
+	err := c.do(ctx, "POST", "resourceid/"+resourceID+"/mode/"+mode+"/start", &request, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.SID == "" {
+		return nil, errors.New("Empty sid in start response")
+	}
+
+	return &result, nil
+}
+
+// Query fetches the status of a recording
+func (c *AgoraRecordingClient) Query(ctx context.Context, resourceID string, sid string, mode string) (*QueryResponse, error) {
+	var result QueryResponse
+	err := c.do(ctx, "GET", "resourceid/"+resourceID+"/sid/"+sid+"/mode/"+mode+"/query", nil, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Update changes the UIDs that a running recording subscribes to
+func (c *AgoraRecordingClient) Update(ctx context.Context, resourceID string, sid string, mode string, request UpdateSubscriptionRequest) (*UpdateResponse, error) {
+	var result UpdateResponse
+	err := c.do(ctx, "POST", "resourceid/"+resourceID+"/sid/"+sid+"/mode/"+mode+"/update", &request, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// UpdateLayout changes the video layout of a running mixed recording
+func (c *AgoraRecordingClient) UpdateLayout(ctx context.Context, resourceID string, sid string, mode string, request UpdateRecordRequest) (*UpdateResponse, error) {
+	var result UpdateResponse
+	err := c.do(ctx, "POST", "resourceid/"+resourceID+"/sid/"+sid+"/mode/"+mode+"/updateLayout", &request, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Stop stops a recording
+func (c *AgoraRecordingClient) Stop(ctx context.Context, resourceID string, sid string, mode string, request AcquireRequest) (*StopResponse, error) {
+	var result StopResponse
+	err := c.do(ctx, "POST", "resourceid/"+resourceID+"/sid/"+sid+"/mode/"+mode+"/stop", &request, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
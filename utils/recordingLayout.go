@@ -0,0 +1,162 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// MixedVideoLayoutCustom is the mixedVideoLayout used for custom layouts
+const MixedVideoLayoutCustom = 3
+
+// maxLayoutRegions is the maximum number of regions allowed in a custom layout
+const maxLayoutRegions = 17
+
+// Render modes of a region in a custom layout
+const (
+	RenderModeCrop = 0
+	RenderModeFit  = 1
+)
+
+// LayoutConfig is a single region of a custom layout as expected by Cloud Recording.
+// The position and size are relative to the canvas.
+type LayoutConfig struct {
+	UID        string  `json:"uid"`
+	XAxis      float64 `json:"x_axis"`
+	YAxis      float64 `json:"y_axis"`
+	Width      float64 `json:"width"`
+	Height     float64 `json:"height"`
+	Alpha      float64 `json:"alpha"`
+	RenderMode int     `json:"render_mode"`
+}
+
+// LayoutRegion is a region of a custom layout in pixels of the canvas
+type LayoutRegion struct {
+	UID        int
+	X          int
+	Y          int
+	Width      int
+	Height     int
+	Alpha      float64
+	RenderMode int
+}
+
+// CustomLayout places the video of each UID in its own region of the canvas
+type CustomLayout struct {
+	Regions         []LayoutRegion
+	BackgroundColor string
+	BackgroundImage string
+}
+
+// Validate checks the layout against the canvas of the recording profile
+func (l *CustomLayout) Validate(profile *RecordingProfile) error {
+	if !profile.HasVideo() {
+		return errors.New("Layouts cannot be used for audio only recordings")
+	}
+
+	if len(l.Regions) == 0 || len(l.Regions) > maxLayoutRegions {
+		return fmt.Errorf("A layout must have between 1 and %d regions", maxLayoutRegions)
+	}
+
+	seen := map[int]bool{}
+	for _, region := range l.Regions {
+		if seen[region.UID] {
+			return fmt.Errorf("UID %d has more than one region", region.UID)
+		}
+		seen[region.UID] = true
+
+		if region.X < 0 || region.Y < 0 || region.Width <= 0 || region.Height <= 0 {
+			return fmt.Errorf("Region of UID %d has an invalid position or size", region.UID)
+		}
+
+		if region.X+region.Width > profile.Width || region.Y+region.Height > profile.Height {
+			return fmt.Errorf("Region of UID %d does not fit in the %dx%d canvas", region.UID, profile.Width, profile.Height)
+		}
+
+		if region.Alpha < 0 || region.Alpha > 1 {
+			return fmt.Errorf("Region of UID %d has an alpha outside of 0 and 1", region.UID)
+		}
+
+		if region.RenderMode != RenderModeCrop && region.RenderMode != RenderModeFit {
+			return fmt.Errorf("Region of UID %d has an invalid render mode", region.UID)
+		}
+	}
+
+	if l.BackgroundColor != "" && !colorRegex.MatchString(l.BackgroundColor) {
+		return fmt.Errorf("Invalid backgroundColor %s", l.BackgroundColor)
+	}
+
+	if l.BackgroundImage != "" {
+		imageURL, err := url.Parse(l.BackgroundImage)
+		if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") || imageURL.Host == "" {
+			return fmt.Errorf("Invalid backgroundImage %s", l.BackgroundImage)
+		}
+	}
+
+	return nil
+}
+
+// layoutConfig converts the regions into positions relative to the canvas of the profile
+func (l *CustomLayout) layoutConfig(profile *RecordingProfile) []LayoutConfig {
+	config := []LayoutConfig{}
+	for _, region := range l.Regions {
+		config = append(config, LayoutConfig{
+			UID:        strconv.Itoa(region.UID),
+			XAxis:      float64(region.X) / float64(profile.Width),
+			YAxis:      float64(region.Y) / float64(profile.Height),
+			Width:      float64(region.Width) / float64(profile.Width),
+			Height:     float64(region.Height) / float64(profile.Height),
+			Alpha:      region.Alpha,
+			RenderMode: region.RenderMode,
+		})
+	}
+
+	return config
+}
+
+// SetLayout changes the recording to a custom layout on the canvas of the profile
+func (rec *Recorder) SetLayout(ctx context.Context, layout *CustomLayout, profile *RecordingProfile) error {
+	err := layout.Validate(profile)
+	if err != nil {
+		return err
+	}
+
+	backgroundColor := layout.BackgroundColor
+	if backgroundColor == "" {
+		backgroundColor = profile.BackgroundColor
+	}
+
+	recordingRequest := UpdateRecordRequest{
+		Cname: rec.Channel,
+		UID:   strconv.Itoa(int(rec.UID)),
+		ClientRequest: UpdateLayoutClientRequest{
+			MixedVideoLayout: MixedVideoLayoutCustom,
+			BackgroundColor:  backgroundColor,
+			BackgroundImage:  layout.BackgroundImage,
+			LayoutConfig:     layout.layoutConfig(profile),
+		},
+	}
+
+	rec.Logger.Info().Interface("Change Recording", recordingRequest).Msg("Set Custom Recording Layout")
+
+	result, err := rec.Client.UpdateLayout(ctx, rec.RID, rec.SID, rec.mode(), recordingRequest)
+	if err != nil {
+		return err
+	}
+
+	rec.Logger.Info().Interface("response", result).Msg("Update Cloud Recording Response")
+
+	return nil
+}
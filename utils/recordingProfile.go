@@ -0,0 +1,211 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultRecordingProfile is the name of the profile used when no profile is requested
+const DefaultRecordingProfile = "default"
+
+// Stream types supported by Cloud Recording
+const (
+	StreamTypeAudio         = 0
+	StreamTypeVideo         = 1
+	StreamTypeAudioAndVideo = 2
+)
+
+// RecordingProfile contains the recording settings that can be chosen when starting a recording
+type RecordingProfile struct {
+	Width            int      `mapstructure:"width" json:"width"`
+	Height           int      `mapstructure:"height" json:"height"`
+	Fps              int      `mapstructure:"fps" json:"fps"`
+	Bitrate          int      `mapstructure:"bitrate" json:"bitrate"`
+	MixedVideoLayout int      `mapstructure:"mixedVideoLayout" json:"mixedVideoLayout"`
+	BackgroundColor  string   `mapstructure:"backgroundColor" json:"backgroundColor"`
+	StreamTypes      int      `mapstructure:"streamTypes" json:"streamTypes"`
+	MaxIdleTime      int      `mapstructure:"maxIdleTime" json:"maxIdleTime"`
+	AVFileType       []string `mapstructure:"avFileType" json:"avFileType"`
+}
+
+// defaultRecordingProfiles are always available and can be overridden through RECORDING_PROFILES
+func defaultRecordingProfiles() map[string]RecordingProfile {
+	return map[string]RecordingProfile{
+		DefaultRecordingProfile: {
+			Width:            1280,
+			Height:           720,
+			Fps:              15,
+			Bitrate:          2260,
+			MixedVideoLayout: 1,
+			BackgroundColor:  "#000000",
+			StreamTypes:      StreamTypeAudioAndVideo,
+			MaxIdleTime:      30,
+			AVFileType:       []string{"hls", "mp4"},
+		},
+		"audio": {
+			StreamTypes: StreamTypeAudio,
+			MaxIdleTime: 30,
+			AVFileType:  []string{"hls"},
+		},
+		"webinar": {
+			Width:            1920,
+			Height:           1080,
+			Fps:              30,
+			Bitrate:          4780,
+			MixedVideoLayout: 1,
+			BackgroundColor:  "#000000",
+			StreamTypes:      StreamTypeAudioAndVideo,
+			MaxIdleTime:      30,
+			AVFileType:       []string{"hls", "mp4"},
+		},
+		"archive": {
+			Width:            640,
+			Height:           360,
+			Fps:              10,
+			Bitrate:          400,
+			MixedVideoLayout: 1,
+			BackgroundColor:  "#000000",
+			StreamTypes:      StreamTypeAudioAndVideo,
+			MaxIdleTime:      30,
+			AVFileType:       []string{"hls"},
+		},
+	}
+}
+
+var colorRegex = regexp.MustCompile("^#[0-9a-fA-F]{6}$")
+
+// HasVideo reports whether the profile records video streams
+func (p *RecordingProfile) HasVideo() bool {
+	return p.StreamTypes != StreamTypeAudio
+}
+
+// Validate checks the profile against the combinations allowed by Cloud Recording
+func (p *RecordingProfile) Validate() error {
+	if p.StreamTypes < StreamTypeAudio || p.StreamTypes > StreamTypeAudioAndVideo {
+		return fmt.Errorf("Invalid streamTypes %d", p.StreamTypes)
+	}
+
+	if p.MaxIdleTime < 5 || p.MaxIdleTime > 2592000 {
+		return fmt.Errorf("maxIdleTime must be between 5 and 2592000 seconds, got %d", p.MaxIdleTime)
+	}
+
+	hasHLS := false
+	for _, fileType := range p.AVFileType {
+		switch fileType {
+		case "hls":
+			hasHLS = true
+		case "mp4":
+			if !p.HasVideo() {
+				return fmt.Errorf("mp4 files cannot be generated for audio only recordings")
+			}
+		default:
+			return fmt.Errorf("Invalid avFileType %s", fileType)
+		}
+	}
+
+	if !hasHLS {
+		return fmt.Errorf("avFileType must contain hls")
+	}
+
+	if !p.HasVideo() {
+		return nil
+	}
+
+	if p.Width <= 0 || p.Height <= 0 || p.Width*p.Height > 1920*1080 {
+		return fmt.Errorf("Invalid resolution %dx%d", p.Width, p.Height)
+	}
+
+	if p.Fps < 1 || p.Fps > 30 {
+		return fmt.Errorf("fps must be between 1 and 30, got %d", p.Fps)
+	}
+
+	if p.Bitrate <= 0 {
+		return fmt.Errorf("bitrate must be positive, got %d", p.Bitrate)
+	}
+
+	if p.MixedVideoLayout < 0 || p.MixedVideoLayout > 2 {
+		return fmt.Errorf("Invalid mixedVideoLayout %d", p.MixedVideoLayout)
+	}
+
+	if !colorRegex.MatchString(p.BackgroundColor) {
+		return fmt.Errorf("Invalid backgroundColor %s", p.BackgroundColor)
+	}
+
+	return nil
+}
+
+// SupportsMode checks whether the profile can be used for the recording mode
+func (p *RecordingProfile) SupportsMode(mode string) error {
+	switch mode {
+	case RecordingModeMix:
+		return nil
+	case RecordingModeIndividual:
+		for _, fileType := range p.AVFileType {
+			if fileType != "hls" {
+				return errors.New("Individual recordings only support hls files")
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("Invalid recording mode %s", mode)
+	}
+}
+
+// LoadRecordingProfiles reads and validates the recording profiles from RECORDING_PROFILES.
+// RECORDING_PROFILES can either be an object in config.json or a JSON string in the environment.
+// Profile names are case insensitive and are returned in lower case, like viper does for config.json.
+func LoadRecordingProfiles() (map[string]RecordingProfile, error) {
+	profiles := defaultRecordingProfiles()
+	configured := map[string]RecordingProfile{}
+
+	if raw, ok := viper.Get("RECORDING_PROFILES").(string); ok {
+		if raw != "" {
+			err := json.Unmarshal([]byte(raw), &configured)
+			if err != nil {
+				return nil, fmt.Errorf("Could not parse RECORDING_PROFILES: %s", err)
+			}
+		}
+	} else if viper.IsSet("RECORDING_PROFILES") {
+		err := viper.UnmarshalKey("RECORDING_PROFILES", &configured)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse RECORDING_PROFILES: %s", err)
+		}
+	}
+
+	overridden := map[string]bool{}
+	for name, profile := range configured {
+		name = strings.ToLower(name)
+		if overridden[name] {
+			return nil, fmt.Errorf("Recording profile %s is configured more than once", name)
+		}
+
+		overridden[name] = true
+		profiles[name] = profile
+	}
+
+	for name := range profiles {
+		profile := profiles[name]
+		err := profile.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid recording profile %s: %s", name, err)
+		}
+	}
+
+	return profiles, nil
+}
@@ -0,0 +1,46 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadRecordingProfilesLowercasesEnvironmentNames(t *testing.T) {
+	viper.Set("RECORDING_PROFILES", `{"Webinar1080": {"width": 1920, "height": 1080, "fps": 30, "bitrate": 4780, "mixedVideoLayout": 1, "backgroundColor": "#000000", "streamTypes": 2, "maxIdleTime": 30, "avFileType": ["hls"]}}`)
+	defer viper.Set("RECORDING_PROFILES", "")
+
+	profiles, err := LoadRecordingProfiles()
+	if err != nil {
+		t.Fatalf("Could not load recording profiles: %v", err)
+	}
+
+	if _, ok := profiles["Webinar1080"]; ok {
+		t.Error("Profile name was not lowercased")
+	}
+
+	profile, ok := profiles["webinar1080"]
+	if !ok || profile.Width != 1920 {
+		t.Errorf("Profile webinar1080 was not loaded: %+v", profiles)
+	}
+}
+
+func TestLoadRecordingProfilesRejectsDuplicateNames(t *testing.T) {
+	viper.Set("RECORDING_PROFILES", `{"Audio": {"streamTypes": 0, "maxIdleTime": 30, "avFileType": ["hls"]}, "audio": {"streamTypes": 0, "maxIdleTime": 60, "avFileType": ["hls"]}}`)
+	defer viper.Set("RECORDING_PROFILES", "")
+
+	_, err := LoadRecordingProfiles()
+	if err == nil {
+		t.Error("Profiles differing only in case were accepted")
+	}
+}
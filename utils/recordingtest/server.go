@@ -0,0 +1,367 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+// Package recordingtest provides an in-process fake of the Agora Cloud Recording REST API
+package recordingtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+// Session is a recording session held by the fake server
+type Session struct {
+	ResourceID string
+	SID        string
+	Mode       string
+	Cname      string
+	UID        string
+	Start      utils.StartRecordRequest
+	// Updates are the requests made to the update endpoint, which changes the subscribed UIDs
+	Updates []json.RawMessage
+	// LayoutUpdates are the requests made to the updateLayout endpoint
+	LayoutUpdates []json.RawMessage
+	Status        int
+	Stopped       bool
+}
+
+// Server is an httptest based fake of the Agora Cloud Recording REST API
+type Server struct {
+	*httptest.Server
+	AppID               string
+	CustomerID          string
+	CustomerCertificate string
+
+	mu        sync.Mutex
+	nextID    int
+	resources map[string]utils.AcquireRequest
+	sessions  map[string]*Session
+	failures  map[string]int
+}
+
+// NewServer starts a fake Cloud Recording server
+func NewServer() *Server {
+	s := &Server{
+		AppID:               "appid",
+		CustomerID:          "customer",
+		CustomerCertificate: "certificate",
+		resources:           map[string]utils.AcquireRequest{},
+		sessions:            map[string]*Session{},
+		failures:            map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+// Client returns a RecordingClient that talks to the fake server
+func (s *Server) Client() *utils.AgoraRecordingClient {
+	return &utils.AgoraRecordingClient{
+		Client:              s.Server.Client(),
+		BaseURL:             s.URL + "/v1",
+		AppID:               s.AppID,
+		CustomerID:          s.CustomerID,
+		CustomerCertificate: s.CustomerCertificate,
+	}
+}
+
+// FailNext makes the next request to the given action (acquire, start, query, update, updateLayout or stop)
+// respond with the status code
+func (s *Server) FailNext(action string, statusCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[action] = statusCode
+}
+
+// Session returns a copy of the session with the given sid
+func (s *Server) Session(sid string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sid]
+	if !ok {
+		return Session{}, false
+	}
+
+	return *session, true
+}
+
+// Sessions returns a copy of all the sessions that were started
+func (s *Server) Sessions() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := []Session{}
+	for _, session := range s.sessions {
+		sessions = append(sessions, *session)
+	}
+
+	return sessions
+}
+
+// EndSession simulates a recording that exited on its own, for example because of maxIdleTime
+func (s *Server) EndSession(sid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.sessions[sid]; ok {
+		session.Stopped = true
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, statusCode int, code int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":   code,
+		"reason": reason,
+	})
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s%08d", prefix, s.nextID)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	customerID, customerCertificate, ok := r.BasicAuth()
+	if !ok || customerID != s.CustomerID || customerCertificate != s.CustomerCertificate {
+		s.writeError(w, http.StatusUnauthorized, 401, "Invalid authentication credentials")
+		return
+	}
+
+	prefix := "/v1/apps/" + s.AppID + "/cloud_recording/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		s.writeError(w, http.StatusNotFound, 404, "no Route matched with those values")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	action := parts[len(parts)-1]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if statusCode, ok := s.failures[action]; ok {
+		delete(s.failures, action)
+		s.writeError(w, statusCode, statusCode, "Injected failure")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && action == "acquire":
+		s.acquire(w, r)
+	case len(parts) == 5 && parts[0] == "resourceid" && parts[2] == "mode" && action == "start":
+		s.start(w, r, parts[1], parts[3])
+	case len(parts) == 7 && parts[0] == "resourceid" && parts[2] == "sid" && parts[4] == "mode":
+		s.session(w, r, parts[1], parts[3], parts[5], action)
+	default:
+		s.writeError(w, http.StatusNotFound, 404, "no Route matched with those values")
+	}
+}
+
+func (s *Server) acquire(w http.ResponseWriter, r *http.Request) {
+	var request utils.AcquireRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Cname == "" || request.UID == "" {
+		s.writeError(w, http.StatusBadRequest, 2, "Invalid acquire request")
+		return
+	}
+
+	resourceID := s.newID("resource")
+	s.resources[resourceID] = request
+
+	s.writeJSON(w, utils.AcquireResponse{
+		ResourceID: resourceID,
+	})
+}
+
+func (s *Server) start(w http.ResponseWriter, r *http.Request, resourceID string, mode string) {
+	acquired, ok := s.resources[resourceID]
+	if !ok {
+		s.writeError(w, http.StatusBadRequest, 2, "Invalid resource ID")
+		return
+	}
+
+	var request utils.StartRecordRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Cname != acquired.Cname || request.UID != acquired.UID {
+		s.writeError(w, http.StatusBadRequest, 2, "Invalid start request")
+		return
+	}
+
+	sid := s.newID("sid")
+	s.sessions[sid] = &Session{
+		ResourceID: resourceID,
+		SID:        sid,
+		Mode:       mode,
+		Cname:      request.Cname,
+		UID:        request.UID,
+		Start:      request,
+		Status:     5,
+	}
+
+	s.writeJSON(w, utils.StartResponse{
+		ResourceID: resourceID,
+		SID:        sid,
+	})
+}
+
+func (s *Server) session(w http.ResponseWriter, r *http.Request, resourceID string, sid string, mode string, action string) {
+	session, ok := s.sessions[sid]
+	if !ok || session.ResourceID != resourceID || session.Mode != mode {
+		s.writeError(w, http.StatusNotFound, 404, "Failed to find worker")
+		return
+	}
+
+	if session.Stopped {
+		s.writeError(w, http.StatusNotFound, 435, "No recorded files created")
+		return
+	}
+
+	switch action {
+	case "query":
+		s.writeJSON(w, utils.QueryResponse{
+			ResourceID: resourceID,
+			SID:        sid,
+			ServerResponse: utils.ServerResponse{
+				FileListMode: "json",
+				FileList:     s.fileList(session),
+				Status:       session.Status,
+			},
+		})
+	case "update":
+		request, ok := s.updateRequest(r, session, false)
+		if !ok {
+			s.writeError(w, http.StatusBadRequest, 2, "Invalid update request")
+			return
+		}
+
+		session.Updates = append(session.Updates, request)
+		s.writeJSON(w, utils.UpdateResponse{
+			ResourceID: resourceID,
+			SID:        sid,
+		})
+	case "updateLayout":
+		request, ok := s.updateRequest(r, session, true)
+		if !ok || session.Mode != utils.RecordingModeMix {
+			s.writeError(w, http.StatusBadRequest, 2, "Invalid updateLayout request")
+			return
+		}
+
+		session.LayoutUpdates = append(session.LayoutUpdates, request)
+		s.writeJSON(w, utils.UpdateResponse{
+			ResourceID: resourceID,
+			SID:        sid,
+		})
+	case "stop":
+		session.Stopped = true
+		session.Status = 7
+		s.writeJSON(w, utils.StopResponse{
+			ResourceID: resourceID,
+			SID:        sid,
+			ServerResponse: utils.ServerResponse{
+				FileListMode:    "json",
+				FileList:        s.fileList(session),
+				UploadingStatus: "uploaded",
+			},
+		})
+	default:
+		s.writeError(w, http.StatusNotFound, 404, "no Route matched with those values")
+	}
+}
+
+// layoutFields are the fields of clientRequest that only the updateLayout endpoint accepts
+var layoutFields = []string{"mixedVideoLayout", "maxResolutionUid", "backgroundColor", "backgroundImage", "layoutConfig"}
+
+// layoutRequest is the body accepted by the updateLayout endpoint.
+// The canvas size, bitrate and frame rate of the transcoding config can not be changed while recording.
+type layoutRequest struct {
+	Cname         string `json:"cname"`
+	UID           string `json:"uid"`
+	ClientRequest struct {
+		MixedVideoLayout *int            `json:"mixedVideoLayout"`
+		MaxResolutionUID *string         `json:"maxResolutionUid"`
+		BackgroundColor  *string         `json:"backgroundColor"`
+		BackgroundImage  *string         `json:"backgroundImage"`
+		LayoutConfig     json.RawMessage `json:"layoutConfig"`
+	} `json:"clientRequest"`
+}
+
+// updateRequest decodes a request to the update or updateLayout endpoint of the session.
+// Like Cloud Recording, the update endpoint only changes subscriptions and ignores layouts,
+// so layouts sent to it are rejected instead of silently dropped.
+// Fields that the updateLayout endpoint does not accept are rejected as well.
+func (s *Server) updateRequest(r *http.Request, session *Session, layout bool) (json.RawMessage, bool) {
+	var raw json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&raw)
+	if err != nil {
+		return nil, false
+	}
+
+	if layout {
+		var request layoutRequest
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&request)
+		if err != nil || request.Cname != session.Cname || request.UID != session.UID {
+			return nil, false
+		}
+
+		return raw, true
+	}
+
+	var request struct {
+		Cname         string                     `json:"cname"`
+		UID           string                     `json:"uid"`
+		ClientRequest map[string]json.RawMessage `json:"clientRequest"`
+	}
+	err = json.Unmarshal(raw, &request)
+	if err != nil || request.Cname != session.Cname || request.UID != session.UID || len(request.ClientRequest) == 0 {
+		return nil, false
+	}
+
+	for _, field := range layoutFields {
+		if _, ok := request.ClientRequest[field]; ok {
+			return nil, false
+		}
+	}
+
+	_, subscription := request.ClientRequest["streamSubscribe"]
+	return raw, subscription
+}
+
+func (s *Server) fileList(session *Session) json.RawMessage {
+	files := []utils.RecordingFile{
+		{
+			FileName:     session.SID + "_" + session.Cname + ".m3u8",
+			TrackType:    "audio_and_video",
+			UID:          "0",
+			MixedAllUser: true,
+			IsPlayable:   true,
+		},
+	}
+
+	fileList, _ := json.Marshal(files)
+	return fileList
+}
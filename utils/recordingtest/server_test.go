@@ -0,0 +1,199 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package recordingtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+// startSession acquires a resource and starts a recording in the mode on the server
+func startSession(t *testing.T, server *Server, mode string) Session {
+	t.Helper()
+
+	logger := zerolog.Nop()
+	recorder := &utils.Recorder{
+		Client:  server.Client(),
+		Mode:    mode,
+		Channel: "channel",
+		UID:     900001,
+		Token:   "token",
+		Logger:  &utils.Logger{Logger: &logger},
+	}
+
+	err := recorder.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Could not acquire a recording resource: %v", err)
+	}
+
+	profile := utils.RecordingProfile{
+		Width:            1280,
+		Height:           720,
+		Fps:              15,
+		Bitrate:          2260,
+		MixedVideoLayout: 1,
+		StreamTypes:      utils.StreamTypeAudioAndVideo,
+		MaxIdleTime:      30,
+		AVFileType:       []string{"hls"},
+	}
+	err = recorder.Start(context.Background(), []string{"channel"}, nil, &profile, nil, &utils.StorageDestination{Bucket: "recordings"})
+	if err != nil {
+		t.Fatalf("Could not start recording: %v", err)
+	}
+
+	session, _ := server.Session(recorder.SID)
+	return session
+}
+
+// post sends the request to the path of the session and returns the status code
+func post(t *testing.T, server *Server, session Session, action string, request interface{}) int {
+	t.Helper()
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", server.URL+"/v1/apps/"+server.AppID+"/cloud_recording/resourceid/"+session.ResourceID+"/sid/"+session.SID+"/mode/"+session.Mode+"/"+action, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.SetBasicAuth(server.CustomerID, server.CustomerCertificate)
+	resp, err := server.Server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestUpdateRejectsLayouts(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	session := startSession(t, server, utils.RecordingModeMix)
+	layout := utils.UpdateRecordRequest{
+		Cname: session.Cname,
+		UID:   session.UID,
+		ClientRequest: utils.UpdateLayoutClientRequest{
+			MixedVideoLayout: 2,
+			MaxResolutionUID: "1",
+		},
+	}
+
+	if statusCode := post(t, server, session, "update", layout); statusCode != http.StatusBadRequest {
+		t.Errorf("Layout sent to update returned status code %d, want %d", statusCode, http.StatusBadRequest)
+	}
+
+	if statusCode := post(t, server, session, "updateLayout", layout); statusCode != http.StatusOK {
+		t.Errorf("Layout sent to updateLayout returned status code %d, want %d", statusCode, http.StatusOK)
+	}
+
+	session, _ = server.Session(session.SID)
+	if len(session.Updates) != 0 || len(session.LayoutUpdates) != 1 {
+		t.Errorf("Got %d updates and %d layout updates, want only the layout update", len(session.Updates), len(session.LayoutUpdates))
+	}
+}
+
+func TestUpdateLayoutRejectsSubscriptions(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	session := startSession(t, server, utils.RecordingModeMix)
+	subscription := utils.UpdateSubscriptionRequest{
+		Cname: session.Cname,
+		UID:   session.UID,
+		ClientRequest: utils.UpdateSubscriptionClientRequest{
+			StreamSubscribe: utils.StreamSubscribe{
+				AudioUIDList: &utils.AudioUIDList{
+					SubscribeAudioUIDs: []string{"#allstream#"},
+				},
+			},
+		},
+	}
+
+	if statusCode := post(t, server, session, "updateLayout", subscription); statusCode != http.StatusBadRequest {
+		t.Errorf("Subscription sent to updateLayout returned status code %d, want %d", statusCode, http.StatusBadRequest)
+	}
+
+	_, err := server.Client().Update(context.Background(), session.ResourceID, session.SID, session.Mode, subscription)
+	if err != nil {
+		t.Errorf("Subscription update failed: %v", err)
+	}
+
+	session, _ = server.Session(session.SID)
+	if len(session.Updates) != 1 || len(session.LayoutUpdates) != 0 {
+		t.Errorf("Got %d updates and %d layout updates, want only the subscription update", len(session.Updates), len(session.LayoutUpdates))
+	}
+}
+
+func TestUpdateLayoutRejectsTranscodingFields(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	session := startSession(t, server, utils.RecordingModeMix)
+	layout := utils.UpdateRecordRequest{
+		Cname: session.Cname,
+		UID:   session.UID,
+		ClientRequest: utils.UpdateLayoutClientRequest{
+			MixedVideoLayout: 1,
+		},
+	}
+
+	if statusCode := post(t, server, session, "updateLayout", layout); statusCode != http.StatusOK {
+		t.Errorf("Layout sent to updateLayout returned status code %d, want %d", statusCode, http.StatusOK)
+	}
+
+	for _, field := range []string{"height", "width", "bitrate", "fps"} {
+		request := map[string]interface{}{
+			"cname": session.Cname,
+			"uid":   session.UID,
+			"clientRequest": map[string]interface{}{
+				"mixedVideoLayout": 1,
+				field:              720,
+			},
+		}
+
+		if statusCode := post(t, server, session, "updateLayout", request); statusCode != http.StatusBadRequest {
+			t.Errorf("Layout with %s sent to updateLayout returned status code %d, want %d", field, statusCode, http.StatusBadRequest)
+		}
+	}
+
+	session, _ = server.Session(session.SID)
+	if len(session.LayoutUpdates) != 1 {
+		t.Errorf("Got %d layout updates, want only the one without transcoding fields", len(session.LayoutUpdates))
+	}
+}
+
+func TestUpdateLayoutRequiresMixMode(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	session := startSession(t, server, utils.RecordingModeIndividual)
+	_, err := server.Client().UpdateLayout(context.Background(), session.ResourceID, session.SID, session.Mode, utils.UpdateRecordRequest{
+		Cname: session.Cname,
+		UID:   session.UID,
+		ClientRequest: utils.UpdateLayoutClientRequest{
+			MixedVideoLayout: 1,
+		},
+	})
+	if err == nil {
+		t.Error("Layout of an individual recording was changed")
+	}
+}
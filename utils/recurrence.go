@@ -0,0 +1,212 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRecurrenceCandidates bounds the number of dates considered while expanding a recurrence rule
+const maxRecurrenceCandidates = 100000
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Recurrence is a recurrence rule that can be expanded into the start times of its occurrences.
+// It supports the DAILY, WEEKLY, MONTHLY and YEARLY frequencies with INTERVAL, COUNT, UNTIL, WKST
+// and, for weekly rules, BYDAY with plain weekdays.
+type Recurrence struct {
+	Frequency string
+	Interval  int
+	Count     int
+	Until     string
+	ByDay     []time.Weekday
+	WeekStart time.Weekday
+}
+
+// NewRecurrence parses a recurrence rule that can be expanded
+func NewRecurrence(rule string) (*Recurrence, error) {
+	rule, err := ParseRecurrenceRule(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	recurrence := &Recurrence{
+		Interval:  1,
+		WeekStart: time.Monday,
+	}
+
+	for _, part := range strings.Split(rule, ";") {
+		pair := strings.SplitN(part, "=", 2)
+		name, value := pair[0], pair[1]
+
+		switch name {
+		case "FREQ":
+			switch value {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				recurrence.Frequency = value
+			default:
+				return nil, fmt.Errorf("Recurrence frequency %s is not supported", value)
+			}
+		case "INTERVAL":
+			recurrence.Interval, _ = strconv.Atoi(value)
+		case "COUNT":
+			recurrence.Count, _ = strconv.Atoi(value)
+		case "UNTIL":
+			recurrence.Until = value
+		case "WKST":
+			weekday, ok := weekdayCodes[value]
+			if !ok {
+				return nil, fmt.Errorf("Unknown weekday %s", value)
+			}
+
+			recurrence.WeekStart = weekday
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				weekday, ok := weekdayCodes[code]
+				if !ok {
+					return nil, fmt.Errorf("Unsupported weekday %s", code)
+				}
+
+				recurrence.ByDay = append(recurrence.ByDay, weekday)
+			}
+		default:
+			return nil, fmt.Errorf("Recurrence rule part %s is not supported", name)
+		}
+	}
+
+	if len(recurrence.ByDay) > 0 && recurrence.Frequency != "WEEKLY" {
+		return nil, errors.New("BYDAY is only supported for weekly recurrences")
+	}
+
+	return recurrence, nil
+}
+
+// until returns the last moment at which an occurrence may start. UNTIL dates without a time
+// include the whole day in the time zone of the meeting.
+func (recurrence *Recurrence) until(location *time.Location) (time.Time, bool) {
+	if recurrence.Until == "" {
+		return time.Time{}, false
+	}
+
+	until, err := time.Parse(icsDateTime+"Z", recurrence.Until)
+	if err == nil {
+		return until, true
+	}
+
+	date, err := time.Parse("20060102", recurrence.Until)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Date(date.Year(), date.Month(), date.Day(), 23, 59, 59, 0, location), true
+}
+
+// Each calls next with the start time of every occurrence in chronological order, starting with start,
+// until next returns false or the recurrence ends. Occurrences keep the local time of start in location
+// across daylight saving changes.
+func (recurrence *Recurrence) Each(start time.Time, location *time.Location, next func(occurrence time.Time) bool) {
+	start = start.In(location)
+	until, hasUntil := recurrence.until(location)
+
+	count := 0
+	emit := func(occurrence time.Time) bool {
+		if hasUntil && occurrence.After(until) {
+			return false
+		}
+
+		count++
+		if !next(occurrence) {
+			return false
+		}
+
+		return recurrence.Count == 0 || count < recurrence.Count
+	}
+
+	if !emit(start) {
+		return
+	}
+
+	year, month, day := start.Date()
+	hour, minute, second := start.Clock()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hour, minute, second, 0, location)
+	}
+
+	// The week containing start begins on the configured week start
+	weekStart := day - (int(start.Weekday())-int(recurrence.WeekStart)+7)%7
+	emitWeek := func(offset int, after time.Time) bool {
+		for days := 0; days < 7; days++ {
+			candidate := at(year, month, weekStart+offset+days)
+			if recurrence.onDay(candidate.Weekday()) && candidate.After(after) && !emit(candidate) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	// The remaining weekdays of the week of start belong to the first period
+	if recurrence.Frequency == "WEEKLY" && len(recurrence.ByDay) > 0 && !emitWeek(0, start) {
+		return
+	}
+
+	for period := 1; period < maxRecurrenceCandidates; period++ {
+		step := period * recurrence.Interval
+
+		switch recurrence.Frequency {
+		case "DAILY":
+			if !emit(at(year, month, day+step)) {
+				return
+			}
+		case "WEEKLY":
+			if len(recurrence.ByDay) > 0 {
+				if !emitWeek(7*step, start) {
+					return
+				}
+			} else if !emit(at(year, month, day+7*step)) {
+				return
+			}
+		case "MONTHLY":
+			candidate := at(year, month+time.Month(step), day)
+			// Months without the day of start are skipped
+			if candidate.Day() == day && !emit(candidate) {
+				return
+			}
+		case "YEARLY":
+			candidate := at(year+step, month, day)
+			if candidate.Day() == day && !emit(candidate) {
+				return
+			}
+		}
+	}
+}
+
+func (recurrence *Recurrence) onDay(weekday time.Weekday) bool {
+	for _, day := range recurrence.ByDay {
+		if day == weekday {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,167 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// maxTestOccurrences stops expanding recurrences without an end
+const maxTestOccurrences = 10
+
+func TestRecurrenceEach(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		location string
+		start    string
+		want     []string
+	}{
+		{
+			// The examples of RFC 5545 section 3.3.10 for WKST
+			name:     "weeks start on monday",
+			rule:     "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=MO",
+			location: "America/New_York",
+			start:    "1997-08-05T09:00:00",
+			want:     []string{"1997-08-05T09:00:00-04:00", "1997-08-10T09:00:00-04:00", "1997-08-19T09:00:00-04:00", "1997-08-24T09:00:00-04:00"},
+		},
+		{
+			name:     "weeks start on sunday",
+			rule:     "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=SU",
+			location: "America/New_York",
+			start:    "1997-08-05T09:00:00",
+			want:     []string{"1997-08-05T09:00:00-04:00", "1997-08-17T09:00:00-04:00", "1997-08-19T09:00:00-04:00", "1997-08-31T09:00:00-04:00"},
+		},
+		{
+			name:     "weekdays before start in its week are skipped",
+			rule:     "FREQ=WEEKLY;COUNT=4;BYDAY=MO,WE,FR",
+			location: "UTC",
+			start:    "2026-03-04T09:00:00",
+			want:     []string{"2026-03-04T09:00:00Z", "2026-03-06T09:00:00Z", "2026-03-09T09:00:00Z", "2026-03-11T09:00:00Z"},
+		},
+		{
+			name:     "monthly on the 31st skips short months",
+			rule:     "FREQ=MONTHLY;COUNT=5",
+			location: "UTC",
+			start:    "2026-01-31T10:00:00",
+			want:     []string{"2026-01-31T10:00:00Z", "2026-03-31T10:00:00Z", "2026-05-31T10:00:00Z", "2026-07-31T10:00:00Z", "2026-08-31T10:00:00Z"},
+		},
+		{
+			name:     "yearly on the 29th of February",
+			rule:     "FREQ=YEARLY;COUNT=3",
+			location: "UTC",
+			start:    "2024-02-29T10:00:00",
+			want:     []string{"2024-02-29T10:00:00Z", "2028-02-29T10:00:00Z", "2032-02-29T10:00:00Z"},
+		},
+		{
+			// An UNTIL date includes the whole day in the time zone of the meeting
+			name:     "until a date",
+			rule:     "FREQ=DAILY;UNTIL=20260304",
+			location: "America/Los_Angeles",
+			start:    "2026-03-02T18:00:00",
+			want:     []string{"2026-03-02T18:00:00-08:00", "2026-03-03T18:00:00-08:00", "2026-03-04T18:00:00-08:00"},
+		},
+		{
+			// Midnight UTC on the 4th is still the 3rd in Los Angeles, before the meeting of that day
+			name:     "until a UTC date-time",
+			rule:     "FREQ=DAILY;UNTIL=20260304T000000Z",
+			location: "America/Los_Angeles",
+			start:    "2026-03-02T18:00:00",
+			want:     []string{"2026-03-02T18:00:00-08:00"},
+		},
+		{
+			name:     "until the start of an occurrence",
+			rule:     "FREQ=DAILY;UNTIL=20260304T020000Z",
+			location: "America/Los_Angeles",
+			start:    "2026-03-02T18:00:00",
+			want:     []string{"2026-03-02T18:00:00-08:00", "2026-03-03T18:00:00-08:00"},
+		},
+		{
+			name:     "count with interval",
+			rule:     "FREQ=DAILY;INTERVAL=2;COUNT=3",
+			location: "UTC",
+			start:    "2026-03-30T08:00:00",
+			want:     []string{"2026-03-30T08:00:00Z", "2026-04-01T08:00:00Z", "2026-04-03T08:00:00Z"},
+		},
+		{
+			name:     "count of one",
+			rule:     "FREQ=WEEKLY;COUNT=1",
+			location: "UTC",
+			start:    "2026-03-30T08:00:00",
+			want:     []string{"2026-03-30T08:00:00Z"},
+		},
+		{
+			name:     "weekly across the start of daylight saving time",
+			rule:     "FREQ=WEEKLY;BYDAY=MO;COUNT=3",
+			location: "America/Los_Angeles",
+			start:    "2026-03-02T09:00:00",
+			want:     []string{"2026-03-02T09:00:00-08:00", "2026-03-09T09:00:00-07:00", "2026-03-16T09:00:00-07:00"},
+		},
+		{
+			name:     "weekly across the end of daylight saving time",
+			rule:     "FREQ=WEEKLY;COUNT=3",
+			location: "Europe/Berlin",
+			start:    "2026-10-19T09:00:00",
+			want:     []string{"2026-10-19T09:00:00+02:00", "2026-10-26T09:00:00+01:00", "2026-11-02T09:00:00+01:00"},
+		},
+		{
+			name:     "without an end",
+			rule:     "FREQ=YEARLY",
+			location: "UTC",
+			start:    "2026-01-01T00:00:00",
+			want: []string{
+				"2026-01-01T00:00:00Z", "2027-01-01T00:00:00Z", "2028-01-01T00:00:00Z", "2029-01-01T00:00:00Z", "2030-01-01T00:00:00Z",
+				"2031-01-01T00:00:00Z", "2032-01-01T00:00:00Z", "2033-01-01T00:00:00Z", "2034-01-01T00:00:00Z", "2035-01-01T00:00:00Z",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recurrence, err := NewRecurrence(test.rule)
+			if err != nil {
+				t.Fatalf("NewRecurrence(%q) failed: %v", test.rule, err)
+			}
+
+			location := loadLocation(t, test.location)
+			start, err := time.ParseInLocation("2006-01-02T15:04:05", test.start, location)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			recurrence.Each(start, location, func(occurrence time.Time) bool {
+				got = append(got, occurrence.Format(time.RFC3339))
+				return len(got) < maxTestOccurrences
+			})
+
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("Occurrences of %s are %v, want %v", test.rule, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewRecurrenceRejectsUnsupportedRules(t *testing.T) {
+	for _, rule := range []string{
+		"FREQ=HOURLY",
+		"FREQ=MONTHLY;BYDAY=-1FR",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYMONTHDAY=15",
+		"FREQ=WEEKLY;WKST=XX",
+	} {
+		if _, err := NewRecurrence(rule); err == nil {
+			t.Errorf("NewRecurrence(%q) accepted an unsupported rule", rule)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package rtctoken
+
+import (
+	"fmt"
+
+	"github.com/samyak-jain/agora_backend/utils/accesstoken2"
+)
+
+// PrivilegeExpires contains the number of seconds after which each privilege of an AccessToken2 expires.
+// Privileges set to 0 are not granted, so a token can for example allow publishing audio but not video.
+type PrivilegeExpires struct {
+	JoinChannel        uint32
+	PublishAudioStream uint32
+	PublishVideoStream uint32
+	PublishDataStream  uint32
+}
+
+// BuildToken2WithUID builds an AccessToken2 for a uid that is valid for tokenExpire seconds
+func BuildToken2WithUID(appID string, appCertificate string, channelName string, uid uint32, tokenExpire uint32, privileges PrivilegeExpires) (string, error) {
+	return BuildToken2WithUserAccount(appID, appCertificate, channelName, fmt.Sprint(uid), tokenExpire, privileges)
+}
+
+// BuildToken2WithUserAccount builds an AccessToken2 for a user account that is valid for tokenExpire seconds
+func BuildToken2WithUserAccount(appID string, appCertificate string, channelName string, userAccount string, tokenExpire uint32, privileges PrivilegeExpires) (string, error) {
+	service := accesstoken2.NewServiceRtc(channelName, userAccount)
+	for privilege, expire := range map[uint16]uint32{
+		accesstoken2.PrivilegeJoinChannel:        privileges.JoinChannel,
+		accesstoken2.PrivilegePublishAudioStream: privileges.PublishAudioStream,
+		accesstoken2.PrivilegePublishVideoStream: privileges.PublishVideoStream,
+		accesstoken2.PrivilegePublishDataStream:  privileges.PublishDataStream,
+	} {
+		if expire > 0 {
+			service.AddPrivilege(privilege, expire)
+		}
+	}
+
+	token := accesstoken2.NewAccessToken(appID, appCertificate, tokenExpire)
+	token.AddService(service)
+
+	return token.Build()
+}
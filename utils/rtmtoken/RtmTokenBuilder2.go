@@ -0,0 +1,24 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package rtmtoken
+
+import "github.com/samyak-jain/agora_backend/utils/accesstoken2"
+
+// BuildToken2 builds an AccessToken2 allowing the user to login to RTM for expire seconds
+func BuildToken2(appID string, appCertificate string, userID string, expire uint32) (string, error) {
+	service := accesstoken2.NewServiceRtm(userID)
+	service.AddPrivilege(accesstoken2.PrivilegeLogin, expire)
+
+	token := accesstoken2.NewAccessToken(appID, appCertificate, expire)
+	token.AddService(service)
+
+	return token.Build()
+}
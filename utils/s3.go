@@ -0,0 +1,291 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxDeleteKeys is the maximum number of objects that can be deleted by a single DeleteObjects request
+const maxDeleteKeys = 1000
+
+// defaultSigningRegion is used to sign requests to S3 compatible endpoints of other vendors
+const defaultSigningRegion = "us-east-1"
+
+// S3Client lists and deletes objects through the S3 API, signing requests with Signature Version 4
+type S3Client struct {
+	Client *http.Client
+}
+
+type s3Object struct {
+	Key string `xml:"Key"`
+}
+
+type listBucketResult struct {
+	Contents              []s3Object `xml:"Contents"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	NextContinuationToken string     `xml:"NextContinuationToken"`
+}
+
+type deleteRequest struct {
+	XMLName xml.Name   `xml:"Delete"`
+	Quiet   bool       `xml:"Quiet"`
+	Objects []s3Object `xml:"Object"`
+}
+
+type s3Error struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type deleteResult struct {
+	Errors []s3Error `xml:"Error"`
+}
+
+// List returns the keys of every object under prefix
+func (c *S3Client) List(destination *StorageDestination, prefix string) ([]string, error) {
+	keys := []string{}
+	continuationToken := ""
+
+	for {
+		query := map[string]string{
+			"list-type": "2",
+			"prefix":    prefix,
+		}
+
+		if continuationToken != "" {
+			query["continuation-token"] = continuationToken
+		}
+
+		var result listBucketResult
+		err := c.do(destination, "GET", query, nil, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+// Delete deletes the objects with the given keys
+func (c *S3Client) Delete(destination *StorageDestination, keys []string) error {
+	for start := 0; start < len(keys); start += maxDeleteKeys {
+		end := start + maxDeleteKeys
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		request := deleteRequest{
+			Quiet: true,
+		}
+
+		for _, key := range keys[start:end] {
+			request.Objects = append(request.Objects, s3Object{Key: key})
+		}
+
+		body, err := xml.Marshal(request)
+		if err != nil {
+			return err
+		}
+
+		var result deleteResult
+		err = c.do(destination, "POST", map[string]string{"delete": ""}, body, &result)
+		if err != nil {
+			return err
+		}
+
+		if len(result.Errors) > 0 {
+			failed := result.Errors[0]
+			return fmt.Errorf("Could not delete %d objects, %s: %s %s", len(result.Errors), failed.Key, failed.Code, failed.Message)
+		}
+	}
+
+	return nil
+}
+
+// endpoint returns the URL of the bucket, using path style addressing for custom endpoints
+func (c *S3Client) endpoint(destination *StorageDestination) (*url.URL, error) {
+	if destination.Endpoint != "" {
+		return url.Parse(destination.Endpoint + "/" + destination.Bucket + "/")
+	}
+
+	return url.Parse("https://" + destination.Bucket + ".s3." + destination.AWSRegion() + ".amazonaws.com/")
+}
+
+func (c *S3Client) do(destination *StorageDestination, method string, query map[string]string, body []byte, result interface{}) error {
+	endpoint, err := c.endpoint(destination)
+	if err != nil {
+		return err
+	}
+
+	endpoint.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		checksum := md5.Sum(body)
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(checksum[:]))
+		req.Header.Set("Content-Type", "application/xml")
+	}
+
+	region := destination.AWSRegion()
+	if region == "" {
+		region = defaultSigningRegion
+	}
+
+	signS3Request(req, body, destination.AccessKey, destination.SecretKey, region, time.Now())
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var s3Err s3Error
+		xml.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&s3Err)
+		return fmt.Errorf("S3 returned status code %d: %s %s", resp.StatusCode, s3Err.Code, s3Err.Message)
+	}
+
+	response, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return xml.Unmarshal(response, result)
+}
+
+// signS3Request adds the Signature Version 4 authorization headers to the request
+func signS3Request(req *http.Request, body []byte, accessKey string, secretKey string, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{
+		"host": req.URL.Host,
+	}
+
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode encodes everything except the unreserved characters as required by Signature Version 4
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case b >= 'A' && b <= 'Z', b >= 'a' && b <= 'z', b >= '0' && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			encoded.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			encoded.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+
+	return encoded.String()
+}
+
+func canonicalPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	return uriEncode(path, false)
+}
+
+func canonicalQuery(query map[string]string) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	parameters := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parameters = append(parameters, uriEncode(key, true)+"="+uriEncode(query[key], true))
+	}
+
+	return strings.Join(parameters, "&")
+}
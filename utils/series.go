@@ -0,0 +1,105 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/spf13/viper"
+)
+
+// ErrMeetingNotStarted is returned when a meeting series is joined before the early join window of its first occurrence
+var ErrMeetingNotStarted = errors.New("Meeting has not started yet")
+
+func seriesRecurrence(series *models.MeetingSeriesRecord) (*Recurrence, *time.Location, error) {
+	location, err := time.LoadLocation(series.Timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recurrence, err := NewRecurrence(series.Recurrence)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return recurrence, location, nil
+}
+
+// CurrentOccurrence returns the start of the latest occurrence of the series whose early join window has opened at now
+func CurrentOccurrence(series *models.MeetingSeriesRecord, now time.Time) (time.Time, error) {
+	recurrence, location, err := seriesRecurrence(series)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	earlyJoin := time.Duration(viper.GetInt("EARLY_JOIN_MINUTES")) * time.Minute
+
+	var current time.Time
+	recurrence.Each(series.StartTime, location, func(occurrence time.Time) bool {
+		if occurrence.Add(-earlyJoin).After(now) {
+			return false
+		}
+
+		current = occurrence
+		return true
+	})
+
+	if current.IsZero() {
+		return time.Time{}, ErrMeetingNotStarted
+	}
+
+	return current, nil
+}
+
+// UpcomingOccurrences returns the start of the next occurrences of the series that have not ended at now
+func UpcomingOccurrences(series *models.MeetingSeriesRecord, now time.Time, limit int) ([]time.Time, error) {
+	recurrence, location, err := seriesRecurrence(series)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := time.Duration(series.Duration) * time.Minute
+
+	occurrences := []time.Time{}
+	recurrence.Each(series.StartTime, location, func(occurrence time.Time) bool {
+		if occurrence.Add(duration).After(now) {
+			occurrences = append(occurrences, occurrence)
+		}
+
+		return len(occurrences) < limit
+	})
+
+	return occurrences, nil
+}
+
+// OpenCurrentOccurrence creates the channel of the occurrence of the series that can be joined now.
+// Every occurrence gets a new channel name, so that sessions, recordings and UIDs are kept apart.
+func OpenCurrentOccurrence(db *models.Database, series *models.MeetingSeriesRecord) error {
+	start, err := CurrentOccurrence(series, time.Now())
+	if err != nil {
+		return err
+	}
+
+	channelName, err := GenerateUUID()
+	if err != nil {
+		return err
+	}
+
+	secret, err := GenerateUUID()
+	if err != nil {
+		return err
+	}
+
+	return db.OpenOccurrence(series, start, strings.ReplaceAll(channelName, "-", ""), strings.ReplaceAll(secret, "-", ""))
+}
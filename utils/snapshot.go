@@ -0,0 +1,111 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/viper"
+)
+
+// Limits of the capture interval in seconds allowed by Cloud Recording
+const (
+	minCaptureInterval = 5
+	maxCaptureInterval = 3600
+)
+
+// snapshotMaxIdleTime is the number of seconds without users after which a snapshot session stops
+const snapshotMaxIdleTime = 30
+
+// SnapshotConfig is the snapshotConfig of a Cloud Recording start request
+type SnapshotConfig struct {
+	CaptureInterval int      `json:"captureInterval"`
+	FileType        []string `json:"fileType"`
+}
+
+// SnapshotSettings configures the snapshot sessions of channels
+type SnapshotSettings struct {
+	// CaptureInterval is the number of seconds between two snapshots
+	CaptureInterval int
+	FilePrefix      *FilePrefixTemplate
+}
+
+// LoadSnapshotSettings reads and validates SNAPSHOT_CAPTURE_INTERVAL and SNAPSHOT_FILE_PREFIX
+func LoadSnapshotSettings() (*SnapshotSettings, error) {
+	captureInterval := viper.GetInt("SNAPSHOT_CAPTURE_INTERVAL")
+	if captureInterval < minCaptureInterval || captureInterval > maxCaptureInterval {
+		return nil, fmt.Errorf("SNAPSHOT_CAPTURE_INTERVAL must be between %d and %d seconds", minCaptureInterval, maxCaptureInterval)
+	}
+
+	filePrefix, err := loadFilePrefixTemplate("SNAPSHOT_FILE_PREFIX")
+	if err != nil {
+		return nil, err
+	}
+
+	return &SnapshotSettings{
+		CaptureInterval: captureInterval,
+		FilePrefix:      filePrefix,
+	}, nil
+}
+
+// StartSnapshot starts capturing JPG snapshots of the video of every user in the channel.
+// Snapshots are only supported in individual mode, so the mode of the recorder is ignored.
+func (rec *Recorder) StartSnapshot(ctx context.Context, fileNamePrefix []string, secret *string, captureInterval int, storage *StorageDestination) error {
+	rec.Mode = RecordingModeIndividual
+
+	recordingConfig := RecordingConfig{
+		MaxIdleTime: snapshotMaxIdleTime,
+		StreamTypes: StreamTypeVideo,
+		ChannelType: 1,
+	}
+
+	if secret != nil && *secret != "" {
+		recordingConfig.DecryptionMode = 1
+		recordingConfig.Secret = *secret
+	}
+
+	snapshotRequest := StartRecordRequest{
+		Cname: rec.Channel,
+		UID:   strconv.Itoa(int(rec.UID)),
+		ClientRequest: ClientRequest{
+			Token: rec.Token,
+			StorageConfig: StorageConfig{
+				Vendor:         storage.Vendor,
+				Region:         storage.Region,
+				Bucket:         storage.Bucket,
+				AccessKey:      storage.AccessKey,
+				SecretKey:      storage.SecretKey,
+				FileNamePrefix: fileNamePrefix,
+			},
+			SnapshotConfig: &SnapshotConfig{
+				CaptureInterval: captureInterval,
+				FileType:        []string{"jpg"},
+			},
+			RecordingConfig: recordingConfig,
+		},
+	}
+
+	rec.Logger.Info().Interface("Start Request", snapshotRequest).Msg("Snapshot request")
+
+	result, err := rec.Client.Start(ctx, rec.RID, rec.Mode, snapshotRequest)
+	if err != nil {
+		return err
+	}
+
+	rec.SID = result.SID
+	rec.FileNamePrefix = fileNamePrefix
+
+	rec.Logger.Debug().Interface("Result", result).Msg("Snapshot Result")
+
+	return nil
+}
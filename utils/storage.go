@@ -0,0 +1,242 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultStorageDestination is the name of the destination used when a channel does not choose one
+const DefaultStorageDestination = "default"
+
+// StorageVendor is the third party cloud storage vendor as defined by Cloud Recording
+type StorageVendor int
+
+// Storage vendors supported by Cloud Recording
+const (
+	StorageVendorQiniu    StorageVendor = 0
+	StorageVendorAWS      StorageVendor = 1
+	StorageVendorAlibaba  StorageVendor = 2
+	StorageVendorTencent  StorageVendor = 3
+	StorageVendorKingsoft StorageVendor = 4
+	StorageVendorAzure    StorageVendor = 5
+	StorageVendorGoogle   StorageVendor = 6
+)
+
+var storageVendors = map[string]StorageVendor{
+	"qiniu":    StorageVendorQiniu,
+	"aws":      StorageVendorAWS,
+	"alibaba":  StorageVendorAlibaba,
+	"tencent":  StorageVendorTencent,
+	"kingsoft": StorageVendorKingsoft,
+	"azure":    StorageVendorAzure,
+	"google":   StorageVendorGoogle,
+}
+
+// String returns the configuration name of the vendor
+func (v StorageVendor) String() string {
+	for name, vendor := range storageVendors {
+		if vendor == v {
+			return name
+		}
+	}
+
+	return strconv.Itoa(int(v))
+}
+
+// ParseStorageVendor parses a vendor either by its name or by its Cloud Recording number
+func ParseStorageVendor(value string) (StorageVendor, error) {
+	if vendor, ok := storageVendors[strings.ToLower(value)]; ok {
+		return vendor, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err == nil {
+		for _, vendor := range storageVendors {
+			if int(vendor) == number {
+				return vendor, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("Unknown storage vendor %s", value)
+}
+
+// StorageRegion is the region of the bucket as defined by Cloud Recording for the vendor
+type StorageRegion int
+
+// awsRegions are the AWS S3 regions in the order used by Cloud Recording
+var awsRegions = []string{
+	"us-east-1",
+	"us-east-2",
+	"us-west-1",
+	"us-west-2",
+	"eu-west-1",
+	"eu-west-2",
+	"eu-west-3",
+	"eu-central-1",
+	"ap-southeast-1",
+	"ap-southeast-2",
+	"ap-northeast-1",
+	"ap-northeast-2",
+	"sa-east-1",
+	"ca-central-1",
+	"ap-south-1",
+	"cn-north-1",
+	"cn-northwest-1",
+}
+
+// ParseStorageRegion parses the region of the vendor. AWS regions can be given by name,
+// every vendor accepts the Cloud Recording region number.
+func ParseStorageRegion(vendor StorageVendor, value string) (StorageRegion, error) {
+	if vendor == StorageVendorGoogle {
+		return 0, nil
+	}
+
+	if vendor == StorageVendorAWS {
+		for index, region := range awsRegions {
+			if strings.ToLower(value) == region {
+				return StorageRegion(index), nil
+			}
+		}
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("Unknown region %s for storage vendor %s", value, vendor)
+	}
+
+	if vendor == StorageVendorAWS && number >= len(awsRegions) {
+		return 0, fmt.Errorf("Unknown region %s for storage vendor %s", value, vendor)
+	}
+
+	return StorageRegion(number), nil
+}
+
+// StorageDestination is a bucket that recordings can be uploaded to
+type StorageDestination struct {
+	Vendor    StorageVendor
+	Region    StorageRegion
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// Endpoint is the URL of the S3 compatible API of the vendor, used to delete expired recordings
+	Endpoint string
+	// RetentionDays is the number of days recordings are kept for, 0 uses RECORDING_RETENTION_DAYS
+	RetentionDays int
+}
+
+// AWSRegion returns the name of the AWS region of the destination
+func (d *StorageDestination) AWSRegion() string {
+	if d.Vendor != StorageVendorAWS || int(d.Region) >= len(awsRegions) {
+		return ""
+	}
+
+	return awsRegions[d.Region]
+}
+
+// storageDestinationConfig is a storage destination as written in the configuration
+type storageDestinationConfig struct {
+	Vendor        string `mapstructure:"vendor" json:"vendor"`
+	Region        string `mapstructure:"region" json:"region"`
+	Bucket        string `mapstructure:"bucket" json:"bucket"`
+	AccessKey     string `mapstructure:"accessKey" json:"accessKey"`
+	SecretKey     string `mapstructure:"secretKey" json:"secretKey"`
+	Endpoint      string `mapstructure:"endpoint" json:"endpoint"`
+	RetentionDays int    `mapstructure:"retentionDays" json:"retentionDays"`
+}
+
+func (c *storageDestinationConfig) parse() (*StorageDestination, error) {
+	vendor, err := ParseStorageVendor(c.Vendor)
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := ParseStorageRegion(vendor, c.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Bucket == "" || c.AccessKey == "" || c.SecretKey == "" {
+		return nil, fmt.Errorf("bucket, accessKey and secretKey are required")
+	}
+
+	if c.RetentionDays < 0 {
+		return nil, fmt.Errorf("retentionDays cannot be negative")
+	}
+
+	if c.Endpoint != "" {
+		endpoint, err := url.Parse(c.Endpoint)
+		if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+			return nil, fmt.Errorf("Invalid endpoint %s", c.Endpoint)
+		}
+	}
+
+	return &StorageDestination{
+		Vendor:        vendor,
+		Region:        region,
+		Bucket:        c.Bucket,
+		AccessKey:     c.AccessKey,
+		SecretKey:     c.SecretKey,
+		Endpoint:      strings.TrimSuffix(c.Endpoint, "/"),
+		RetentionDays: c.RetentionDays,
+	}, nil
+}
+
+// LoadStorageDestinations reads and validates the named storage destinations from RECORDING_STORAGE.
+// RECORDING_STORAGE can either be an object in config.json or a JSON string in the environment.
+// When BUCKET_NAME is set, it is used as the default destination unless RECORDING_STORAGE defines one.
+func LoadStorageDestinations() (map[string]StorageDestination, error) {
+	configured := map[string]storageDestinationConfig{}
+
+	if raw, ok := viper.Get("RECORDING_STORAGE").(string); ok {
+		if raw != "" {
+			err := json.Unmarshal([]byte(raw), &configured)
+			if err != nil {
+				return nil, fmt.Errorf("Could not parse RECORDING_STORAGE: %s", err)
+			}
+		}
+	} else if viper.IsSet("RECORDING_STORAGE") {
+		err := viper.UnmarshalKey("RECORDING_STORAGE", &configured)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse RECORDING_STORAGE: %s", err)
+		}
+	}
+
+	if _, ok := configured[DefaultStorageDestination]; !ok && viper.GetString("BUCKET_NAME") != "" {
+		configured[DefaultStorageDestination] = storageDestinationConfig{
+			Vendor:    viper.GetString("RECORDING_VENDOR"),
+			Region:    viper.GetString("RECORDING_REGION"),
+			Bucket:    viper.GetString("BUCKET_NAME"),
+			AccessKey: viper.GetString("BUCKET_ACCESS_KEY"),
+			SecretKey: viper.GetString("BUCKET_ACCESS_SECRET"),
+		}
+	}
+
+	destinations := map[string]StorageDestination{}
+	for name := range configured {
+		config := configured[name]
+		destination, err := config.parse()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid storage destination %s: %s", name, err)
+		}
+
+		destinations[name] = *destination
+	}
+
+	return destinations, nil
+}
@@ -0,0 +1,67 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrStorageUnsupported is returned when files cannot be managed on the vendor of a storage destination
+var ErrStorageUnsupported = errors.New("Storage vendor does not support deleting files, configure an S3 compatible endpoint")
+
+// StorageClient is used to manage the files uploaded to storage destinations
+type StorageClient interface {
+	// List returns the keys of every object under prefix
+	List(destination *StorageDestination, prefix string) ([]string, error)
+	// Delete deletes the objects with the given keys
+	Delete(destination *StorageDestination, keys []string) error
+}
+
+// VendorStorageClient is the StorageClient which uses the S3 API for AWS destinations
+// and for every destination with an S3 compatible endpoint
+type VendorStorageClient struct {
+	S3 *S3Client
+}
+
+// NewStorageClient creates a StorageClient for the configured storage destinations
+func NewStorageClient() *VendorStorageClient {
+	return &VendorStorageClient{
+		S3: &S3Client{
+			Client: &http.Client{
+				Timeout: 30 * time.Second,
+			},
+		},
+	}
+}
+
+func (c *VendorStorageClient) supported(destination *StorageDestination) bool {
+	return destination.Vendor == StorageVendorAWS || destination.Endpoint != ""
+}
+
+// List returns the keys of every object under prefix
+func (c *VendorStorageClient) List(destination *StorageDestination, prefix string) ([]string, error) {
+	if !c.supported(destination) {
+		return nil, ErrStorageUnsupported
+	}
+
+	return c.S3.List(destination, prefix)
+}
+
+// Delete deletes the objects with the given keys
+func (c *VendorStorageClient) Delete(destination *StorageDestination, keys []string) error {
+	if !c.supported(destination) {
+		return ErrStorageUnsupported
+	}
+
+	return c.S3.Delete(destination, keys)
+}
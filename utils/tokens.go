@@ -11,64 +11,282 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils/accesstoken2"
 	"github.com/samyak-jain/agora_backend/utils/rtctoken"
 	"github.com/samyak-jain/agora_backend/utils/rtmtoken"
 	"github.com/spf13/viper"
 )
 
-// GetRtcToken generates token for Agora RTC SDK
-func GetRtcToken(channel string, uid int) (string, error) {
-	var RtcRole rtctoken.Role = rtctoken.RolePublisher
+// CredentialType is the kind of user that credentials are generated for. Each type has its own token TTL.
+type CredentialType string
+
+// Credential types, the TTL of each type is configured by TOKEN_TTL_<type>
+const (
+	CredentialHost        CredentialType = "HOST"
+	CredentialAttendee    CredentialType = "ATTENDEE"
+	CredentialScreenShare CredentialType = "SCREEN_SHARE"
+	CredentialPSTN        CredentialType = "PSTN"
+	// CredentialRecording is used by Cloud Recording, which cannot renew its token while recording
+	CredentialRecording CredentialType = "RECORDING"
+)
 
-	currentTimestamp := uint32(time.Now().UTC().Unix())
-	expireTimestamp := currentTimestamp + 86400
+// TTL returns the number of seconds tokens of this type are valid for
+func (t CredentialType) TTL() uint32 {
+	ttl := viper.GetInt("TOKEN_TTL_" + string(t))
+	if ttl <= 0 {
+		return 86400
+	}
 
-	return rtctoken.BuildTokenWithUID(viper.GetString("APP_ID"), viper.GetString("APP_CERTIFICATE"), channel, uint32(uid), RtcRole, expireTimestamp)
+	return uint32(ttl)
 }
 
-// GetRtmToken generates a token for Agora RTM SDK
-func GetRtmToken(user string) (string, error) {
+// TokenPrivileges returns the privileges granted by a RTC token with the given role
+func TokenPrivileges(role rtctoken.Role) []models.TokenPrivilege {
+	if role == rtctoken.RoleSubscriber {
+		return []models.TokenPrivilege{models.TokenPrivilegeJoinChannel}
+	}
+
+	return []models.TokenPrivilege{
+		models.TokenPrivilegeJoinChannel,
+		models.TokenPrivilegePublishAudioStream,
+		models.TokenPrivilegePublishVideoStream,
+		models.TokenPrivilegePublishDataStream,
+	}
+}
+
+// accessToken2Enabled reports whether tokens are built as AccessToken2, which can grant publish privileges separately
+func accessToken2Enabled() bool {
+	return viper.GetString("TOKEN_VERSION") == accesstoken2.Version
+}
+
+// Privileges returns the privileges granted to users of this type with the given role.
+// With AccessToken2 publishers only get the publish privileges listed in TOKEN_PRIVILEGES_<type>, when it is set.
+func (t CredentialType) Privileges(role rtctoken.Role) []models.TokenPrivilege {
+	privileges := TokenPrivileges(role)
+	configured := viper.GetStringSlice("TOKEN_PRIVILEGES_" + string(t))
+	if !accessToken2Enabled() || role == rtctoken.RoleSubscriber || len(configured) == 0 {
+		return privileges
+	}
+
+	privileges = []models.TokenPrivilege{models.TokenPrivilegeJoinChannel}
+	for _, value := range configured {
+		privilege := models.TokenPrivilege(strings.ToUpper(value))
+		if privilege.IsValid() && privilege != models.TokenPrivilegeJoinChannel {
+			privileges = append(privileges, privilege)
+		}
+	}
+
+	return privileges
+}
+
+// privilegeExpires grants every privilege until the token expires
+func privilegeExpires(privileges []models.TokenPrivilege, expire uint32) rtctoken.PrivilegeExpires {
+	var expires rtctoken.PrivilegeExpires
+	for _, privilege := range privileges {
+		switch privilege {
+		case models.TokenPrivilegeJoinChannel:
+			expires.JoinChannel = expire
+		case models.TokenPrivilegePublishAudioStream:
+			expires.PublishAudioStream = expire
+		case models.TokenPrivilegePublishVideoStream:
+			expires.PublishVideoStream = expire
+		case models.TokenPrivilegePublishDataStream:
+			expires.PublishDataStream = expire
+		}
+	}
+
+	return expires
+}
+
+// tokenExpire converts an expiry timestamp to the number of seconds from now used by AccessToken2
+func tokenExpire(expireTimestamp uint32) uint32 {
+	now := uint32(time.Now().Unix())
+	if expireTimestamp <= now {
+		return 1
+	}
+
+	return expireTimestamp - now
+}
+
+// rtcToken generates a token for a uid or, when account is not empty, for a user account.
+// The legacy AccessToken grants privileges by role only.
+func rtcToken(channel string, uid int, account string, role rtctoken.Role, privileges []models.TokenPrivilege, expireTimestamp uint32) (string, error) {
+	appID := viper.GetString("APP_ID")
+	appCertificate := viper.GetString("APP_CERTIFICATE")
+
+	if !accessToken2Enabled() {
+		if account != "" {
+			return rtctoken.BuildTokenWithUserAccount(appID, appCertificate, channel, account, role, expireTimestamp)
+		}
+
+		return rtctoken.BuildTokenWithUID(appID, appCertificate, channel, uint32(uid), role, expireTimestamp)
+	}
+
+	expire := tokenExpire(expireTimestamp)
+	if account != "" {
+		return rtctoken.BuildToken2WithUserAccount(appID, appCertificate, channel, account, expire, privilegeExpires(privileges, expire))
+	}
+
+	return rtctoken.BuildToken2WithUID(appID, appCertificate, channel, uint32(uid), expire, privilegeExpires(privileges, expire))
+}
 
-	currentTimestamp := uint32(time.Now().UTC().Unix())
-	expireTimestamp := currentTimestamp + 86400
+// GetRtcToken generates token for Agora RTC SDK
+func GetRtcToken(channel string, uid int, role rtctoken.Role, expireTimestamp uint32) (string, error) {
+	return rtcToken(channel, uid, "", role, TokenPrivileges(role), expireTimestamp)
+}
+
+// GetRtcTokenWithAccount generates a token for Agora RTC SDK bound to a string user account
+func GetRtcTokenWithAccount(channel string, account string, role rtctoken.Role, expireTimestamp uint32) (string, error) {
+	return rtcToken(channel, 0, account, role, TokenPrivileges(role), expireTimestamp)
+}
+
+// GetRtmToken generates a token for Agora RTM SDK
+func GetRtmToken(user string, expireTimestamp uint32) (string, error) {
+	if accessToken2Enabled() {
+		return rtmtoken.BuildToken2(viper.GetString("APP_ID"), viper.GetString("APP_CERTIFICATE"), user, tokenExpire(expireTimestamp))
+	}
 
 	return rtmtoken.BuildToken(viper.GetString("APP_ID"), viper.GetString("APP_CERTIFICATE"), user, rtmtoken.RoleRtmUser, expireTimestamp)
 }
 
-// GenerateUserCredentials generates uid, rtc and rtc token
-func GenerateUserCredentials(channel string, rtm bool, pstn bool) (*models.UserCredentials, error) {
+// UID ranges, PSTN users get a UID in the 1xxxxxxxx range and every other user a UID in the 2xxxxxxxx range
+const (
+	pstnUIDBase = 100000000
+	webUIDBase  = 200000000
+)
+
+// RandomUID picks a random UID in the range of the credential type
+func RandomUID(credentialType CredentialType) int {
 	initialUID := RandomRange(10000000, 99999999)
-	var uid int
-	if pstn {
-		uid = initialUID + 100000000
+	if credentialType == CredentialPSTN {
+		return initialUID + pstnUIDBase
+	}
+
+	return initialUID + webUIDBase
+}
+
+// GenerateRenewalSecret generates the secret that proves a user was issued a UID when renewing its credentials
+func GenerateRenewalSecret() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// HashRenewalSecret returns the hash under which the renewal secret is stored
+func HashRenewalSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// ReserveUserCredentials reserves a UID that is unique in the channel until the credentials expire
+// and generates its rtc and rtm token. When account is not empty the tokens are bound to the user account instead of the UID.
+// Credentials of renewable kinds of UIDs come with the secret needed to renew them.
+func ReserveUserCredentials(db models.UIDReserver, channelID int64, channel string, kind string, account string, rtm bool, credentialType CredentialType, role rtctoken.Role) (*models.UserCredentials, error) {
+	var renewalSecret string
+	var renewalHash sql.NullString
+	if models.RenewableUIDKind(kind) {
+		secret, err := GenerateRenewalSecret()
+		if err != nil {
+			return nil, err
+		}
+
+		renewalSecret = secret
+		renewalHash = sql.NullString{String: HashRenewalSecret(secret), Valid: true}
+	}
+
+	expiresAt := time.Now().Add(time.Duration(credentialType.TTL()) * time.Second)
+	uid, err := db.ReserveUID(channelID, kind, sql.NullString{String: account, Valid: account != ""}, renewalHash, func() int {
+		return RandomUID(credentialType)
+	}, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials *models.UserCredentials
+	if account != "" {
+		credentials, err = AccountCredentials(channel, uid, account, rtm, credentialType, role)
 	} else {
-		uid = initialUID + 200000000
+		credentials, err = UserCredentials(channel, uid, rtm, credentialType, role)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	rtcToken, err := GetRtcToken(channel, uid)
+	if renewalHash.Valid {
+		credentials.RenewalSecret = &renewalSecret
+	}
+
+	return credentials, nil
+}
+
+// UserCredentials generates the rtc and rtm token of an existing uid
+func UserCredentials(channel string, uid int, rtm bool, credentialType CredentialType, role rtctoken.Role) (*models.UserCredentials, error) {
+	expiresAt := time.Now().UTC().Add(time.Duration(credentialType.TTL()) * time.Second)
+
+	privileges := credentialType.Privileges(role)
+
+	token, err := rtcToken(channel, uid, "", role, privileges, uint32(expiresAt.Unix()))
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials(token, uid, fmt.Sprint(uid), rtm, expiresAt, privileges)
+}
+
+// AccountCredentials generates the rtc and rtm token of an existing user account.
+// The uid is the reservation of the user in the channel and is only used to renew the credentials.
+func AccountCredentials(channel string, uid int, account string, rtm bool, credentialType CredentialType, role rtctoken.Role) (*models.UserCredentials, error) {
+	expiresAt := time.Now().UTC().Add(time.Duration(credentialType.TTL()) * time.Second)
+
+	privileges := credentialType.Privileges(role)
+
+	token, err := rtcToken(channel, uid, account, role, privileges, uint32(expiresAt.Unix()))
 	if err != nil {
 		return nil, err
 	}
 
+	credentials, err := credentials(token, uid, account, rtm, expiresAt, privileges)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials.Account = &account
+
+	return credentials, nil
+}
+
+// credentials adds the rtm token of the rtm user to the rtc token if requested
+func credentials(rtc string, uid int, rtmUser string, rtm bool, expiresAt time.Time, privileges []models.TokenPrivilege) (*models.UserCredentials, error) {
+	credentials := &models.UserCredentials{
+		Rtc:        rtc,
+		UID:        uid,
+		Privileges: privileges,
+		ExpiresAt:  expiresAt.Format(time.RFC3339),
+	}
+
 	if !rtm {
-		return &models.UserCredentials{
-			Rtc: rtcToken,
-			UID: uid,
-		}, nil
+		return credentials, nil
 	}
 
-	rtmToken, err := GetRtmToken(fmt.Sprint(uid))
+	rtmToken, err := GetRtmToken(rtmUser, uint32(expiresAt.Unix()))
 	if err != nil {
 		return nil, err
 	}
 
-	return &models.UserCredentials{
-		Rtc: rtcToken,
-		Rtm: &rtmToken,
-		UID: uid,
-	}, nil
+	credentials.Rtm = &rtmToken
+
+	return credentials, nil
 }
@@ -0,0 +1,80 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+)
+
+// maxUserAccountLength is the longest user id accepted by RTM, RTC accepts user accounts of up to 255 bytes
+const maxUserAccountLength = 64
+
+// screenShareSuffix is appended to the user account of a user to get the account of their screen share
+const screenShareSuffix = ":screen"
+
+// guestAccount is the user account prefix of guests without a display name
+const guestAccount = "Guest"
+
+// userAccountCharacters are the characters Agora allows in a user account besides letters and digits
+const userAccountCharacters = " !#$%&()+-:;<=.>?@[]^_{}|~,"
+
+// sanitizeUserAccount removes the characters that are not allowed in a user account
+func sanitizeUserAccount(account string) string {
+	return strings.TrimSpace(strings.Map(func(char rune) rune {
+		if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || strings.ContainsRune(userAccountCharacters, char) {
+			return char
+		}
+
+		return -1
+	}, account))
+}
+
+// truncateUserAccount shortens the user account so that it can be used to login to RTM
+func truncateUserAccount(account string, maxLength int) string {
+	if len(account) > maxLength {
+		return strings.TrimSpace(account[:maxLength])
+	}
+
+	return account
+}
+
+// UserAccountName returns the Agora user account of a user joining a channel.
+// Authenticated users are identified by their identifier while guests get their
+// display name followed by a random suffix, since different guests can share a name.
+func UserAccountName(user *models.UserAccount, displayName string) (string, error) {
+	if user != nil && sanitizeUserAccount(user.Identifier) != "" {
+		return truncateUserAccount(sanitizeUserAccount(user.Identifier), maxUserAccountLength), nil
+	}
+
+	suffix := make([]byte, 3)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return "", err
+	}
+
+	name := sanitizeUserAccount(displayName)
+	if name == "" {
+		name = guestAccount
+	}
+
+	tag := "#" + hex.EncodeToString(suffix)
+
+	return truncateUserAccount(name, maxUserAccountLength-len(tag)) + tag, nil
+}
+
+// ScreenShareAccountName returns the user account of the screen share of a user
+func ScreenShareAccountName(account string) string {
+	return account + screenShareSuffix
+}